@@ -25,6 +25,6 @@ import (
 var (
 	ServerDesc = &srv.Description{
 		Name:  "server.access.api",
-		Funcs: []srv.Func{{"Query", Query}},
+		Funcs: []srv.Func{{"Query", Query}, {"Explain", Explain}, {"ConfigNotify", ConfigNotify}},
 	}
 )
@@ -0,0 +1,80 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+
+	"github.com/horm-database/common/compress"
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/limit"
+	"github.com/horm-database/server/model"
+	"github.com/horm-database/server/srv/codec"
+)
+
+// ConfigNotify 配置变更通知，管理平台在配置变更后调用，请求包体为 model.Notice 或其列表。开启变更通知通道时
+// 通知会发布到通道，由所有实例拉取变更的记录，否则只在本实例拉取。调用方必须在 admin_appids 中，
+// 且不论全局签名校验模式，签名（或证书、jwt）都强制校验，另需通过 ip 白名单
+func ConfigNotify(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (interface{}, error) {
+	release, err := admitAdmin(ctx, head, reqBuf)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if head.Compress == cc.Compression {
+		reqBuf, err = compress.Decompress(reqBuf)
+		if err != nil {
+			return nil, errs.Newf(errs.ErrServerDecompress, "config notice decompress error: %s", err.Error())
+		}
+	}
+
+	notices := []*model.Notice{}
+	if len(reqBuf) > 0 && reqBuf[0] == '[' {
+		err = codec.Deserialize(ctx, reqBuf, &notices)
+	} else {
+		notice := model.Notice{}
+		err = codec.Deserialize(ctx, reqBuf, &notice)
+		notices = append(notices, &notice)
+	}
+
+	if err != nil {
+		return nil, errs.Newf(errs.ErrServerDecode, "config notice codec unmarshal error: %s", err.Error())
+	}
+
+	err = model.Notify(ctx, notices)
+	if err != nil {
+		return nil, errs.Newf(consts.ErrConfigSync, "config notify error: %v", err)
+	}
+
+	return nil, nil
+}
+
+// admitAdmin 管理接口准入：强制签名校验及 admin appid 校验、ip 白名单、应用并发限制
+func admitAdmin(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (release func(), err error) {
+	if err = auth.AdminCheck(ctx, head, reqBuf); err != nil {
+		return nil, err
+	}
+
+	if err = auth.IPCheck(ctx, head); err != nil {
+		return nil, err
+	}
+
+	return limit.AcquireApp(ctx, head.Appid)
+}
@@ -17,22 +17,91 @@ package api
 import (
 	"context"
 
+	cc "github.com/horm-database/common/codec"
 	"github.com/horm-database/common/compress"
 	"github.com/horm-database/common/consts"
 	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log/logger"
 	"github.com/horm-database/common/proto"
 	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/limit"
 	"github.com/horm-database/server/logic"
+	"github.com/horm-database/server/model/table"
 	"github.com/horm-database/server/srv/codec"
 )
 
 // Query data query api
 func Query(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (interface{}, error) {
-	if !auth.SignSuccess(head) {
-		//return nil, errs.Newf(errs.ErrAuthFail, "signature failed")
+	ctx = pinSnapshot(ctx)
+
+	release, err := admit(ctx, head, reqBuf)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	units, err := decodeUnits(ctx, head, reqBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	return logic.Parse(ctx, head, units)
+}
+
+// Explain 解释请求，返回每个执行单元将要执行的语句，不实际执行
+func Explain(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (interface{}, error) {
+	ctx = pinSnapshot(ctx)
+
+	release, err := admit(ctx, head, reqBuf)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+
+	units, err := decodeUnits(ctx, head, reqBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	return logic.Explain(ctx, head, units)
+}
+
+// pinSnapshot 请求固定使用当前配置快照，认证、鉴权、路由、插件链均使用同一份配置，快照版本写入请求日志
+func pinSnapshot(ctx context.Context) context.Context {
+	ctx = table.WithSnapshot(ctx)
 
-	var err error
+	msg := cc.Message(ctx)
+	if l := msg.Logger(); l != nil {
+		msg.WithLogger(l.With(logger.Field{"config_version", table.Snap(ctx).Version}))
+	}
+
+	return ctx
+}
+
+// 准入控制，依次校验 ip 白名单、签名，之后执行应用维度限流，在解析请求包体之前尽早拒绝请求。
+// bearer token、客户端证书认证的 appid 来自 jwt、证书，需先认证再校验 ip 白名单。成功时返回的 release 需在请求结束时调用
+func admit(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (release func(), err error) {
+	if auth.IsBearer(head) || auth.IsCertAuth(ctx) {
+		err = auth.SignCheck(ctx, head, reqBuf)
+		if err == nil {
+			err = auth.IPCheck(ctx, head)
+		}
+	} else {
+		err = auth.IPCheck(ctx, head)
+		if err == nil {
+			err = auth.SignCheck(ctx, head, reqBuf)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return limit.AcquireApp(ctx, head.Appid)
+}
+
+// 解析请求包体，获取执行单元
+func decodeUnits(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (units []*proto.Unit, err error) {
 	if head.Compress == consts.Compression {
 		reqBuf, err = compress.Decompress(reqBuf)
 		if err != nil {
@@ -41,7 +110,7 @@ func Query(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (inter
 	}
 
 	// unmarshal request body
-	var units = []*proto.Unit{}
+	units = []*proto.Unit{}
 	if reqBuf[0] == '[' {
 		err = codec.Deserialize(ctx, reqBuf, &units)
 		if err == nil {
@@ -65,7 +134,7 @@ func Query(ctx context.Context, head *proto.RequestHeader, reqBuf []byte) (inter
 		return nil, errs.Newf(errs.ErrServerDecode, "request body codec unmarshal error: %s", err.Error())
 	}
 
-	return logic.Parse(ctx, head, units)
+	return units, nil
 }
 
 // 根据 units 获取 query mode.
@@ -0,0 +1,198 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit 写操作审计，记录每个写操作（新增、修改、删除、DDL 及原生写语句）的执行者、执行内容及结果，
+// 异步写入 tbl_db 中的审计表和/或本地滚动文件，审计记录只追加，不修改。
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/horm-database/common/codec"
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/proto"
+	pf "github.com/horm-database/common/proto/plugin"
+	"github.com/horm-database/orm/database/sql"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/consts"
+)
+
+const defaultBeforeImageLimit = 100
+
+var (
+	beforeImage      bool                      // 是否记录 update、delete 的前镜像
+	beforeImageLimit = defaultBeforeImageLimit // 前镜像最多记录的行数
+)
+
+// Entry 写操作审计记录
+type Entry struct {
+	Time      time.Time                `json:"time"`                   // 执行时间
+	Appid     uint64                   `json:"appid"`                  // 应用 appid
+	Caller    string                   `json:"caller,omitempty"`       // 调用方
+	TraceID   string                   `json:"trace_id,omitempty"`     // trace id
+	RequestID uint64                   `json:"request_id,omitempty"`   // 请求 id
+	IP        string                   `json:"ip,omitempty"`           // 客户端 ip
+	Path      string                   `json:"path"`                   // 执行单元路径
+	Op        string                   `json:"op"`                     // 操作
+	DB        string                   `json:"db"`                     // 库名
+	Tables    []string                 `json:"tables"`                 // 表
+	Where     map[string]interface{}   `json:"where,omitempty"`        // 引用替换、插件及行级过滤之后实际执行的条件
+	Data      map[string]interface{}   `json:"data,omitempty"`         // 写入数据
+	Datas     []map[string]interface{} `json:"datas,omitempty"`        // 批量写入数据
+	Key       string                   `json:"key,omitempty"`          // redis key
+	Field     string                   `json:"field,omitempty"`        // redis field
+	Val       interface{}              `json:"val,omitempty"`          // redis value
+	Query     string                   `json:"query,omitempty"`        // 原生语句
+	Args      []interface{}            `json:"args,omitempty"`         // 原生语句参数
+	Affected  int64                    `json:"affected"`               // 影响行数，-1 为未知
+	Before    interface{}              `json:"before_image,omitempty"` // update、delete 执行前匹配的数据
+	Error     string                   `json:"error,omitempty"`        // 执行失败原因
+}
+
+// SetBeforeImage 设置是否记录 update、delete 的前镜像，limit 为最多记录的行数，默认 100。
+// 前镜像在执行写操作之前以相同条件单独查询，仅支持 mysql、postgresql、clickhouse。事务中的写操作在同一事务中查询前镜像，
+// 前镜像查询不加锁，非事务的写操作在查询与写之间可能被并发修改，前镜像仅供参考
+func SetBeforeImage(enable bool, limit int) {
+	beforeImage = enable
+	if limit <= 0 {
+		limit = defaultBeforeImageLimit
+	}
+	beforeImageLimit = limit
+}
+
+// IsMutation 是否需要审计的写操作。sql 原生语句按语句内容判断，其他库（elastic 等）的原生查询体只有 find、find_all 视为读
+func IsMutation(op, query string, dbType int) bool {
+	switch cc.OpType(op) {
+	case cc.OpTypeAdd, cc.OpTypeMod, cc.OpTypeDel, cc.OpTypeCreate, cc.OpTypeDrop:
+		return true
+	}
+
+	if query == "" {
+		return false
+	}
+
+	if isSQL(dbType) {
+		return !auth.IsReadOnlySQL(query, dbType)
+	}
+
+	return op != cc.OpFind && op != cc.OpFindAll
+}
+
+// Begin 写操作执行前创建审计记录，未开启审计或者不是写操作时返回 nil。开启前镜像时查询 update、delete 将要修改的数据，
+// transInfo 为写操作所在事务，前镜像在同一事务中查询
+func Begin(ctx context.Context, appid uint64, node *obj.Tree, req *pf.Request, transInfo *obj.TransInfo) *Entry {
+	if !Enabled() {
+		return nil
+	}
+
+	db := node.GetDB()
+	if !IsMutation(req.Op, req.Query, db.Addr.Type) {
+		return nil
+	}
+
+	e := &Entry{
+		Time:     time.Now(),
+		Appid:    appid,
+		Path:     node.GetPath(),
+		Op:       req.Op,
+		DB:       db.Name,
+		Tables:   req.Tables,
+		Where:    req.Where,
+		Data:     req.Data,
+		Datas:    req.Datas,
+		Key:      req.Key,
+		Field:    req.Field,
+		Val:      req.Val,
+		Query:    req.Query,
+		Args:     req.Args,
+		Affected: -1,
+	}
+
+	if head, ok := codec.Message(ctx).ServerReqHead().(*proto.RequestHeader); ok && head != nil {
+		e.Caller = head.Caller
+		e.TraceID = head.TraceId
+		e.RequestID = head.RequestId
+		e.IP = head.Ip
+	}
+
+	if beforeImage && req.Query == "" && len(req.Tables) > 0 && len(req.Where) > 0 &&
+		(req.Op == cc.OpUpdate || req.Op == cc.OpDelete) && isSQL(db.Addr.Type) {
+		e.Before = queryBeforeImage(ctx, e, db, transInfo)
+	}
+
+	return e
+}
+
+// Finish 写操作执行后记录结果并异步写入审计，e 为 nil 时不处理
+func (e *Entry) Finish(ctx context.Context, result interface{}, err error) {
+	if e == nil {
+		return
+	}
+
+	if err != nil {
+		e.Error = errs.Msg(err)
+	} else {
+		e.Affected = affectedRows(result)
+	}
+
+	record(ctx, e)
+}
+
+// queryBeforeImage 以写操作相同的条件查询前镜像，查询失败时记录日志，不影响写操作
+func queryBeforeImage(ctx context.Context, e *Entry, db *obj.TblDB, transInfo *obj.TransInfo) interface{} {
+	query := sql.Query{
+		OP:        cc.OpFindAll,
+		Table:     e.Tables[0],
+		Where:     e.Where,
+		Size:      beforeImageLimit,
+		DB:        db,
+		Addr:      db.Addr,
+		TransInfo: transInfo,
+	}
+
+	ret, _, _, err := query.Query(ctx)
+	if err != nil {
+		log.Errorf(ctx, consts.ErrAudit, "audit [%s] query before image error: %v", e.Path, err)
+		return nil
+	}
+
+	return ret
+}
+
+func affectedRows(result interface{}) int64 {
+	switch ret := result.(type) {
+	case *proto.ModResult:
+		return ret.RowAffected
+	case proto.ModResult:
+		return ret.RowAffected
+	case []*proto.ModResult:
+		var affected int64
+		for _, v := range ret {
+			if v != nil {
+				affected += v.RowAffected
+			}
+		}
+		return affected
+	default:
+		return -1
+	}
+}
+
+func isSQL(dbType int) bool {
+	return dbType == cc.DBTypeMySQL || dbType == cc.DBTypePostgreSQL || dbType == cc.DBTypeClickHouse
+}
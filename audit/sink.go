@@ -0,0 +1,336 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/json"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+	"github.com/horm-database/orm/database/sql"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+	sc "github.com/horm-database/server/srv/codec"
+
+	"github.com/natefinch/lumberjack"
+)
+
+const (
+	defaultTable          = "tbl_audit_log"
+	defaultQueueSize      = 10000
+	defaultEnqueueTimeout = 100 // 队列满时写入队列的最长等待时间默认值（单位 ms）
+	batchSize             = 100
+	flushInterval         = time.Second
+)
+
+var (
+	storeName      string         // 审计表所在库名，写入时从当前快照获取库信息
+	storeTable     string         // 审计表
+	file           io.WriteCloser // 本地审计文件
+	queue          chan *Entry
+	enqueueTimeout time.Duration // 队列满时写入队列的最长等待时间
+	wg             sync.WaitGroup
+
+	closeLock sync.RWMutex // 写入队列时持有读锁，关闭队列时持有写锁
+	closed    bool         // 队列已关闭
+)
+
+// SinkConfig 审计记录写入配置，Store、File 均为空时不开启审计
+type SinkConfig struct {
+	Store          string // 审计表所在库，tbl_db 中的 mysql、postgresql、clickhouse 库名
+	Table          string // 审计表名，默认 tbl_audit_log
+	File           string // 本地审计文件
+	MaxSize        int    // 本地审计文件滚动大小（单位 MB），默认 100
+	MaxBackups     int    // 本地审计文件最多保留的滚动文件数，默认全部保留
+	QueueSize      int    // 异步写入队列大小，默认 10000
+	EnqueueTimeout int    // 队列满时写入队列的最长等待时间（单位 ms），默认 100
+}
+
+// SetSink 设置审计记录写入的审计表和/或本地文件，并启动异步写入协程，服务退出前需调用 Close 写入队列中剩余的记录
+func SetSink(conf *SinkConfig) error {
+	if conf.Store == "" && conf.File == "" {
+		return nil
+	}
+
+	if conf.Store != "" {
+		if getStore(table.Current(), conf.Store) == nil {
+			return errs.Newf(consts.ErrAudit,
+				"audit store [%s] is not a mysql, postgresql or clickhouse db in tbl_db", conf.Store)
+		}
+
+		storeName = conf.Store
+		storeTable = conf.Table
+		if storeTable == "" {
+			storeTable = defaultTable
+		}
+	}
+
+	if conf.File != "" {
+		file = &lumberjack.Logger{
+			Filename:   conf.File,
+			MaxSize:    conf.MaxSize,
+			MaxBackups: conf.MaxBackups,
+			LocalTime:  true,
+		}
+	}
+
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+
+	queue = make(chan *Entry, queueSize)
+
+	timeout := conf.EnqueueTimeout
+	if timeout <= 0 {
+		timeout = defaultEnqueueTimeout
+	}
+	enqueueTimeout = time.Duration(timeout) * time.Millisecond
+
+	wg.Add(1)
+	go run()
+
+	return nil
+}
+
+// Enabled 是否开启审计
+func Enabled() bool {
+	return queue != nil
+}
+
+// Close 停止接收审计记录，等待队列中的记录写入完成
+func Close() {
+	if queue == nil {
+		return
+	}
+
+	closeLock.Lock()
+	if closed {
+		closeLock.Unlock()
+		return
+	}
+	closed = true
+	close(queue)
+	closeLock.Unlock()
+
+	wg.Wait()
+
+	if file != nil {
+		_ = file.Close()
+	}
+}
+
+// record 审计记录写入队列，队列满时阻塞等待，最长等待 enqueueTimeout，写操作已执行，超时或服务退出后
+// 记录的完整内容输出到错误日志并告警，不丢失
+func record(ctx context.Context, e *Entry) {
+	closeLock.RLock()
+	defer closeLock.RUnlock()
+
+	if closed {
+		metrics.IncrCounter("AuditDrop", 1)
+		log.Errorf(ctx, consts.ErrAudit, "audit queue is closed, entry: %s", json.MarshalToString(e))
+		return
+	}
+
+	select {
+	case queue <- e:
+		return
+	default:
+	}
+
+	timer := time.NewTimer(enqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case queue <- e:
+	case <-timer.C:
+		metrics.IncrCounter("AuditDrop", 1)
+		log.Errorf(ctx, consts.ErrAudit, "audit queue is still full after %s, entry: %s",
+			enqueueTimeout, json.MarshalToString(e))
+	}
+}
+
+// run 异步批量写入审计记录
+func run() {
+	defer wg.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Entry, 0, batchSize)
+
+	for {
+		select {
+		case e, ok := <-queue:
+			if !ok {
+				write(batch)
+				return
+			}
+
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				write(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+func write(batch []*Entry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if file != nil {
+		writeFile(batch)
+	}
+
+	if storeName != "" {
+		writeStore(batch)
+	}
+}
+
+// writeFile 审计记录以 json 行追加写入本地文件
+func writeFile(batch []*Entry) {
+	var sb strings.Builder
+	for _, e := range batch {
+		sb.WriteString(json.MarshalToString(e))
+		sb.WriteByte('\n')
+	}
+
+	_, err := file.Write([]byte(sb.String()))
+	if err != nil {
+		metrics.IncrCounter("AuditWriteFail", 1)
+		log.Errorf(sc.GCtx, consts.ErrAudit, "audit write file error: %v", err)
+	}
+}
+
+// writeStore 审计记录批量插入审计表，失败时未写入本地文件的记录输出到错误日志，避免丢失
+func writeStore(batch []*Entry) {
+	err := insertStore(batch)
+	if err == nil {
+		return
+	}
+
+	metrics.IncrCounter("AuditWriteFail", 1)
+	log.Errorf(sc.GCtx, consts.ErrAudit, "audit insert into %s.%s error: %v", storeName, storeTable, err)
+
+	if file == nil {
+		for _, e := range batch {
+			log.Errorf(sc.GCtx, consts.ErrAudit, "audit entry: %s", json.MarshalToString(e))
+		}
+	}
+}
+
+// insertStore 批量插入审计表，写入协程不属于任何请求，从当前快照获取审计库
+func insertStore(batch []*Entry) error {
+	snap := table.Current()
+
+	db := getStore(snap, storeName)
+	if db == nil {
+		return fmt.Errorf("audit store is not a mysql, postgresql or clickhouse db in config version %d", snap.Version)
+	}
+
+	datas := make([]map[string]interface{}, len(batch))
+	for i, e := range batch {
+		datas[i] = storeRow(e)
+	}
+
+	query := sql.Query{
+		OP:    cc.OpInsert,
+		Table: storeTable,
+		Datas: datas,
+		DB:    db,
+		Addr:  db.Addr,
+	}
+
+	_, _, _, err := query.Query(sc.GCtx)
+	return err
+}
+
+// getStore 从快照获取审计表所在库，库不存在或不是 sql 库时返回 nil
+func getStore(snap *table.Snapshot, name string) *obj.TblDB {
+	db := snap.GetDBByName(name)
+	if db == nil || db.Addr == nil || !isSQL(db.Addr.Type) {
+		return nil
+	}
+
+	return db
+}
+
+func storeRow(e *Entry) map[string]interface{} {
+	row := map[string]interface{}{
+		"created_at": e.Time,
+		"appid":      e.Appid,
+		"caller":     e.Caller,
+		"trace_id":   e.TraceID,
+		"request_id": e.RequestID,
+		"ip":         e.IP,
+		"path":       e.Path,
+		"op":         e.Op,
+		"db":         e.DB,
+		"tables":     strings.Join(e.Tables, ","),
+		"query":      e.Query,
+		"affected":   e.Affected,
+		"error":      e.Error,
+	}
+
+	row["where_cond"] = jsonColumn(e.Where)
+	row["args"] = jsonColumn(e.Args)
+	row["before_image"] = jsonColumn(e.Before)
+
+	if len(e.Datas) > 0 {
+		row["data"] = jsonColumn(e.Datas)
+	} else if len(e.Data) > 0 {
+		row["data"] = jsonColumn(e.Data)
+	} else if e.Key != "" {
+		row["data"] = jsonColumn(map[string]interface{}{"key": e.Key, "field": e.Field, "val": e.Val})
+	} else {
+		row["data"] = ""
+	}
+
+	return row
+}
+
+func jsonColumn(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		if len(val) == 0 {
+			return ""
+		}
+	case []interface{}:
+		if len(val) == 0 {
+			return ""
+		}
+	}
+
+	return json.MarshalToString(v)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// bufferFile 内存审计文件
+type bufferFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *bufferFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+// setTestSink 审计记录写入内存文件，不启动写入协程
+func setTestSink(t *testing.T, queueSize int, timeout time.Duration) *bufferFile {
+	oldFile, oldQueue, oldTimeout, oldClosed, oldStore := file, queue, enqueueTimeout, closed, storeName
+	t.Cleanup(func() {
+		file, queue, enqueueTimeout, closed, storeName = oldFile, oldQueue, oldTimeout, oldClosed, oldStore
+	})
+
+	f := &bufferFile{}
+	file, queue, enqueueTimeout, closed, storeName = f, make(chan *Entry, queueSize), timeout, false, ""
+	return f
+}
+
+// 队列满时最长等待 enqueueTimeout，超时不阻塞请求
+func TestRecordTimeout(t *testing.T) {
+	setTestSink(t, 1, 50*time.Millisecond)
+	ctx := context.Background()
+
+	record(ctx, &Entry{Appid: 1})
+
+	start := time.Now()
+	record(ctx, &Entry{Appid: 2})
+
+	if elapsed := time.Since(start); elapsed < enqueueTimeout {
+		t.Errorf("record returned after %s, want waiting %s", elapsed, enqueueTimeout)
+	}
+
+	if len(queue) != 1 || (<-queue).Appid != 1 {
+		t.Error("queued entry is replaced")
+	}
+}
+
+// 队列满时，写入协程取走记录后等待中的记录写入队列
+func TestRecordWaitsForQueue(t *testing.T) {
+	setTestSink(t, 1, time.Second)
+	ctx := context.Background()
+
+	record(ctx, &Entry{Appid: 1})
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-queue
+	}()
+
+	record(ctx, &Entry{Appid: 2})
+
+	if len(queue) != 1 || (<-queue).Appid != 2 {
+		t.Error("waiting entry is not queued")
+	}
+}
+
+// Close 写入队列中剩余的记录，关闭后的记录不再写入队列
+func TestCloseFlushesQueue(t *testing.T) {
+	f := setTestSink(t, 10, 50*time.Millisecond)
+	ctx := context.Background()
+
+	wg.Add(1)
+	go run()
+
+	for i := 1; i <= 3; i++ {
+		record(ctx, &Entry{Appid: uint64(i)})
+	}
+
+	Close()
+
+	if lines := bytes.Count(f.Bytes(), []byte("\n")); lines != 3 || !f.closed {
+		t.Errorf("file has %d entries, closed=%v, want 3 entries and closed", lines, f.closed)
+	}
+
+	record(ctx, &Entry{Appid: 4}) // 队列已关闭，不能写入已关闭的 channel
+	Close()
+
+	if lines := bytes.Count(f.Bytes(), []byte("\n")); lines != 3 {
+		t.Errorf("file has %d entries after close, want 3", lines)
+	}
+}
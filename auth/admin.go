@@ -0,0 +1,49 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/server/consts"
+)
+
+var adminAppids = map[uint64]bool{} // 允许调用管理接口（如 ConfigNotify）的 appid
+
+// SetAdminAppids 设置允许调用管理接口的 appid，为空时拒绝所有管理接口调用
+func SetAdminAppids(appids []uint64) {
+	m := make(map[uint64]bool, len(appids))
+	for _, appid := range appids {
+		m[appid] = true
+	}
+
+	adminAppids = m
+}
+
+// AdminCheck 管理接口鉴权，不受全局签名校验模式影响，始终以 enforce 模式校验签名（或证书、jwt）及防重放，
+// 校验通过后 appid 还必须在 admin_appids 中
+func AdminCheck(ctx context.Context, head *proto.RequestHeader, body []byte) error {
+	if err := signCheck(ctx, head, body, ModeEnforce); err != nil {
+		return err
+	}
+
+	if !adminAppids[head.Appid] {
+		return errs.Newf(consts.ErrNotAdmin, "appid [%d] is not allowed to call admin api", head.Appid)
+	}
+
+	return nil
+}
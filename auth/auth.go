@@ -15,10 +15,12 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	cc "github.com/horm-database/common/consts"
 	"github.com/horm-database/common/errs"
@@ -27,17 +29,27 @@ import (
 	"github.com/horm-database/server/model/table"
 )
 
-// PermissionCheck 权限校验，appid 是否拥有对应的操作权限
-func PermissionCheck(source *obj.Tree, appid uint64, op, query string, isRecheck bool) error {
-	return nil
+// PermissionCheck 权限校验，appid 是否拥有对应的操作权限，校验模式见 SetPermissionMode
+func PermissionCheck(ctx context.Context, source *obj.Tree, appid uint64, op, query string, isRecheck bool) error {
+	if permissionMode == ModeOff {
+		return nil
+	}
+
+	err := permissionCheck(table.Snap(ctx), source, appid, op, query, isRecheck)
+	return modeHandle(ctx, permissionMode, "PermissionAuditDeny", err)
+}
+
+// permissionCheck 根据 AccessDB、AccessTable 规则校验权限
+func permissionCheck(snap *table.Snapshot, source *obj.Tree, appid uint64, op, query string, isRecheck bool) error {
 	//访问者信息
-	appInfo := table.GetAppInfo(appid)
+	appInfo := snap.GetAppInfo(appid)
 	if appInfo == nil {
 		return errs.Newf(errs.ErrAppidNotFound, "[%s] not find app info of appid %d", source.GetPath(), appid)
 	}
 
 	// 表信息
 	tblTable := source.GetTable()
+	now := time.Now()
 
 	// 库权限
 	acdb, _ := appInfo.AccessDB[tblTable.DB]
@@ -45,13 +57,13 @@ func PermissionCheck(source *obj.Tree, appid uint64, op, query string, isRecheck
 	dbOPs, _ := appInfo.DBOps[tblTable.DB]
 
 	// 库超级权限
-	if acdb != nil && acdb.Status == consts.AuthStatusNormal && acdb.Root == consts.DBRootAll {
+	if dbGranted(acdb, now) && acdb.Root == consts.DBRootAll {
 		return nil
 	}
 
 	// DDL 必须拥有库级别权限
 	if op == cc.OpCreate || op == cc.OpDrop {
-		if supportOp(dbOPs, op) {
+		if dbGranted(acdb, now) && supportOp(dbOPs, op) {
 			return nil
 		}
 
@@ -59,25 +71,24 @@ func PermissionCheck(source *obj.Tree, appid uint64, op, query string, isRecheck
 			source.GetPath(), recheck(isRecheck), appid, op, source.GetName())
 	}
 
-	// 直接查询 query 语句，必须拥有库的数据权限或者表的 query_all 权限
+	// 直接查询 query 语句，拥有库的数据权限或者表的 query_all 权限时不限制，否则根据语句类型及访问的表校验
 	if query != "" {
-		if (acdb != nil && acdb.Status == consts.AuthStatusNormal && acdb.Root == consts.DBRootTableData) ||
-			(actb != nil && actb.Status == consts.AuthStatusNormal && actb.QueryAll == consts.TableQueryAllTrue) {
+		if (dbGranted(acdb, now) && acdb.Root == consts.DBRootTableData) ||
+			(tableGranted(actb, now) && actb.QueryAll == consts.TableQueryAllTrue) {
 			return nil
 		}
 
-		return errs.Newf(errs.ErrHasNoDBRight, "[%s]%s appid(%d) has no permission to query %s directly",
-			source.GetPath(), recheck(isRecheck), appid, source.GetName())
+		return rawQueryCheck(snap, source, appInfo, appid, op, query, isRecheck, now)
 	}
 
 	// 库权限
-	if acdb != nil && acdb.Status == consts.AuthStatusNormal &&
+	if dbGranted(acdb, now) &&
 		(acdb.Root == consts.DBRootTableData || supportOp(dbOPs, op)) {
 		return nil
 	}
 
 	// 表权限状态
-	if actb != nil && actb.Status == consts.AuthStatusNormal {
+	if tableGranted(actb, now) {
 		if actb.QueryAll == consts.TableQueryAllTrue { //拥有表 query_all 权限
 			return nil
 		} else {
@@ -0,0 +1,55 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+
+	"github.com/horm-database/common/codec"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/server/model/table"
+	"github.com/horm-database/server/srv/transport"
+)
+
+// IsCertAuth 是否客户端证书认证，请求来自双向 tls 连接，且客户端证书 subject 映射到应用（tbl_app_info.cert_subject）
+func IsCertAuth(ctx context.Context) bool {
+	return certAppid(ctx) != 0
+}
+
+// certCheck 客户端证书认证，将证书对应的 appid 写入请求头。请求头中已有 appid 时必须与证书一致
+func certCheck(head *proto.RequestHeader, appid uint64) error {
+	if head.Appid != 0 && head.Appid != appid {
+		return errs.Newf(errs.ErrAuthFail, "appid [%d] is not match client certificate appid [%d]", head.Appid, appid)
+	}
+
+	head.Appid = appid
+	return nil
+}
+
+// certAppid 客户端证书对应的 appid，证书已在 tls 握手时由 ca_cert 校验，非双向 tls 连接或未映射到应用时返回 0
+func certAppid(ctx context.Context) uint64 {
+	pc, ok := codec.Message(ctx).FrameCodec().(transport.PeerCertifier)
+	if !ok {
+		return 0
+	}
+
+	cert := pc.PeerCertificate()
+	if cert == nil {
+		return 0
+	}
+
+	return table.Snap(ctx).GetAppidByCert(cert.Subject.String(), cert.Subject.CommonName)
+}
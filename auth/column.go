@@ -0,0 +1,277 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strings"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	pf "github.com/horm-database/common/proto/plugin"
+	"github.com/horm-database/common/util"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/model/table"
+)
+
+var columnRegexp = regexp.MustCompile("^`?([A-Za-z_][A-Za-z0-9_]*)`?$")
+
+// ColumnCheck 列权限校验，校验经插件处理之后最终请求的查询列、条件列（where、having、group、order）、写入列。
+// 查询 * 时展开为有权限的列；越权的查询列、写入列根据应用的列权限策略拒绝请求或剔除（仅 enforce 模式剔除）；
+// 越权的条件列会改变查询语义，始终拒绝。原生 query 语句无法解析列，由 query_all 权限控制。
+func ColumnCheck(ctx context.Context, source *obj.Tree, appid uint64, req *pf.Request) error {
+	if permissionMode == ModeOff || req.Query != "" {
+		return nil
+	}
+
+	policy := table.Snap(ctx).GetColumnPolicy(appid, source.GetTable().Id)
+	if policy == nil {
+		return nil
+	}
+
+	err := columnCheck(source, appid, req, policy, permissionMode == ModeEnforce)
+	return modeHandle(ctx, permissionMode, "PermissionAuditDeny", err)
+}
+
+// ColumnFilter 返回剔除了应用无权查询列的结果，仅 enforce 模式生效。
+// 结果可能来自插件（如缓存），不修改原结果，而是返回过滤后的副本
+func ColumnFilter(ctx context.Context, source *obj.Tree, appid uint64, result interface{}) interface{} {
+	if permissionMode != ModeEnforce || result == nil {
+		return result
+	}
+
+	policy := table.Snap(ctx).GetColumnPolicy(appid, source.GetTable().Id)
+	if policy == nil || len(policy.Read) == 0 {
+		return result
+	}
+
+	return filterResult(reflect.ValueOf(result), policy.Read).Interface()
+}
+
+// columnCheck enforce 为 false（audit 模式）时仅校验，不修改请求
+func columnCheck(source *obj.Tree, appid uint64, req *pf.Request, policy *table.ColumnPolicy, enforce bool) error {
+	dbType := source.GetDB().Addr.Type
+	isElastic := dbType == cc.DBTypeElastic
+	strip := enforce && policy.Strip
+
+	if len(policy.Read) > 0 {
+		column, denied := selectColumns(req.Column, policy.Read)
+		if len(denied) > 0 && !strip {
+			return columnError(source, appid, "select", denied)
+		}
+
+		if len(column) == 0 {
+			return columnError(source, appid, "select", req.Column)
+		}
+
+		if enforce {
+			req.Column = column
+		}
+
+		var conds []string
+		whereColumns(dbType, isElastic, req.Where, &conds)
+		whereColumns(dbType, isElastic, req.Having, &conds)
+		conds = append(conds, req.Group...)
+		for _, order := range util.FormatOrders(req.Order) {
+			conds = append(conds, order.Field)
+		}
+
+		if denied = deniedColumns(conds, policy.Read); len(denied) > 0 {
+			return columnError(source, appid, "filter on", denied)
+		}
+	}
+
+	if len(policy.Write) > 0 {
+		data, denied := dataColumns(req.Data, policy.Write, strip)
+
+		var datas []map[string]interface{}
+		if len(req.Datas) > 0 {
+			datas = make([]map[string]interface{}, len(req.Datas))
+		}
+
+		for i, v := range req.Datas {
+			var d []string
+			datas[i], d = dataColumns(v, policy.Write, strip)
+			denied = append(denied, d...)
+		}
+
+		if len(denied) > 0 && !strip {
+			return columnError(source, appid, "write", denied)
+		}
+
+		req.Data, req.Datas = data, datas
+	}
+
+	return nil
+}
+
+// selectColumns 校验查询列，返回有权限的查询列及越权的列。不指定查询列或查询 * 时，展开为所有有权限的列，
+// 无法识别列名的表达式（比如函数）视为越权。
+func selectColumns(column []string, allowed map[string]bool) (ret, denied []string) {
+	if len(column) == 0 {
+		column = []string{"*"}
+	}
+
+	for _, c := range column {
+		name := columnName(c)
+		if name == "*" {
+			for k := range allowed {
+				ret = append(ret, k)
+			}
+		} else if allowed[name] {
+			ret = append(ret, c)
+		} else {
+			denied = append(denied, c)
+		}
+	}
+
+	return
+}
+
+// whereColumns 获取条件中的所有列
+func whereColumns(dbType int, isElastic bool, where map[string]interface{}, columns *[]string) {
+	for k, v := range where {
+		rv := reflect.ValueOf(v)
+		isRelation, isSliceAndOR, _ := util.GetRelation(dbType, k, rv)
+		if isRelation {
+			if isSliceAndOR {
+				for i := 0; i < rv.Len(); i++ {
+					if sub, ok := rv.Index(i).Interface().(map[string]interface{}); ok {
+						whereColumns(dbType, isElastic, sub, columns)
+					}
+				}
+			} else if sub, ok := v.(map[string]interface{}); ok {
+				whereColumns(dbType, isElastic, sub, columns)
+			}
+			continue
+		}
+
+		column, _, _, _, _, _, _ := util.OperatorMatch(k, isElastic)
+		*columns = append(*columns, column)
+	}
+}
+
+// dataColumns 校验写入列，返回剔除越权列之后的数据及越权的列。strip 为 true 时剔除越权的列，
+// 剔除时复制数据，不修改执行单元中的原始数据（重试、解释、审计仍需使用）
+func dataColumns(data map[string]interface{}, allowed map[string]bool,
+	strip bool) (ret map[string]interface{}, denied []string) {
+	for k := range data {
+		if !allowed[columnName(k)] {
+			denied = append(denied, k)
+		}
+	}
+
+	if !strip || len(denied) == 0 {
+		return data, denied
+	}
+
+	ret = make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if allowed[columnName(k)] {
+			ret[k] = v
+		}
+	}
+
+	return ret, denied
+}
+
+func deniedColumns(columns []string, allowed map[string]bool) (denied []string) {
+	for _, c := range columns {
+		if !allowed[columnName(c)] {
+			denied = append(denied, c)
+		}
+	}
+
+	return
+}
+
+// filterResult 返回剔除无权查询列后的结果副本，结果可能是 map[string]interface{}、types.Map 等以字符串为 key 的 map（单行），
+// 或者它们的切片（多行），通过反射处理各种具名类型，其它类型的值原样返回
+func filterResult(rv reflect.Value, allowed map[string]bool) reflect.Value {
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.IsNil() {
+			return rv
+		}
+		return filterResult(rv.Elem(), allowed)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return rv
+		}
+		ret := reflect.New(rv.Elem().Type())
+		ret.Elem().Set(filterResult(rv.Elem(), allowed))
+		return ret
+	case reflect.Map:
+		if rv.IsNil() || rv.Type().Key().Kind() != reflect.String {
+			return rv
+		}
+
+		ret := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			if allowed[iter.Key().String()] {
+				ret.SetMapIndex(iter.Key(), iter.Value())
+			}
+		}
+		return ret
+	case reflect.Slice:
+		if rv.IsNil() {
+			return rv
+		}
+
+		ret := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ret.Index(i).Set(filterResult(rv.Index(i), allowed))
+		}
+		return ret
+	case reflect.Array:
+		ret := reflect.New(rv.Type()).Elem()
+		for i := 0; i < rv.Len(); i++ {
+			ret.Index(i).Set(filterResult(rv.Index(i), allowed))
+		}
+		return ret
+	}
+
+	return rv
+}
+
+// columnName 获取列名，去掉表别名前缀、反引号，无法识别的表达式返回空串
+func columnName(column string) string {
+	column = strings.TrimSpace(util.RemoveComments(column))
+	if column == "*" {
+		return column
+	}
+
+	if index := strings.LastIndex(column, "."); index != -1 {
+		column = column[index+1:]
+		if column == "*" {
+			return column
+		}
+	}
+
+	matches := columnRegexp.FindStringSubmatch(column)
+	if len(matches) != 2 {
+		return ""
+	}
+
+	return matches[1]
+}
+
+func columnError(source *obj.Tree, appid uint64, action string, columns []string) error {
+	return errs.Newf(errs.ErrHasNoTableRight, "[%s] appid [%d] has no permission to %s column [%s] of table %s",
+		source.GetPath(), appid, action, strings.Join(columns, ","), source.GetName())
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+const defaultGrantWarnWindow = 72 // 默认授权过期预警时间（单位 小时）
+
+var grantWarnWindow = defaultGrantWarnWindow * time.Hour // 授权过期预警时间
+
+// SetGrantWarnWindow 设置授权过期预警时间（单位 小时），授权在该时间内过期时 GrantExpireWarn 会告警
+func SetGrantWarnWindow(hours int) {
+	if hours <= 0 {
+		hours = defaultGrantWarnWindow
+	}
+
+	grantWarnWindow = time.Duration(hours) * time.Hour
+}
+
+// GrantExpireWarn 即将过期的库、表授权告警，需定时执行
+func GrantExpireWarn(ctx context.Context) {
+	now := time.Now()
+	accessDBs, accessTables := table.Current().GetExpiringGrants(now, grantWarnWindow) // 定时任务不属于请求，使用当前快照
+
+	for _, accessDB := range accessDBs {
+		log.Warnf(ctx, "appid [%d] grant of db [%d] will expire at %s",
+			accessDB.Appid, accessDB.DB, accessDB.ExpireAt.Format("2006-01-02 15:04:05"))
+	}
+
+	for _, accessTable := range accessTables {
+		log.Warnf(ctx, "appid [%d] grant of table [%d] will expire at %s",
+			accessTable.Appid, accessTable.TableId, accessTable.ExpireAt.Format("2006-01-02 15:04:05"))
+	}
+
+	if num := len(accessDBs) + len(accessTables); num > 0 {
+		metrics.IncrCounter("GrantExpiring", float64(num))
+	}
+}
+
+// dbGranted 库授权是否有效，状态正常且在授权有效期内
+func dbGranted(acdb *table.TblAccessDB, now time.Time) bool {
+	return acdb != nil && grantValid(acdb.Status, acdb.StartAt, acdb.ExpireAt, now)
+}
+
+// tableGranted 表授权是否有效，状态正常且在授权有效期内
+func tableGranted(actb *table.TblAccessTable, now time.Time) bool {
+	return actb != nil && grantValid(actb.Status, actb.StartAt, actb.ExpireAt, now)
+}
+
+func grantValid(status int8, startAt, expireAt, now time.Time) bool {
+	if status != consts.AuthStatusNormal {
+		return false
+	}
+
+	if !startAt.IsZero() && now.Before(startAt) {
+		return false
+	}
+
+	if !expireAt.IsZero() && !now.Before(expireAt) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"net"
+
+	"github.com/horm-database/common/codec"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+// IPCheck 应用 ip 白名单校验，在签名校验之前执行。ip 为连接的远端地址，未配置白名单的应用不限制。
+// ip 白名单为安全基线要求，不受校验模式影响，配置即生效。
+func IPCheck(ctx context.Context, head *proto.RequestHeader) error {
+	appAllow, _ := table.Snap(ctx).GetAllowIP(head.Appid, 0)
+	if appAllow == nil {
+		return nil
+	}
+
+	if ipAllowed(head.Ip, appAllow) {
+		return nil
+	}
+
+	return ipDenied(ctx, head.Appid, head.Ip, "")
+}
+
+// TableIPCheck 应用对表的 ip 白名单校验（tbl_access_table.allow_ip），未配置白名单的表不限制
+func TableIPCheck(ctx context.Context, source *obj.Tree, appid uint64) error {
+	_, tableAllow := table.Snap(ctx).GetAllowIP(appid, source.GetTable().Id)
+	if tableAllow == nil {
+		return nil
+	}
+
+	ip := requestIP(ctx)
+	if ipAllowed(ip, tableAllow) {
+		return nil
+	}
+
+	return ipDenied(ctx, appid, ip, source.GetName())
+}
+
+func ipAllowed(ip string, allow table.IPAllowlist) bool {
+	clientIP := net.ParseIP(ip)
+	if clientIP == nil {
+		return false
+	}
+
+	return allow.Contains(clientIP)
+}
+
+// requestIP 获取请求的远端 ip
+func requestIP(ctx context.Context) string {
+	head, ok := codec.Message(ctx).ServerReqHead().(*proto.RequestHeader)
+	if !ok || head == nil {
+		return ""
+	}
+
+	return head.Ip
+}
+
+func ipDenied(ctx context.Context, appid uint64, ip, tableName string) error {
+	metrics.IncrCounter("IPNotAllowed", 1)
+
+	if tableName == "" {
+		log.Warnf(ctx, "appid [%d] remote ip [%s] is not in allow ip list", appid, ip)
+		return errs.Newf(consts.ErrIPNotAllowed, "appid [%d] remote ip [%s] is not allowed", appid, ip)
+	}
+
+	log.Warnf(ctx, "appid [%d] remote ip [%s] is not in allow ip list of table %s", appid, ip, tableName)
+	return errs.Newf(consts.ErrIPNotAllowed, "appid [%d] remote ip [%s] is not allowed to access table %s",
+		appid, ip, tableName)
+}
@@ -0,0 +1,330 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	stdjson "encoding/json"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/json"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+const (
+	jwtLeeway          = 60 * time.Second // exp、nbf 允许的时钟偏差
+	defaultAppidClaim  = "appid"          // 默认 appid 对应的 claim
+	jwtAlgHS256        = "HS256"
+	jwtAlgRS256        = "RS256"
+	jwkKeyTypeOct      = "oct"
+	jwkKeyTypeRSA      = "RSA"
+	bearerAuthorizeLen = len(consts.SignPrefixBearer)
+)
+
+var jwtConf *jwtConfig // jwt 配置，为 nil 时不支持 jwt 认证
+
+type jwtConfig struct {
+	keys       []*jwk
+	appidClaim string
+	issuer     string
+	audience   string
+}
+
+// jwk JSON Web Key，支持 oct（HS256）、RSA（RS256）
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+
+	secret []byte
+	pubKey *rsa.PublicKey
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// SetJWTConfig 设置 jwt 认证配置，jwksFile 为本地 JWKS 文件，为空时不支持 jwt 认证；appidClaim 为 appid 对应的 claim，
+// 默认 appid；issuer、audience 不为空时校验 iss、aud
+func SetJWTConfig(jwksFile, appidClaim, issuer, audience string) error {
+	if jwksFile == "" {
+		jwtConf = nil
+		return nil
+	}
+
+	buf, err := os.ReadFile(jwksFile)
+	if err != nil {
+		return errs.Newf(errs.ErrAuthFail, "read jwks file %s error: %v", jwksFile, err)
+	}
+
+	jwks := struct {
+		Keys []*jwk `json:"keys"`
+	}{}
+
+	err = json.Api.Unmarshal(buf, &jwks)
+	if err != nil {
+		return errs.Newf(errs.ErrAuthFail, "unmarshal jwks file %s error: %v", jwksFile, err)
+	}
+
+	for _, key := range jwks.Keys {
+		err = key.init()
+		if err != nil {
+			return errs.Newf(errs.ErrAuthFail, "jwks file %s key [%s] is invalid: %v", jwksFile, key.Kid, err)
+		}
+	}
+
+	if appidClaim == "" {
+		appidClaim = defaultAppidClaim
+	}
+
+	jwtConf = &jwtConfig{
+		keys:       jwks.Keys,
+		appidClaim: appidClaim,
+		issuer:     issuer,
+		audience:   audience,
+	}
+
+	return nil
+}
+
+// IsBearer 是否 http bearer token 认证，token 由 http 编解码器从 Authorization 头写入 sign
+func IsBearer(head *proto.RequestHeader) bool {
+	return strings.HasPrefix(head.Sign, consts.SignPrefixBearer)
+}
+
+// jwtCheck 校验 jwt，成功时将 claim 中的 appid 写入请求头。请求头中已有 appid 时必须与 claim 一致
+func jwtCheck(ctx context.Context, head *proto.RequestHeader) error {
+	if head.RequestType != cc.RequestTypeHTTP {
+		return errs.Newf(errs.ErrAuthFail, "bearer token is only supported by http")
+	}
+
+	if jwtConf == nil {
+		return errs.Newf(errs.ErrAuthFail, "bearer token is not supported")
+	}
+
+	claims, err := jwtVerify(head.Sign[bearerAuthorizeLen:], time.Now())
+	if err != nil {
+		return errs.Newf(errs.ErrAuthFail, "bearer token is invalid: %v", err)
+	}
+
+	appid, err := claimAppid(claims[jwtConf.appidClaim])
+	if err != nil {
+		return errs.Newf(errs.ErrAuthFail, "bearer token claim %s is invalid: %v", jwtConf.appidClaim, err)
+	}
+
+	if head.Appid != 0 && head.Appid != appid {
+		return errs.Newf(errs.ErrAuthFail, "appid [%d] is not match bearer token appid [%d]", head.Appid, appid)
+	}
+
+	if table.Snap(ctx).GetAppInfo(appid) == nil {
+		return errs.Newf(errs.ErrAppidNotFound, "not find app info of bearer token appid %d", appid)
+	}
+
+	head.Appid = appid
+	return nil
+}
+
+// jwtVerify 校验 jwt 签名及 exp、nbf、iss、aud，返回 claims
+func jwtVerify(token string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errs.Newf(errs.ErrAuthFail, "malformed token")
+	}
+
+	headerBuf, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errs.Newf(errs.ErrAuthFail, "decode header error: %v", err)
+	}
+
+	header := jwtHeader{}
+	if err = json.Api.Unmarshal(headerBuf, &header); err != nil {
+		return nil, errs.Newf(errs.ErrAuthFail, "unmarshal header error: %v", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errs.Newf(errs.ErrAuthFail, "decode signature error: %v", err)
+	}
+
+	if !jwtSignSuccess(header, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, errs.Newf(errs.ErrAuthFail, "signature verify failed, alg=%s, kid=%s", header.Alg, header.Kid)
+	}
+
+	claimsBuf, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errs.Newf(errs.ErrAuthFail, "decode claims error: %v", err)
+	}
+
+	// json.Api 开启了 UseNumber，数值 claim 解析为 json.Number，不经过 float64，appid 等大整数不丢失精度
+	claims := map[string]interface{}{}
+	if err = json.Api.Unmarshal(claimsBuf, &claims); err != nil {
+		return nil, errs.Newf(errs.ErrAuthFail, "unmarshal claims error: %v", err)
+	}
+
+	exp, ok := claimTime(claims["exp"])
+	if !ok {
+		return nil, errs.Newf(errs.ErrAuthFail, "claim exp is required")
+	}
+
+	if now.After(exp.Add(jwtLeeway)) {
+		return nil, errs.Newf(errs.ErrAuthFail, "token is expired at %s", exp.Format("2006-01-02 15:04:05"))
+	}
+
+	if nbf, ok := claimTime(claims["nbf"]); ok && now.Add(jwtLeeway).Before(nbf) {
+		return nil, errs.Newf(errs.ErrAuthFail, "token is not valid before %s", nbf.Format("2006-01-02 15:04:05"))
+	}
+
+	if jwtConf.issuer != "" && claims["iss"] != jwtConf.issuer {
+		return nil, errs.Newf(errs.ErrAuthFail, "issuer %v is not allowed", claims["iss"])
+	}
+
+	if jwtConf.audience != "" && !claimAudience(claims["aud"], jwtConf.audience) {
+		return nil, errs.Newf(errs.ErrAuthFail, "audience %v is not allowed", claims["aud"])
+	}
+
+	return claims, nil
+}
+
+// jwtSignSuccess 使用 kid 对应的秘钥校验签名，未指定 kid 时依次尝试所有同类型的秘钥，不支持 none 等其他算法
+func jwtSignSuccess(header jwtHeader, content, sig []byte) bool {
+	if header.Alg != jwtAlgHS256 && header.Alg != jwtAlgRS256 {
+		return false
+	}
+
+	hash := sha256.Sum256(content)
+
+	for _, key := range jwtConf.keys {
+		if header.Kid != "" && key.Kid != header.Kid {
+			continue
+		}
+
+		if key.Alg != "" && key.Alg != header.Alg {
+			continue
+		}
+
+		switch {
+		case header.Alg == jwtAlgHS256 && key.secret != nil:
+			mac := hmac.New(sha256.New, key.secret)
+			mac.Write(content)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return true
+			}
+		case header.Alg == jwtAlgRS256 && key.pubKey != nil:
+			if rsa.VerifyPKCS1v15(key.pubKey, crypto.SHA256, hash[:], sig) == nil {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (k *jwk) init() error {
+	switch k.Kty {
+	case jwkKeyTypeOct:
+		secret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.K, "="))
+		if err != nil || len(secret) == 0 {
+			return errs.Newf(errs.ErrAuthFail, "invalid oct key k")
+		}
+		k.secret = secret
+	case jwkKeyTypeRSA:
+		n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.N, "="))
+		if err != nil || len(n) == 0 {
+			return errs.Newf(errs.ErrAuthFail, "invalid rsa key n")
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.E, "="))
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return errs.Newf(errs.ErrAuthFail, "invalid rsa key e")
+		}
+
+		k.pubKey = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	default:
+		return errs.Newf(errs.ErrAuthFail, "unsupported key type %s", k.Kty)
+	}
+
+	return nil
+}
+
+func claimAppid(v interface{}) (uint64, error) {
+	var appid uint64
+	var err error
+
+	switch val := v.(type) {
+	case nil:
+		return 0, errs.Newf(errs.ErrAuthFail, "claim is missing")
+	case stdjson.Number: // 按十进制无符号整数解析，不接受小数、科学计数法
+		appid, err = strconv.ParseUint(string(val), 10, 64)
+	case string:
+		appid, err = strconv.ParseUint(val, 10, 64)
+	default:
+		err = errs.Newf(errs.ErrAuthFail, "type %T is not supported", v)
+	}
+
+	if err != nil || appid == 0 {
+		return 0, errs.Newf(errs.ErrAuthFail, "invalid appid %v", v)
+	}
+
+	return appid, nil
+}
+
+func claimTime(v interface{}) (time.Time, bool) {
+	if v == nil {
+		return time.Time{}, false
+	}
+
+	sec, err := types.InterfaceToInt64(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(sec, 0), true
+}
+
+func claimAudience(v interface{}, audience string) bool {
+	switch val := v.(type) {
+	case string:
+		return val == audience
+	case []interface{}:
+		for _, aud := range val {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
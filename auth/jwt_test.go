@@ -0,0 +1,162 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	stdjson "encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+var jwtTestSecret = []byte("jwt-test-secret")
+
+// setTestJWT 使用只包含一个 HS256 秘钥的 JWKS 文件设置 jwt 配置
+func setTestJWT(t *testing.T, issuer, audience string) {
+	old := jwtConf
+	t.Cleanup(func() { jwtConf = old })
+
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"oct","kid":"k1","alg":"HS256","k":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(jwtTestSecret))
+
+	file := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(file, []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetJWTConfig(file, "", issuer, audience); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signJWT(header, claims string, secret []byte) string {
+	content := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(claims))
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(content))
+
+	return content + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerify(t *testing.T) {
+	setTestJWT(t, "horm", "server")
+
+	now := time.Now()
+	exp := now.Add(time.Hour).Unix()
+	header := `{"alg":"HS256","kid":"k1"}`
+
+	claims := func(extra string) string {
+		return fmt.Sprintf(`{"appid":1,"iss":"horm","aud":"server","exp":%d%s}`, exp, extra)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"valid", signJWT(header, claims(""), jwtTestSecret), true},
+		{"audience list", signJWT(header, fmt.Sprintf(`{"iss":"horm","aud":["web","server"],"exp":%d}`, exp), jwtTestSecret), true},
+		{"expired within leeway", signJWT(header, fmt.Sprintf(`{"iss":"horm","aud":"server","exp":%d}`, now.Add(-30*time.Second).Unix()), jwtTestSecret), true},
+		{"expired", signJWT(header, fmt.Sprintf(`{"iss":"horm","aud":"server","exp":%d}`, now.Add(-2*time.Minute).Unix()), jwtTestSecret), false},
+		{"not before", signJWT(header, claims(fmt.Sprintf(`,"nbf":%d`, now.Add(2*time.Minute).Unix())), jwtTestSecret), false},
+		{"missing exp", signJWT(header, `{"iss":"horm","aud":"server"}`, jwtTestSecret), false},
+		{"wrong issuer", signJWT(header, fmt.Sprintf(`{"iss":"other","aud":"server","exp":%d}`, exp), jwtTestSecret), false},
+		{"wrong audience", signJWT(header, fmt.Sprintf(`{"iss":"horm","aud":["web"],"exp":%d}`, exp), jwtTestSecret), false},
+		{"wrong secret", signJWT(header, claims(""), []byte("other-secret")), false},
+		{"unknown kid", signJWT(`{"alg":"HS256","kid":"k2"}`, claims(""), jwtTestSecret), false},
+		{"alg none", signJWT(`{"alg":"none"}`, claims(""), jwtTestSecret), false},
+		{"alg RS256 with hmac", signJWT(`{"alg":"RS256","kid":"k1"}`, claims(""), jwtTestSecret), false},
+		{"malformed", "a.b", false},
+	}
+
+	for _, c := range cases {
+		_, err := jwtVerify(c.token, now)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: err=%v, want ok=%v", c.name, err, c.ok)
+		}
+	}
+}
+
+func TestClaimAppid(t *testing.T) {
+	cases := []struct {
+		claim interface{}
+		appid uint64
+	}{
+		{stdjson.Number("18446744073709551615"), 18446744073709551615},
+		{stdjson.Number("42"), 42},
+		{"42", 42},
+		{stdjson.Number("1.5"), 0},
+		{stdjson.Number("1e3"), 0},
+		{stdjson.Number("-1"), 0},
+		{stdjson.Number("0"), 0},
+		{float64(42), 0},
+		{nil, 0},
+	}
+
+	for _, c := range cases {
+		appid, err := claimAppid(c.claim)
+		if appid != c.appid || (err == nil) != (c.appid != 0) {
+			t.Errorf("claim %v(%T): appid=%d, err=%v, want %d", c.claim, c.claim, appid, err, c.appid)
+		}
+	}
+}
+
+func TestJWTCheck(t *testing.T) {
+	setTestJWT(t, "", "")
+
+	const appid = 800001
+	table.UpdateDBInfo(&table.ConfigRows{
+		AppInfos: []*table.TblAppInfo{{Appid: appid, Name: "jwt", Status: consts.AppStatusNormal}},
+	}, nil)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	token := consts.SignPrefixBearer + signJWT(`{"alg":"HS256"}`, fmt.Sprintf(`{"appid":%d,"exp":%d}`, appid, exp), jwtTestSecret)
+	unknown := consts.SignPrefixBearer + signJWT(`{"alg":"HS256"}`, fmt.Sprintf(`{"appid":%d,"exp":%d}`, appid+1, exp), jwtTestSecret)
+
+	cases := []struct {
+		name string
+		head *proto.RequestHeader
+		ok   bool
+	}{
+		{"http", &proto.RequestHeader{RequestType: cc.RequestTypeHTTP, Sign: token}, true},
+		{"same appid", &proto.RequestHeader{RequestType: cc.RequestTypeHTTP, Appid: appid, Sign: token}, true},
+		{"different appid", &proto.RequestHeader{RequestType: cc.RequestTypeHTTP, Appid: appid + 1, Sign: token}, false},
+		{"unknown app", &proto.RequestHeader{RequestType: cc.RequestTypeHTTP, Sign: unknown}, false},
+		{"rpc", &proto.RequestHeader{RequestType: cc.RequestTypeRPC, Sign: token}, false},
+	}
+
+	for _, c := range cases {
+		err := jwtCheck(context.Background(), c.head)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: err=%v, want ok=%v", c.name, err, c.ok)
+		}
+
+		if err == nil && c.head.Appid != appid {
+			t.Errorf("%s: head appid=%d, want %d", c.name, c.head.Appid, appid)
+		}
+	}
+}
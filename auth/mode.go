@@ -0,0 +1,74 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+)
+
+const ( // 校验模式
+	ModeOff     = "off"     // 不校验
+	ModeAudit   = "audit"   // 审计，校验不通过仅记录日志、上报监控，不拒绝请求
+	ModeEnforce = "enforce" // 强制，校验不通过拒绝请求
+)
+
+var (
+	signMode       = ModeOff // 签名校验模式
+	permissionMode = ModeOff // 库表权限校验模式
+)
+
+// SetSignMode 设置签名校验模式，为空时为 off，未知模式返回错误
+func SetSignMode(mode string) (err error) {
+	signMode, err = ParseMode(mode)
+	return err
+}
+
+// SetPermissionMode 设置库表权限校验模式，为空时为 off，未知模式返回错误
+func SetPermissionMode(mode string) (err error) {
+	permissionMode, err = ParseMode(mode)
+	return err
+}
+
+// ParseMode 解析校验模式，为空时为 off。安全配置拼写错误时不能静默当作 off 处理，未知模式返回错误
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return ModeOff, nil
+	case ModeOff, ModeAudit, ModeEnforce:
+		return mode, nil
+	default:
+		return ModeOff, fmt.Errorf("unknown check mode [%s], should be off, audit or enforce", mode)
+	}
+}
+
+// modeHandle 根据校验模式处理校验失败，audit 模式仅记录日志、上报监控，enforce 模式返回错误
+func modeHandle(ctx context.Context, mode, metricsName string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if mode == ModeAudit {
+		log.Warnf(ctx, "[auth audit] request would be denied in enforce mode: %v", errs.Msg(err))
+		metrics.IncrCounter(metricsName, 1)
+		return nil
+	}
+
+	return err
+}
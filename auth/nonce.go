@@ -0,0 +1,197 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/orm/database/redis"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+const (
+	NonceStoreMemory = "memory" // nonce 存储于本地内存
+
+	defaultClockSkew     = 300000  // 默认允许的客户端时钟偏差（单位 ms）
+	defaultNonceCapacity = 1000000 // 本地内存默认最多存储的 nonce 数量
+	noncePrefix          = "horm_nonce_"
+)
+
+var (
+	clockSkew             = time.Duration(defaultClockSkew) * time.Millisecond // 允许的客户端时钟偏差
+	nonceStore NonceStore = newMemoryNonceStore(defaultNonceCapacity)          // nonce 存储
+)
+
+// NonceStore nonce 存储，多实例部署时需要使用共享存储（redis）才能防止请求重放到其他实例
+type NonceStore interface {
+	// Add 写入 nonce，ttl 后过期，nonce 未过期且已存在时返回 false
+	Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// SetReplayConfig 设置防重放配置，skew 为允许的客户端时钟偏差（单位 ms），store 为 nonce 存储，
+// 为空或 memory 时存储于本地内存（最多 capacity 个，应不小于 qps × 2 × skew），否则为 tbl_db 中配置的 redis 库名
+func SetReplayConfig(skew int, store string, capacity int) error {
+	if skew <= 0 {
+		skew = defaultClockSkew
+	}
+
+	if capacity <= 0 {
+		capacity = defaultNonceCapacity
+	}
+
+	clockSkew = time.Duration(skew) * time.Millisecond
+
+	if store == "" || store == NonceStoreMemory {
+		nonceStore = newMemoryNonceStore(capacity)
+		return nil
+	}
+
+	if getRedis(table.Current(), store) == nil {
+		return errs.Newf(consts.ErrNonceStore, "nonce store [%s] is not a redis db in tbl_db", store)
+	}
+
+	nonceStore = &redisNonceStore{name: store}
+	return nil
+}
+
+// replayCheck 防重放校验，请求时间戳必须在允许的时钟偏差内，且时间窗口内 nonce 不能重复。
+// nonce 为 appid + 签名，签名已覆盖 timestamp、auth_rand 等字段，不能使用未签名的字段（如 ip），否则修改后即可重放
+func replayCheck(ctx context.Context, head *proto.RequestHeader) error {
+	ts := time.UnixMilli(int64(head.Timestamp))
+
+	diff := time.Since(ts)
+	if diff < 0 {
+		diff = -diff
+	}
+
+	if diff > clockSkew {
+		return errs.Newf(consts.ErrRequestExpired, "appid [%d] request timestamp %d is out of allowed clock skew %s",
+			head.Appid, head.Timestamp, clockSkew)
+	}
+
+	nonce := fmt.Sprintf("%d_%s", head.Appid, head.Sign)
+
+	// 超出时间窗口的请求会被直接拒绝，nonce 只需保留两倍时钟偏差的时长
+	ok, err := nonceStore.Add(ctx, nonce, 2*clockSkew)
+	if err != nil {
+		return errs.Newf(consts.ErrNonceStore, "appid [%d] nonce store error: %v", head.Appid, err)
+	}
+
+	if !ok {
+		return errs.Newf(consts.ErrRequestReplay, "appid [%d] request is replayed, nonce=%s", head.Appid, nonce)
+	}
+
+	return nil
+}
+
+// memoryNonceStore 本地内存 nonce 存储，只淘汰过期的 nonce。未过期的 nonce 达到容量时拒绝写入，
+// 淘汰未过期的 nonce 会使其对应的请求可以被重放
+type memoryNonceStore struct {
+	lock     sync.Mutex
+	capacity int
+	list     *list.List // 按写入时间排序，越早写入越靠后
+	items    map[string]*list.Element
+}
+
+type nonceItem struct {
+	nonce    string
+	expireAt time.Time
+}
+
+func newMemoryNonceStore(capacity int) *memoryNonceStore {
+	return &memoryNonceStore{
+		capacity: capacity,
+		list:     list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+// Add 写入 nonce，未过期的 nonce 达到容量时返回错误
+func (m *memoryNonceStore) Add(_ context.Context, nonce string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// 淘汰过期的 nonce，ttl 相同，越早写入越早过期
+	for back := m.list.Back(); back != nil; back = m.list.Back() {
+		item := back.Value.(*nonceItem)
+		if now.Before(item.expireAt) {
+			break
+		}
+
+		m.list.Remove(back)
+		delete(m.items, item.nonce)
+	}
+
+	if _, ok := m.items[nonce]; ok {
+		return false, nil
+	}
+
+	if m.list.Len() >= m.capacity {
+		return false, fmt.Errorf("memory nonce store is full with %d live nonces, "+
+			"nonce_capacity should be at least qps × 2 × clock_skew", m.capacity)
+	}
+
+	m.items[nonce] = m.list.PushFront(&nonceItem{nonce: nonce, expireAt: now.Add(ttl)})
+
+	return true, nil
+}
+
+// redisNonceStore redis nonce 存储，所有实例共享。每次写入时从请求固定的快照获取库信息，库地址变更后立即生效
+type redisNonceStore struct {
+	name string // tbl_db 中配置的 redis 库名
+}
+
+// Add 写入 nonce（SET NX PX）
+func (r *redisNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	db := getRedis(table.Snap(ctx), r.name)
+	if db == nil {
+		return false, fmt.Errorf("nonce store [%s] is not a redis db in config version %d", r.name, table.Snap(ctx).Version)
+	}
+
+	query := redis.Redis{
+		Cmd:  cc.OpSet,
+		Key:  noncePrefix + nonce,
+		Args: []interface{}{1, "NX", "PX", ttl.Milliseconds()},
+		Addr: db.Addr,
+	}
+
+	_, _, isNil, err := query.Query(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return !isNil, nil
+}
+
+// getRedis 从快照获取 redis 库信息，库不存在或不是 redis 时返回 nil
+func getRedis(snap *table.Snapshot, name string) *obj.TblDB {
+	db := snap.GetDBByName(name)
+	if db == nil || db.Addr == nil || db.Addr.Type != cc.DBTypeRedis {
+		return nil
+	}
+
+	return db
+}
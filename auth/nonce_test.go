@@ -0,0 +1,98 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/server/consts"
+)
+
+func TestMemoryNonceStore(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryNonceStore(2)
+	ttl := 200 * time.Millisecond
+
+	for _, nonce := range []string{"a", "b"} {
+		if ok, err := store.Add(ctx, nonce, ttl); !ok || err != nil {
+			t.Fatalf("add nonce %s: ok=%v, err=%v", nonce, ok, err)
+		}
+	}
+
+	if ok, err := store.Add(ctx, "a", ttl); ok || err != nil {
+		t.Errorf("add duplicate nonce: ok=%v, err=%v, want false", ok, err)
+	}
+
+	// 未过期的 nonce 达到容量时拒绝写入，不淘汰未过期的 nonce
+	if ok, err := store.Add(ctx, "c", ttl); ok || err == nil {
+		t.Errorf("add nonce to full store: ok=%v, err=%v, want error", ok, err)
+	}
+
+	if ok, _ := store.Add(ctx, "a", ttl); ok {
+		t.Error("live nonce is evicted by full store")
+	}
+
+	// 过期的 nonce 被淘汰，可以再次写入
+	time.Sleep(ttl + 50*time.Millisecond)
+
+	if ok, err := store.Add(ctx, "c", ttl); !ok || err != nil {
+		t.Errorf("add nonce after expiry: ok=%v, err=%v", ok, err)
+	}
+
+	if ok, err := store.Add(ctx, "a", ttl); !ok || err != nil {
+		t.Errorf("add expired nonce again: ok=%v, err=%v", ok, err)
+	}
+
+	if store.list.Len() != 2 || len(store.items) != 2 {
+		t.Errorf("store has %d nonces, %d items, want 2", store.list.Len(), len(store.items))
+	}
+}
+
+func TestReplayCheck(t *testing.T) {
+	oldSkew, oldStore := clockSkew, nonceStore
+	defer func() { clockSkew, nonceStore = oldSkew, oldStore }()
+
+	if err := SetReplayConfig(1000, NonceStoreMemory, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	now := uint64(time.Now().UnixMilli())
+
+	head := &proto.RequestHeader{Appid: 1, Timestamp: now, Sign: "sign1"}
+	if err := replayCheck(ctx, head); err != nil {
+		t.Fatalf("first request error: %v", err)
+	}
+
+	if err := replayCheck(ctx, head); errs.Code(err) != consts.ErrRequestReplay {
+		t.Errorf("replayed request, err=%v, want code %d", err, consts.ErrRequestReplay)
+	}
+
+	// nonce 包含 appid，不同应用相同签名不冲突
+	if err := replayCheck(ctx, &proto.RequestHeader{Appid: 2, Timestamp: now, Sign: "sign1"}); err != nil {
+		t.Errorf("request of another app error: %v", err)
+	}
+
+	for _, ts := range []uint64{now - 2000, now + 2000} {
+		err := replayCheck(ctx, &proto.RequestHeader{Appid: 1, Timestamp: ts, Sign: "sign2"})
+		if errs.Code(err) != consts.ErrRequestExpired {
+			t.Errorf("timestamp %d out of clock skew, err=%v, want code %d", ts, err, consts.ErrRequestExpired)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"strings"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+// rawQueryCheck 原生语句权限校验。elastic 原生查询体只能用于 find、find_all，按执行单元的表校验查询权限；
+// sql 语句只允许只读的 SELECT，且必须拥有语句访问的每个表的查询权限，DML、DDL 仍需库数据权限或表 query_all 权限。
+func rawQueryCheck(snap *table.Snapshot, source *obj.Tree, appInfo *table.AppInfo, appid uint64,
+	op, query string, isRecheck bool, now time.Time) error {
+	tblTable := source.GetTable()
+	db := source.GetDB()
+
+	switch db.Addr.Type {
+	case cc.DBTypeElastic:
+		if (op == cc.OpFind || op == cc.OpFindAll) && rawReadable(appInfo, tblTable, now) {
+			return nil
+		}
+	case cc.DBTypeMySQL, cc.DBTypePostgreSQL, cc.DBTypeClickHouse:
+		stmt, err := classifySQL(query, db.Addr.Type)
+		if err != nil {
+			return errs.Newf(errs.ErrHasNoTableRight, "[%s]%s appid(%d) query %s directly, parse query error: %v",
+				source.GetPath(), recheck(isRecheck), appid, source.GetName(), err)
+		}
+
+		// 未解析出访问的表时无法确定语句访问的数据，不以执行单元的表代替
+		if !stmt.ReadOnly || len(stmt.Tables) == 0 {
+			break
+		}
+
+		for _, name := range stmt.Tables {
+			if !rawTableReadable(snap, appInfo, db, name, now) {
+				return errs.Newf(errs.ErrHasNoTableRight, "[%s]%s appid(%d) has no permission to query table %s directly",
+					source.GetPath(), recheck(isRecheck), appid, strings.Join(name, "."))
+			}
+		}
+
+		return nil
+	}
+
+	return errs.Newf(errs.ErrHasNoDBRight, "[%s]%s appid(%d) has no permission to query %s directly",
+		source.GetPath(), recheck(isRecheck), appid, source.GetName())
+}
+
+// rawTableReadable 是否拥有原生语句访问的表的查询权限，表名为物理表名，根据库下表的 table_verify（为空时为表名）匹配表配置，
+// 带库名前缀时库名必须与执行单元所在库一致
+func rawTableReadable(snap *table.Snapshot, appInfo *table.AppInfo, db *obj.TblDB, name []string, now time.Time) bool {
+	tableName := name[len(name)-1]
+
+	if len(name) == 2 {
+		if db.Addr.Conn == nil || !strings.EqualFold(name[0], db.Addr.Conn.DB) {
+			return false
+		}
+	} else if len(name) > 2 {
+		return false
+	}
+
+	for _, tbl := range snap.GetDBTables(db.Id) {
+		rule := tbl.TableVerify
+		if rule == "" {
+			rule = tbl.Name
+		}
+
+		if matchTable(tableName, rule) && rawReadable(appInfo, tbl, now) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rawReadable 是否可以通过原生语句查询表。原生语句无法应用列权限、行级过滤、表 ip 白名单，存在这些限制的表不允许
+func rawReadable(appInfo *table.AppInfo, tbl *obj.TblTable, now time.Time) bool {
+	if appInfo.Columns[tbl.Id] != nil || appInfo.RowFilters[tbl.Id] != nil || appInfo.TableIP[tbl.Id] != nil {
+		return false
+	}
+
+	return tableReadable(appInfo, tbl, now)
+}
+
+// tableReadable 是否拥有表的查询权限
+func tableReadable(appInfo *table.AppInfo, tbl *obj.TblTable, now time.Time) bool {
+	acdb := appInfo.AccessDB[tbl.DB]
+	if dbGranted(acdb, now) && (acdb.Root == consts.DBRootAll || acdb.Root == consts.DBRootTableData ||
+		supportOp(appInfo.DBOps[tbl.DB], cc.OpFind) || supportOp(appInfo.DBOps[tbl.DB], cc.OpFindAll)) {
+		return true
+	}
+
+	actb := appInfo.AccessTable[tbl.Id]
+	if tableGranted(actb, now) && (actb.QueryAll == consts.TableQueryAllTrue ||
+		supportOp(appInfo.TableOPs[tbl.Id], cc.OpFind) || supportOp(appInfo.TableOPs[tbl.Id], cc.OpFindAll)) {
+		return true
+	}
+
+	return false
+}
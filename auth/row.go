@@ -0,0 +1,174 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	pf "github.com/horm-database/common/proto/plugin"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/common/util"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/model/table"
+)
+
+// RowFilter 行级过滤，将应用对表的行级过滤条件合并到经插件处理之后最终请求的 where 条件中（查询、更新、删除），
+// 并校验写入数据（新增、更新）满足过滤条件。原生 query 语句无法合并条件，直接拒绝。audit 模式仅校验，不合并条件。
+func RowFilter(ctx context.Context, source *obj.Tree, appid uint64, req *pf.Request) error {
+	if permissionMode == ModeOff {
+		return nil
+	}
+
+	dbType := source.GetDB().Addr.Type
+	if dbType == cc.DBTypeRedis || dbType == cc.DBTypeNil {
+		return nil
+	}
+
+	filter := table.Snap(ctx).GetRowFilter(appid, source.GetTable().Id)
+	if len(filter) == 0 {
+		return nil
+	}
+
+	err := rowFilter(source, appid, req, filter, permissionMode == ModeEnforce)
+	return modeHandle(ctx, permissionMode, "PermissionAuditDeny", err)
+}
+
+func rowFilter(source *obj.Tree, appid uint64, req *pf.Request,
+	filter map[string]interface{}, enforce bool) error {
+	if _, ok := filter[table.RowFilterInvalid]; ok {
+		return rowFilterError(source, appid, "row filter is invalid")
+	}
+
+	if req.Query != "" {
+		return rowFilterError(source, appid, "query statement directly is not allowed with row filter")
+	}
+
+	isElastic := source.GetDB().Addr.Type == cc.DBTypeElastic
+
+	switch req.Op {
+	case cc.OpInsert, cc.OpReplace:
+		datas := req.Datas
+		if len(req.Data) > 0 {
+			datas = append(datas, req.Data)
+		}
+
+		for _, data := range datas {
+			err := dataMatchFilter(source, appid, data, filter, isElastic, true, enforce)
+			if err != nil {
+				return err
+			}
+		}
+	case cc.OpUpdate:
+		err := dataMatchFilter(source, appid, req.Data, filter, isElastic, false, enforce)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	default:
+		if enforce {
+			req.Where = mergeWhere(req.Where, filter)
+		}
+	}
+
+	return nil
+}
+
+// mergeWhere 将过滤条件与原 where 条件以 AND 合并，过滤条件为全局共享，需复制之后使用
+func mergeWhere(where, filter map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(filter))
+	for k, v := range filter {
+		ret[k] = v
+	}
+
+	if len(where) == 0 {
+		return ret
+	}
+
+	return map[string]interface{}{
+		"AND": []map[string]interface{}{ret, where},
+	}
+}
+
+// dataMatchFilter 校验写入数据满足过滤条件，仅支持等值（或 IN）过滤条件。
+// 新增数据缺少等值过滤列时，enforce 模式自动填充该列，更新数据缺少过滤列时保持不变。
+func dataMatchFilter(source *obj.Tree, appid uint64, data, filter map[string]interface{},
+	isElastic, isInsert, enforce bool) error {
+	for k, v := range filter {
+		column, operator, _, _, _, _, _ := util.OperatorMatch(k, isElastic)
+		if operator != "" && operator != "=" {
+			return rowFilterError(source, appid,
+				fmt.Sprintf("write is not allowed with non-equal row filter [%s]", k))
+		}
+
+		values := filterValues(v)
+
+		val, ok := data[column]
+		if !ok {
+			if !isInsert {
+				continue
+			}
+
+			if len(values) != 1 {
+				return rowFilterError(source, appid, fmt.Sprintf("insert data must set column [%s]", column))
+			}
+
+			if enforce {
+				data[column] = values[0]
+			}
+			continue
+		}
+
+		if !valueIn(val, values) {
+			return rowFilterError(source, appid,
+				fmt.Sprintf("column [%s] value %v does not match row filter", column, val))
+		}
+	}
+
+	return nil
+}
+
+func filterValues(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+
+	values := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		values[i] = rv.Index(i).Interface()
+	}
+
+	return values
+}
+
+func valueIn(val interface{}, values []interface{}) bool {
+	str := types.InterfaceToString(types.Indirect(val))
+	for _, v := range values {
+		if types.InterfaceToString(v) == str {
+			return true
+		}
+	}
+
+	return false
+}
+
+func rowFilterError(source *obj.Tree, appid uint64, reason string) error {
+	return errs.Newf(errs.ErrHasNoTableRight, "[%s] appid [%d] row filter of table %s: %s",
+		source.GetPath(), appid, source.GetName(), reason)
+}
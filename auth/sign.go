@@ -15,71 +15,134 @@
 package auth
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"math/rand"
-	"sync"
 	"time"
 
 	"github.com/horm-database/common/crypto"
+	"github.com/horm-database/common/errs"
 	"github.com/horm-database/common/proto"
+	"github.com/horm-database/server/consts"
 	"github.com/horm-database/server/model/table"
 )
 
-var SameRequestLock = new(sync.RWMutex)
-var SameRequest = map[string]bool{}
+// SignCheck 签名校验及防重放校验，校验模式见 SetSignMode。客户端证书认证（见 IsCertAuth）时不再校验签名，
+// 将证书对应的 appid 写入请求头；http bearer token（见 IsBearer）认证时校验 jwt，并将 claim 中的 appid 写入请求头。
+// 即使校验模式为 off，证书、jwt 校验成功时也会写入 appid。body 为请求包体（压缩时为压缩后的包体），HMAC 签名包含其摘要
+func SignCheck(ctx context.Context, head *proto.RequestHeader, body []byte) error {
+	return signCheck(ctx, head, body, signMode)
+}
+
+// signCheck 按指定校验模式校验签名及防重放
+func signCheck(ctx context.Context, head *proto.RequestHeader, body []byte, mode string) error {
+	if appid := certAppid(ctx); appid != 0 {
+		err := certCheck(head, appid)
+		if mode == ModeOff {
+			return nil
+		}
+
+		return modeHandle(ctx, mode, "SignAuditFail", err)
+	}
 
-func init() {
-	go func() {
-		for {
-			SameRequestLock.Lock()
-			SameRequest = map[string]bool{}
-			SameRequestLock.Unlock()
-			time.Sleep(time.Duration(15+rand.Intn(15)) * time.Second) // 15 ~ 30 S清空一次
+	if IsBearer(head) {
+		err := jwtCheck(ctx, head)
+		if mode == ModeOff {
+			return nil
 		}
-	}()
+
+		return modeHandle(ctx, mode, "SignAuditFail", err)
+	}
+
+	if mode == ModeOff {
+		return nil
+	}
+
+	var err error
+	if !SignSuccess(ctx, head, body) {
+		err = errs.Newf(errs.ErrAuthFail, "appid [%d] signature failed", head.Appid)
+	} else {
+		err = replayCheck(ctx, head)
+	}
+
+	return modeHandle(ctx, mode, "SignAuditFail", err)
 }
 
-// SignSuccess 签名是否正确
-func SignSuccess(head *proto.RequestHeader) bool {
+// SignSuccess 签名是否正确。请求头 version 不低于 consts.SignVersionHMAC 时为 HMAC-SHA256 签名，否则为旧版 md5 签名，
+// 应用可以通过 forbid_md5 禁止 md5 签名。应用所有有效的秘钥（见 Snapshot.GetAppSecrets）均可用于签名，以支持秘钥轮换。
+func SignSuccess(ctx context.Context, head *proto.RequestHeader, body []byte) bool {
 	if head.Appid == 0 {
 		return false
 	}
 
-	secret := getSecretByAppid(head.Appid)
-	if secret == "" {
+	snap := table.Snap(ctx)
+
+	appInfo := snap.GetAppInfo(head.Appid)
+	if appInfo == nil {
 		return false
 	}
 
-	md5Str := fmt.Sprintf("%d%s%d%d%d%s%d%d%s%d%d%d", head.Appid, secret,
-		head.RequestType, head.QueryMode, head.RequestId, head.TraceId, head.Timestamp,
-		head.Timeout, head.Caller, head.Compress, head.AuthRand, head.Version)
+	secrets := snap.GetAppSecrets(head.Appid, time.Now())
+	if len(secrets) == 0 {
+		return false
+	}
 
-	sign := crypto.MD5Str(md5Str)
+	if head.Version >= consts.SignVersionHMAC {
+		return hmacSignSuccess(head, body, secrets)
+	}
 
-	if sign != head.Sign {
+	if appInfo.Info.ForbidMD5 == consts.ForbidMD5Yes {
 		return false
 	}
 
-	requestUniq := fmt.Sprintf("%d%s%d", head.Timestamp, head.Ip, head.AuthRand)
+	return md5SignSuccess(head, secrets)
+}
 
-	SameRequestLock.Lock()
-	isSame := SameRequest[requestUniq]
-	isSame2 := SameRequest[sign]
-	SameRequest[requestUniq] = true
-	SameRequest[sign] = true
-	SameRequestLock.Unlock()
+// md5SignSuccess 旧版签名，sign 为 md5(appid+secret+request_type+query_mode+request_id+trace_id+timestamp+timeout+caller+compress+auth_rand+version)
+func md5SignSuccess(head *proto.RequestHeader, secrets []string) bool {
+	for _, secret := range secrets {
+		md5Str := fmt.Sprintf("%d%s%d%d%d%s%d%d%s%d%d%d", head.Appid, secret,
+			head.RequestType, head.QueryMode, head.RequestId, head.TraceId, head.Timestamp,
+			head.Timeout, head.Caller, head.Compress, head.AuthRand, head.Version)
 
-	if isSame || isSame2 {
-		return false
+		if crypto.MD5Str(md5Str) == head.Sign {
+			return true
+		}
 	}
 
-	return true
+	return false
 }
 
-func getSecretByAppid(appid uint64) string {
-	appInfo := table.GetAppInfo(appid)
-	if appInfo != nil {
-		return appInfo.Info.Secret
+// hmacSignSuccess HMAC-SHA256 签名，sign 为小写的 hex(hmac_sha256(secret, signContent))。
+// 签名是防重放 nonce 的一部分，hex 解码不区分大小写，只接受小写，否则改变字母大小写即可生成新的 nonce 重放请求
+func hmacSignSuccess(head *proto.RequestHeader, body []byte, secrets []string) bool {
+	sign, err := hex.DecodeString(head.Sign)
+	if err != nil || hex.EncodeToString(sign) != head.Sign {
+		return false
+	}
+
+	content := signContent(head, body)
+
+	for _, secret := range secrets {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(content)
+
+		if hmac.Equal(mac.Sum(nil), sign) {
+			return true
+		}
 	}
-	return ""
+
+	return false
+}
+
+// signContent HMAC 签名内容，各字段以换行符分隔，避免字段拼接产生歧义。最后一行为包体的 hex(sha256(body))，
+// 签名覆盖请求内容，截获的签名无法用于篡改后的包体
+func signContent(head *proto.RequestHeader, body []byte) []byte {
+	digest := sha256.Sum256(body)
+
+	return []byte(fmt.Sprintf("%d\n%d\n%d\n%d\n%s\n%d\n%d\n%s\n%d\n%d\n%d\n%s",
+		head.Appid, head.RequestType, head.QueryMode, head.RequestId, head.TraceId, head.Timestamp,
+		head.Timeout, head.Caller, head.Compress, head.AuthRand, head.Version, hex.EncodeToString(digest[:])))
 }
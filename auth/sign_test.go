@@ -0,0 +1,58 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/server/consts"
+)
+
+func TestHMACSign(t *testing.T) {
+	body := []byte(`{"name":"student","op":"find"}`)
+	head := &proto.RequestHeader{Appid: 1, Version: consts.SignVersionHMAC, Timestamp: 1700000000000, AuthRand: 7}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(signContent(head, body))
+	sign := hex.EncodeToString(mac.Sum(nil))
+
+	i := strings.IndexAny(sign, "abcdef")
+	mixed := sign[:i] + strings.ToUpper(sign[i:i+1]) + sign[i+1:]
+
+	cases := []struct {
+		name  string
+		sign  string
+		body  []byte
+		valid bool
+	}{
+		{"lowercase", sign, body, true},
+		{"uppercase", strings.ToUpper(sign), body, false}, // 改变大小写会生成新的 nonce，不能通过校验
+		{"mixed case", mixed, body, false},
+		{"tampered body", sign, []byte(`{"name":"secret","op":"find"}`), false},
+		{"not hex", "zz" + sign[2:], body, false},
+	}
+
+	for _, c := range cases {
+		head.Sign = c.sign
+		if hmacSignSuccess(head, c.body, []string{"old", "secret"}) != c.valid {
+			t.Errorf("%s: sign valid should be %v", c.name, c.valid)
+		}
+	}
+}
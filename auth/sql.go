@@ -0,0 +1,584 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	cc "github.com/horm-database/common/consts"
+)
+
+const ( // sql 词法单元类型
+	tokenWord   = 1 // 关键字、标识符、数字
+	tokenQuoted = 2 // 反引号、双引号包裹的标识符
+	tokenString = 3 // 字符串
+	tokenSymbol = 4 // 符号
+)
+
+// rawSQL 原生 sql 语句分类结果
+type rawSQL struct {
+	ReadOnly bool       // 是否只读语句（SELECT）
+	Tables   [][]string // 访问的表，带库名前缀时为 [库名, 表名]
+}
+
+type sqlToken struct {
+	kind int
+	text string
+}
+
+// sqlDialect 各数据库的注释、字符串转义规则
+type sqlDialect struct {
+	backslash   bool // 字符串支持反斜杠转义（mysql、clickhouse，postgresql 仅 E'...'）
+	hashComment bool // # 为单行注释（mysql、clickhouse）
+	dashSpace   bool // -- 之后必须为空白或控制字符才是注释（mysql）
+	dollarQuote bool // 支持 $tag$...$tag$ 字符串（postgresql、clickhouse）
+	escapeMode  bool // 反斜杠转义可以被会话配置开启、关闭（mysql 的 NO_BACKSLASH_ESCAPES，postgresql 的 standard_conforming_strings）
+}
+
+func getDialect(dbType int) *sqlDialect {
+	switch dbType {
+	case cc.DBTypeMySQL:
+		return &sqlDialect{backslash: true, hashComment: true, dashSpace: true, escapeMode: true}
+	case cc.DBTypeClickHouse:
+		return &sqlDialect{backslash: true, hashComment: true, dollarQuote: true}
+	default:
+		return &sqlDialect{dollarQuote: true, escapeMode: true}
+	}
+}
+
+// 只读语句中不允许出现的关键字，出现即视为写操作或有副作用的语句
+var sqlWriteKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true, "MERGE": true, "UPSERT": true,
+	"CREATE": true, "DROP": true, "ALTER": true, "TRUNCATE": true, "RENAME": true, "GRANT": true,
+	"REVOKE": true, "CALL": true, "EXEC": true, "EXECUTE": true, "INTO": true, "LOCK": true,
+	"HANDLER": true, "LOAD": true, "COPY": true,
+}
+
+// 结束 FROM 表列表的子句关键字
+var sqlClauseKeywords = map[string]bool{
+	"WHERE": true, "GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true, "UNION": true,
+	"EXCEPT": true, "INTERSECT": true, "WINDOW": true, "FOR": true, "OFFSET": true, "FETCH": true,
+	"PREWHERE": true, "QUALIFY": true, "SETTINGS": true, "FORMAT": true, "SELECT": true,
+}
+
+// 原生 sql 允许使用的表函数，只生成数据，不访问外部数据源
+var sqlTableFunctions = map[string]bool{
+	"generate_series": true, "unnest": true, "json_table": true, "numbers": true,
+}
+
+// 可以直接跟括号的关键字，不是函数调用
+var sqlParenKeywords = map[string]bool{
+	"select": true, "from": true, "join": true, "lateral": true, "only": true, "where": true, "having": true,
+	"on": true, "using": true, "in": true, "exists": true, "any": true, "all": true, "some": true, "as": true,
+	"values": true, "over": true, "filter": true, "group": true, "by": true, "partition": true, "window": true,
+	"and": true, "or": true, "xor": true, "not": true, "is": true, "like": true, "ilike": true, "regexp": true,
+	"rlike": true, "between": true, "escape": true, "against": true, "to": true, "div": true, "interval": true,
+	"case": true, "when": true, "then": true, "else": true, "distinct": true, "union": true, "except": true,
+	"intersect": true, "minus": true, "limit": true, "offset": true, "index": true, "key": true, "sets": true,
+	"materialized": true, "prewhere": true, "qualify": true, "columns": true, "path": true,
+}
+
+// 原生 sql 允许调用的函数（小写），只包含计算类函数，读取文件、访问外部数据源、修改状态、休眠加锁等函数都不在其中
+var sqlFunctions = map[string]bool{
+	// 聚合、窗口
+	"count": true, "sum": true, "avg": true, "min": true, "max": true, "group_concat": true, "string_agg": true,
+	"array_agg": true, "json_agg": true, "jsonb_agg": true, "json_object_agg": true, "jsonb_object_agg": true,
+	"json_arrayagg": true, "json_objectagg": true, "bit_and": true, "bit_or": true, "bit_xor": true,
+	"bool_and": true, "bool_or": true, "every": true, "std": true, "stddev": true, "stddev_pop": true,
+	"stddev_samp": true, "variance": true, "var_pop": true, "var_samp": true, "any_value": true,
+	"percentile_cont": true, "percentile_disc": true, "mode": true, "grouping": true, "rollup": true, "cube": true,
+	"uniq": true, "uniqexact": true, "grouparray": true, "groupuniqarray": true, "argmin": true, "argmax": true,
+	"median": true, "quantile": true, "countif": true, "sumif": true, "avgif": true,
+	"row_number": true, "rank": true, "dense_rank": true, "percent_rank": true, "cume_dist": true, "ntile": true,
+	"lag": true, "lead": true, "first_value": true, "last_value": true, "nth_value": true,
+
+	// 条件
+	"if": true, "ifnull": true, "nullif": true, "coalesce": true, "greatest": true, "least": true,
+	"isnull": true, "multiif": true,
+
+	// 字符串
+	"concat": true, "concat_ws": true, "length": true, "char_length": true, "character_length": true,
+	"octet_length": true, "bit_length": true, "lower": true, "upper": true, "lcase": true, "ucase": true,
+	"substring": true, "substr": true, "substring_index": true, "left": true, "right": true, "trim": true,
+	"ltrim": true, "rtrim": true, "btrim": true, "lpad": true, "rpad": true, "replace": true, "insert": true,
+	"repeat": true, "reverse": true, "locate": true, "position": true, "instr": true, "strpos": true,
+	"split_part": true, "format": true, "ascii": true, "chr": true, "char": true, "initcap": true,
+	"translate": true, "regexp_replace": true, "regexp_like": true, "regexp_substr": true, "regexp_instr": true,
+	"field": true, "elt": true, "find_in_set": true, "space": true, "match": true, "startswith": true,
+	"endswith": true, "splitbychar": true, "splitbystring": true, "empty": true, "notempty": true,
+	"md5": true, "sha1": true, "sha2": true, "crc32": true, "hex": true, "unhex": true, "to_hex": true,
+	"to_base64": true, "from_base64": true, "encode": true, "decode": true,
+
+	// 数值
+	"abs": true, "ceil": true, "ceiling": true, "floor": true, "round": true, "truncate": true, "trunc": true,
+	"mod": true, "pow": true, "power": true, "sqrt": true, "exp": true, "ln": true, "log": true, "log2": true,
+	"log10": true, "sign": true, "pi": true, "rand": true, "random": true, "sin": true, "cos": true, "tan": true,
+	"asin": true, "acos": true, "atan": true, "atan2": true, "degrees": true, "radians": true, "conv": true,
+	"bin": true, "oct": true, "bit_count": true, "intdiv": true,
+
+	// 日期时间
+	"now": true, "current_date": true, "current_time": true, "current_timestamp": true, "localtime": true,
+	"localtimestamp": true, "curdate": true, "curtime": true, "utc_date": true, "utc_timestamp": true,
+	"date": true, "time": true, "year": true, "month": true, "day": true, "dayofmonth": true, "dayofweek": true,
+	"dayofyear": true, "week": true, "weekday": true, "weekofyear": true, "yearweek": true, "hour": true,
+	"minute": true, "second": true, "quarter": true, "microsecond": true, "monthname": true, "dayname": true,
+	"date_format": true, "date_add": true, "date_sub": true, "adddate": true, "subdate": true, "addtime": true,
+	"subtime": true, "datediff": true, "timediff": true, "timestampdiff": true, "timestampadd": true,
+	"from_unixtime": true, "unix_timestamp": true, "str_to_date": true, "makedate": true, "maketime": true,
+	"last_day": true, "convert_tz": true, "extract": true, "date_part": true, "date_trunc": true, "age": true,
+	"make_date": true, "make_timestamp": true, "to_char": true, "to_number": true, "to_date": true,
+	"to_timestamp": true, "today": true, "yesterday": true, "todate": true, "todatetime": true,
+	"tostartofday": true, "tostartofweek": true, "tostartofmonth": true, "tostartofhour": true,
+	"toyyyymm": true, "toyyyymmdd": true, "toyear": true, "tomonth": true, "todayofmonth": true,
+	"tounixtimestamp": true, "formatdatetime": true,
+
+	// 类型转换及类型名（CAST(x AS DECIMAL(10, 2))、CONVERT(x, CHAR(10))）
+	"cast": true, "convert": true, "tostring": true, "toint8": true, "toint16": true, "toint32": true,
+	"toint64": true, "touint8": true, "touint16": true, "touint32": true, "touint64": true, "tofloat32": true,
+	"tofloat64": true, "decimal": true, "numeric": true, "varchar": true, "nchar": true, "binary": true,
+	"varbinary": true, "float": true, "double": true, "datetime": true, "timestamp": true, "bit": true,
+	"nullable": true, "lowcardinality": true, "datetime64": true, "fixedstring": true,
+
+	// json、数组
+	"json_extract": true, "json_unquote": true, "json_object": true, "json_array": true, "json_contains": true,
+	"json_contains_path": true, "json_keys": true, "json_length": true, "json_type": true, "json_valid": true,
+	"json_value": true, "json_search": true, "json_build_object": true, "json_build_array": true,
+	"jsonb_build_object": true, "jsonb_build_array": true, "json_extract_path": true,
+	"json_extract_path_text": true, "jsonb_extract_path": true, "jsonb_extract_path_text": true,
+	"json_array_elements": true, "jsonb_array_elements": true, "json_array_length": true,
+	"jsonb_array_length": true, "json_typeof": true, "jsonb_typeof": true, "to_json": true, "to_jsonb": true,
+	"row_to_json": true, "jsonextractstring": true, "jsonextractint": true, "jsonextractfloat": true,
+	"jsonextractbool": true, "jsonextractraw": true, "jsonhas": true, "jsonlength": true,
+	"array": true, "array_length": true, "cardinality": true, "array_to_string": true, "string_to_array": true,
+	"array_position": true, "has": true, "hasany": true, "hasall": true, "indexof": true, "arrayjoin": true,
+	"tuple": true, "row": true,
+
+	// 表函数
+	"generate_series": true, "unnest": true, "json_table": true, "numbers": true,
+}
+
+// classifySQL 解析原生 sql，判断是否只读语句并获取访问的所有表。只支持单条语句，无法确定的语句一律视为非只读。
+func classifySQL(query string, dbType int) (*rawSQL, error) {
+	tokens, err := sqlTokenize(query, getDialect(dbType))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("empty statement")
+	}
+
+	ret := rawSQL{}
+
+	first := tokens[0]
+	if first.kind == tokenSymbol && first.text == "(" {
+		for _, t := range tokens {
+			if t.kind != tokenSymbol || t.text != "(" {
+				first = t
+				break
+			}
+		}
+	}
+
+	if first.kind != tokenWord || (!isWord(first, "SELECT") && !isWord(first, "WITH")) {
+		return &ret, nil
+	}
+
+	for i, t := range tokens {
+		if t.kind != tokenWord || !sqlWriteKeywords[strings.ToUpper(t.text)] {
+			continue
+		}
+
+		// INSERT()、REPLACE() 为字符串函数
+		if (isWord(t, "INSERT") || isWord(t, "REPLACE")) && i+1 < len(tokens) && isSymbol(tokens[i+1], "(") {
+			continue
+		}
+
+		return &ret, nil
+	}
+
+	ret.Tables, err = sqlTables(tokens, cteNames(tokens))
+	if err != nil {
+		return nil, err
+	}
+
+	err = sqlFunctionCheck(tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.ReadOnly = true
+	return &ret, nil
+}
+
+// IsReadOnlySQL 原生 sql 是否只读语句，无法解析的语句视为非只读
+func IsReadOnlySQL(query string, dbType int) bool {
+	ret, err := classifySQL(query, dbType)
+	return err == nil && ret.ReadOnly
+}
+
+// sqlTables 获取 FROM、JOIN、TABLE 之后的表，函数参数中的 FROM（比如 EXTRACT(YEAR FROM d)）不是表。
+// FROM 之后的括号为子查询或者括号包裹的表列表（比如 JOIN (t1 JOIN t2 ON ...)），继续解析其中的表；
+// 表函数只允许白名单中不访问外部数据的函数，无法解析的表项直接拒绝。
+func sqlTables(tokens []sqlToken, ctes map[string]bool) (tables [][]string, err error) {
+	type level struct {
+		hasSelect bool // 当前括号层级是否为查询语句
+		inFrom    bool // 是否处于 FROM 表列表中
+	}
+
+	levels := []*level{{}}
+	expectTable := false
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		cur := levels[len(levels)-1]
+
+		switch {
+		case isSymbol(t, "("):
+			levels = append(levels, &level{inFrom: expectTable}) // 表项位置的括号，内部仍然是表列表
+			continue
+		case isSymbol(t, ")"):
+			if len(levels) > 1 {
+				levels = levels[:len(levels)-1]
+			}
+			expectTable = false
+			continue
+		case isSymbol(t, ","):
+			expectTable = cur.inFrom
+			continue
+		}
+
+		if t.kind == tokenWord {
+			word := strings.ToUpper(t.text)
+
+			switch {
+			case word == "SELECT":
+				cur.hasSelect, cur.inFrom, expectTable = true, false, false
+				continue
+			case word == "FROM":
+				if cur.hasSelect {
+					cur.inFrom, expectTable = true, true
+				}
+				continue
+			case word == "JOIN" || word == "STRAIGHT_JOIN":
+				cur.inFrom, expectTable = true, true
+				continue
+			case word == "TABLE" && (i == 0 || !isSymbol(tokens[i-1], ".")): // TABLE t 等同于 SELECT * FROM t
+				cur.inFrom, expectTable = false, true
+				continue
+			case word == "VALUES" || word == "WITH":
+				expectTable = false
+				continue
+			case word == "LATERAL" || word == "ONLY":
+				continue
+			case sqlClauseKeywords[word]:
+				cur.inFrom, expectTable = false, false
+				continue
+			}
+		}
+
+		if !expectTable {
+			continue
+		}
+
+		expectTable = false
+
+		if t.kind != tokenWord && t.kind != tokenQuoted {
+			return nil, fmt.Errorf("unresolvable table reference %q", t.text)
+		}
+
+		name := []string{t.text}
+		for i+2 < len(tokens) && isSymbol(tokens[i+1], ".") &&
+			(tokens[i+2].kind == tokenWord || tokens[i+2].kind == tokenQuoted) {
+			name = append(name, tokens[i+2].text)
+			i += 2
+		}
+
+		// 表函数，比如 JSON_TABLE(...)、generate_series(...)，remote(...)、dblink(...) 等访问外部数据的表函数不允许
+		if i+1 < len(tokens) && isSymbol(tokens[i+1], "(") {
+			if len(name) != 1 || t.kind != tokenWord || !sqlTableFunctions[strings.ToLower(name[0])] {
+				return nil, fmt.Errorf("table function %s is not allowed", strings.Join(name, "."))
+			}
+			continue
+		}
+
+		if len(name) == 1 && (ctes[strings.ToLower(name[0])] || strings.EqualFold(name[0], "DUAL")) {
+			continue
+		}
+
+		tables = append(tables, name)
+	}
+
+	return tables, nil
+}
+
+// sqlFunctionCheck 原生 sql 只允许调用白名单中的函数，LOAD_FILE、SLEEP、pg_read_file 等读取文件、有副作用的函数，
+// 以及自定义函数、带库名的函数都不允许。括号前的关键字、AS 之后的类型或别名列表、WITH 子句的公用表表达式列名不是函数调用。
+func sqlFunctionCheck(tokens []sqlToken) error {
+	header := isWord(tokens[0], "WITH") // 是否处于 WITH 子句的公用表表达式定义中（第一个 SELECT 之前）
+	depth := 0
+
+	for i := 0; i+1 < len(tokens); i++ {
+		t := tokens[i]
+
+		switch {
+		case isSymbol(t, "("):
+			depth++
+		case isSymbol(t, ")"):
+			depth--
+		case depth == 0 && isWord(t, "SELECT"):
+			header = false
+		}
+
+		if !isSymbol(tokens[i+1], "(") || t.kind != tokenWord && t.kind != tokenQuoted {
+			continue
+		}
+
+		if header && depth == 0 || i > 0 && isWord(tokens[i-1], "AS") {
+			continue
+		}
+
+		name := strings.ToLower(t.text)
+		if t.kind == tokenWord && sqlParenKeywords[name] {
+			continue
+		}
+
+		if t.kind == tokenQuoted || i > 0 && isSymbol(tokens[i-1], ".") || !sqlFunctions[name] {
+			return fmt.Errorf("function %s is not allowed", t.text)
+		}
+	}
+
+	return nil
+}
+
+// cteNames 获取 WITH 子句定义的公用表表达式名
+func cteNames(tokens []sqlToken) map[string]bool {
+	ctes := map[string]bool{}
+	if !isWord(tokens[0], "WITH") {
+		return ctes
+	}
+
+	depth := 0
+	for i := 1; i < len(tokens); i++ {
+		t := tokens[i]
+
+		switch {
+		case isSymbol(t, "("):
+			depth++
+			continue
+		case isSymbol(t, ")"):
+			depth--
+			continue
+		}
+
+		if depth != 0 {
+			continue
+		}
+
+		if isWord(t, "SELECT") {
+			break
+		}
+
+		if t.kind != tokenWord && t.kind != tokenQuoted || isWord(t, "RECURSIVE") || isWord(t, "AS") {
+			continue
+		}
+
+		// name AS (...) 或 name (col, ...) AS (...)
+		j := i + 1
+		if j < len(tokens) && isSymbol(tokens[j], "(") {
+			j = skipParen(tokens, j)
+		}
+
+		if j < len(tokens) && isWord(tokens[j], "AS") {
+			ctes[strings.ToLower(t.text)] = true
+		}
+	}
+
+	return ctes
+}
+
+// skipParen 跳过 tokens[i] 开始的括号，返回括号之后的位置
+func skipParen(tokens []sqlToken, i int) int {
+	depth := 0
+	for ; i < len(tokens); i++ {
+		if isSymbol(tokens[i], "(") {
+			depth++
+		} else if isSymbol(tokens[i], ")") {
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+
+	return i
+}
+
+// sqlTokenize sql 词法解析，去掉注释，不允许多条语句以及 mysql 可执行注释（/*! ... */）。
+// 注释、字符串按数据库的规则解析，无法确定数据库实际解析结果的语句直接拒绝：注释中出现 /*（各数据库对嵌套注释处理不同），
+// 反斜杠转义可被会话配置关闭时，字符串在开启、关闭转义两种模式下结束位置不同。
+func sqlTokenize(query string, dialect *sqlDialect) ([]sqlToken, error) {
+	var tokens []sqlToken
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case isSpace(c):
+			i++
+		case strings.HasPrefix(query[i:], "--") &&
+			(!dialect.dashSpace || i+2 == len(query) || query[i+2] <= ' '),
+			c == '#' && dialect.hashComment:
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				i = len(query)
+			} else {
+				i += end + 1
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if strings.HasPrefix(query[i:], "/*!") {
+				return nil, errors.New("executable comment is not allowed")
+			}
+
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				return nil, errors.New("unterminated comment")
+			}
+
+			if strings.Contains(query[i+2:i+2+end], "/*") {
+				return nil, errors.New("nested comment is not allowed")
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			// postgresql E'...' 字符串始终支持反斜杠转义
+			eString := c == '\'' && !dialect.backslash && len(tokens) > 0 && i > 0 &&
+				(query[i-1] == 'E' || query[i-1] == 'e') && tokens[len(tokens)-1].text == query[i-1:i]
+
+			// 反引号及 postgresql 双引号包裹的标识符不支持反斜杠转义
+			escape := c != '`' && (dialect.backslash || eString)
+
+			end, text, err := sqlQuoted(query, i, escape)
+			if err != nil {
+				return nil, err
+			}
+
+			// 转义可被会话配置关闭时，两种模式下字符串的结束位置必须相同
+			if dialect.escapeMode && !eString && (c == '\'' || c == '"' && dialect.backslash) {
+				if alt, _, e := sqlQuoted(query, i, !escape); e != nil || alt != end {
+					return nil, errors.New("backslash in quoted string is ambiguous, it depends on the session sql mode")
+				}
+			}
+
+			kind := tokenQuoted
+			if c == '\'' {
+				kind = tokenString
+			}
+
+			tokens = append(tokens, sqlToken{kind: kind, text: text})
+			i = end
+		case c == '$' && dialect.dollarQuote && dollarTag(query[i:]) != "":
+			tag := dollarTag(query[i:])
+
+			end := strings.Index(query[i+len(tag):], tag)
+			if end == -1 {
+				return nil, errors.New("unterminated dollar-quoted string")
+			}
+
+			tokens = append(tokens, sqlToken{kind: tokenString, text: query[i+len(tag) : i+len(tag)+end]})
+			i += len(tag) + end + len(tag)
+		case c == ';':
+			if rest := strings.TrimSpace(query[i+1:]); rest != "" && strings.Trim(rest, ";") != "" {
+				return nil, errors.New("multiple statements are not allowed")
+			}
+			i = len(query)
+		case isWordChar(c):
+			start := i
+			for i < len(query) && isWordChar(query[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, text: query[start:i]})
+		default:
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, text: query[i : i+1]})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// sqlQuoted 解析引号包裹的内容，支持连续两个引号转义，escape 为 true 时支持反斜杠转义，返回结束位置及内容
+func sqlQuoted(query string, start int, escape bool) (int, string, error) {
+	quote := query[start]
+	var sb strings.Builder
+
+	for i := start + 1; i < len(query); i++ {
+		c := query[i]
+
+		if c == '\\' && escape && i+1 < len(query) {
+			sb.WriteByte(query[i+1])
+			i++
+			continue
+		}
+
+		if c == quote {
+			if i+1 < len(query) && query[i+1] == quote {
+				sb.WriteByte(c)
+				i++
+				continue
+			}
+
+			return i + 1, sb.String(), nil
+		}
+
+		sb.WriteByte(c)
+	}
+
+	return 0, "", errors.New("unterminated quoted string")
+}
+
+// dollarTag 获取 $tag$ 字符串的开始标记，tag 可以为空，不是 $tag$ 时（比如参数 $1）返回空串
+func dollarTag(query string) string {
+	for i := 1; i < len(query); i++ {
+		c := query[i]
+
+		if c == '$' {
+			return query[:i+1]
+		}
+
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || i > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+
+	return ""
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func isWord(t sqlToken, word string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, word)
+}
+
+func isSymbol(t sqlToken, symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
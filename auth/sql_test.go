@@ -0,0 +1,142 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	cc "github.com/horm-database/common/consts"
+)
+
+// 隐藏表名的语句必须解析失败，或者解析出被隐藏的表
+func TestClassifySQLHiddenTable(t *testing.T) {
+	cases := []struct {
+		dbType int
+		query  string
+	}{
+		{cc.DBTypeMySQL, `SELECT 'a\'' FROM secret_table -- '`},
+		{cc.DBTypeMySQL, "SELECT 1 FROM ok # '\n, secret_table -- '"},
+		{cc.DBTypeClickHouse, `SELECT 'a\'' FROM secret_table -- '`},
+		{cc.DBTypeClickHouse, "SELECT 1 FROM ok # '\n, secret_table -- '"},
+		{cc.DBTypePostgreSQL, `SELECT 'a\'' FROM secret_table -- '`},
+		{cc.DBTypePostgreSQL, `SELECT E'a\'' FROM secret_table -- '`},
+		{cc.DBTypePostgreSQL, "SELECT 1 --'\nFROM secret_table --'"},
+		{cc.DBTypePostgreSQL, "SELECT $$'$$ FROM secret_table -- '"},
+		{cc.DBTypePostgreSQL, "SELECT 1 /* /* */ ' */ FROM secret_table -- '"},
+		{cc.DBTypeMySQL, "SELECT * FROM student JOIN (secret_table s JOIN student t ON true) ON true"},
+		{cc.DBTypeMySQL, "SELECT * FROM student, ((secret_table))"},
+		{cc.DBTypePostgreSQL, "SELECT * FROM (student JOIN secret_table USING (id))"},
+		{cc.DBTypeMySQL, "SELECT * FROM student WHERE id IN (TABLE secret_table)"},
+		{cc.DBTypeMySQL, "SELECT * FROM student UNION TABLE secret_table"},
+	}
+
+	for _, c := range cases {
+		ret, err := classifySQL(c.query, c.dbType)
+		if err != nil {
+			continue
+		}
+
+		if !ret.ReadOnly || !hasTable(ret.Tables, "secret_table") {
+			t.Errorf("db type %d, query %q: secret_table is hidden, tables=%v", c.dbType, c.query, ret.Tables)
+		}
+	}
+}
+
+func TestClassifySQLTables(t *testing.T) {
+	cases := []struct {
+		dbType int
+		query  string
+		tables []string
+	}{
+		{cc.DBTypeMySQL, "SELECT a FROM t1 JOIN db.t2 ON t1.id = t2.id WHERE b = 'x''y'", []string{"t1", "db.t2"}},
+		{cc.DBTypeMySQL, `SELECT 'a\\' FROM t1 # comment`, []string{"t1"}},
+		{cc.DBTypeMySQL, "SELECT 1 FROM t1 --x", []string{"t1"}},
+		{cc.DBTypePostgreSQL, "SELECT $tag$it's$tag$, $1 FROM t1", []string{"t1"}},
+		{cc.DBTypePostgreSQL, `SELECT E'a\'b' FROM t1`, []string{"t1"}},
+		{cc.DBTypeClickHouse, `SELECT 'a\'' FROM t1 -- '`, []string{"t1"}},
+		{cc.DBTypeMySQL, "SELECT * FROM t1 JOIN (t2 JOIN db.t3 ON t2.id = t3.id) ON true", []string{"t1", "t2", "db.t3"}},
+		{cc.DBTypeMySQL, "SELECT * FROM t1 WHERE id IN (TABLE t2)", []string{"t1", "t2"}},
+		{cc.DBTypeMySQL, "SELECT COUNT(*), CAST(a AS DECIMAL(10, 2)), IFNULL(b, 0) FROM t1 GROUP BY c", []string{"t1"}},
+		{cc.DBTypePostgreSQL, "WITH c (x) AS (SELECT a FROM t1) SELECT x, n FROM c, generate_series(1, 3) AS g(n)", []string{"t1"}},
+	}
+
+	for _, c := range cases {
+		ret, err := classifySQL(c.query, c.dbType)
+		if err != nil {
+			t.Errorf("db type %d, query %q: %v", c.dbType, c.query, err)
+			continue
+		}
+
+		var tables []string
+		for _, name := range ret.Tables {
+			tables = append(tables, strings.Join(name, "."))
+		}
+
+		if !ret.ReadOnly || strings.Join(tables, ",") != strings.Join(c.tables, ",") {
+			t.Errorf("db type %d, query %q: tables=%v, want %v", c.dbType, c.query, tables, c.tables)
+		}
+	}
+}
+
+func TestClassifySQLReject(t *testing.T) {
+	cases := []struct {
+		dbType int
+		query  string
+	}{
+		{cc.DBTypeMySQL, "SELECT 1 FROM t1; DROP TABLE t1"},
+		{cc.DBTypeMySQL, "SELECT /*! 1 FROM secret_table */ 1"},
+		{cc.DBTypeMySQL, `SELECT "a\"" FROM t1`},
+		{cc.DBTypePostgreSQL, "SELECT $$a FROM t1"},
+
+		// 无法解析的表项、访问外部数据的表函数
+		{cc.DBTypeMySQL, "SELECT * FROM 'secret_table'"},
+		{cc.DBTypeClickHouse, "SELECT * FROM remote('127.0.0.1', db, secret_table)"},
+		{cc.DBTypeClickHouse, "SELECT * FROM file('/etc/passwd', 'LineAsString')"},
+		{cc.DBTypeClickHouse, "SELECT * FROM url('http://127.0.0.1/', 'CSV')"},
+		{cc.DBTypeClickHouse, "SELECT * FROM t1 JOIN mysql('127.0.0.1:3306', 'db', 'secret_table', 'u', 'p') USING (id)"},
+		{cc.DBTypePostgreSQL, "SELECT * FROM dblink('dbname=db', 'SELECT * FROM secret_table') AS t(a int)"},
+
+		// 不在白名单中的函数
+		{cc.DBTypeMySQL, "SELECT LOAD_FILE('/etc/passwd') FROM t1"},
+		{cc.DBTypeMySQL, "SELECT GET_LOCK('a', 10) FROM t1"},
+		{cc.DBTypeMySQL, "SELECT * FROM t1 WHERE SLEEP(10)"},
+		{cc.DBTypeMySQL, "SELECT my_func(a) FROM t1"},
+		{cc.DBTypeMySQL, "SELECT db.my_func(a) FROM t1"},
+		{cc.DBTypePostgreSQL, "SELECT pg_read_file('/etc/passwd')"},
+		{cc.DBTypePostgreSQL, "SELECT query_to_xml('SELECT * FROM secret_table', true, true, '')"},
+		{cc.DBTypePostgreSQL, "SELECT setval('seq', 1) FROM t1"},
+		{cc.DBTypePostgreSQL, "SELECT pg_terminate_backend(1) FROM t1"},
+		{cc.DBTypePostgreSQL, "SELECT pg_catalog.count(1) FROM t1"},
+		{cc.DBTypePostgreSQL, `SELECT "pg_sleep"(1) FROM t1`},
+		{cc.DBTypePostgreSQL, "WITH pg_sleep AS (SELECT 1) SELECT pg_sleep(5) AS x FROM pg_sleep"},
+	}
+
+	for _, c := range cases {
+		if _, err := classifySQL(c.query, c.dbType); err == nil {
+			t.Errorf("db type %d, query %q: should be rejected", c.dbType, c.query)
+		}
+	}
+}
+
+func hasTable(tables [][]string, name string) bool {
+	for _, t := range tables {
+		if t[len(t)-1] == name {
+			return true
+		}
+	}
+
+	return false
+}
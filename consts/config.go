@@ -18,3 +18,12 @@ const (
 	//DBConfigName 配置库名
 	DBConfigName = "mysql.local.server"
 )
+
+// 配置数据源类型
+const (
+	ConfigSourceDB   = "db"   // 配置库 DBConfigName
+	ConfigSourceFile = "file" // 本地 yaml/json 配置目录
+)
+
+// NotifyStoreMemory 进程内配置变更通知通道
+const NotifyStoreMemory = "memory"
@@ -43,3 +43,53 @@ const ( //是否强制签名
 	WorkspaceEnforceSignNo  = 0
 	WorkspaceEnforceSignYes = 1
 )
+
+// FrameTypeEncryptGCM rpc AES-GCM 加密帧，帧头与 codec.EncryptFrameHead 相同，帧体为 12 字节随机 nonce + 密文，
+// 帧头作为附加认证数据。请求为该类型时响应同样以该类型加密，旧版 AES-CBC 加密帧（codec.FrameTypeEncrypt）的响应为明文
+const FrameTypeEncryptGCM = 3
+
+// SignPrefixBearer http Authorization: Bearer <jwt> 认证时，编解码器将 token 加上该前缀写入请求头 sign
+const SignPrefixBearer = "bearer:"
+
+const ( //是否禁止 md5 签名
+	ForbidMD5No  = 0
+	ForbidMD5Yes = 1
+)
+
+const ( // 应用状态
+	AppStatusNormal  = 1 // 正常
+	AppStatusOffline = 2 // 下线
+)
+
+const ( // 应用秘钥状态
+	SecretStatusNormal  = 1 // 正常
+	SecretStatusOffline = 2 // 下线
+)
+
+const ( // 表插件状态
+	TablePluginStatusNormal  = 1 // 启用
+	TablePluginStatusDisable = 2 // 停用
+)
+
+const ( // 越权列处理策略
+	ColumnPolicyReject = 1 // 拒绝请求
+	ColumnPolicyStrip  = 2 // 剔除越权的查询列、写入列
+)
+
+const ( // 限流规则状态
+	RateLimitStatusNormal  = 1 // 正常
+	RateLimitStatusOffline = 2 // 下线
+)
+
+const ( // 表别名状态
+	TableAliasStatusNormal  = 1 // 正常
+	TableAliasStatusOffline = 2 // 下线
+)
+
+const ( // 限流范围
+	RateLimitLocal  = 1 // 单实例限流
+	RateLimitShared = 2 // 集群限流（QPS 通过共享计数器统计）
+)
+
+// SignVersionHMAC 客户端版本（请求头 version）不低于该版本时签名为 HMAC-SHA256，低于时为旧版 md5 签名
+const SignVersionHMAC = 2
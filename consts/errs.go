@@ -0,0 +1,32 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consts
+
+const ( // 服务端错误码
+	ErrQueryCanceled  = 2001 // 请求超时或被取消，执行单元未执行
+	ErrRequestExpired = 2002 // 请求时间戳超出允许的时钟偏差
+	ErrRequestReplay  = 2003 // 重放请求
+	ErrNonceStore     = 2004 // nonce 存储异常
+	ErrRowFilterParse = 2005 // 行级过滤条件解析失败
+	ErrRateLimit      = 2006 // 超出应用的 QPS 或并发限制
+	ErrIPNotAllowed   = 2007 // 客户端 ip 不在应用的 ip 白名单中
+	ErrAllowIPParse   = 2008 // ip 白名单解析失败
+	ErrAudit          = 2009 // 写操作审计记录失败
+	ErrConfigSync     = 2010 // 配置同步失败
+	ErrConfigSnapshot = 2011 // 本地配置快照读写失败
+	ErrSchemaFetch    = 2012 // 表结构拉取失败
+	ErrSchemaCheck    = 2013 // 执行单元校验失败，列不存在或值类型与列类型不符
+	ErrNotAdmin       = 2014 // appid 不在管理接口的 admin_appids 中
+)
@@ -5,7 +5,7 @@ go 1.19
 require (
 	github.com/go-sql-driver/mysql v1.7.1 // indirect
 	github.com/golang/protobuf v1.5.3
-	github.com/gomodule/redigo v1.8.9 // indirect
+	github.com/gomodule/redigo v1.8.9
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/olivere/elastic v6.2.37+incompatible // indirect
@@ -38,9 +38,9 @@ require (
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.2 // indirect
-	github.com/natefinch/lumberjack v2.0.0+incompatible // indirect
-	github.com/olivere/elastic/v6 v6.2.1 // indirect
-	github.com/olivere/elastic/v7 v7.0.32 // indirect
+	github.com/natefinch/lumberjack v2.0.0+incompatible
+	github.com/olivere/elastic/v6 v6.2.1
+	github.com/olivere/elastic/v7 v7.0.32
 	github.com/paulmach/orb v0.10.0 // indirect
 	github.com/pierrec/lz4/v4 v4.1.18 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
@@ -0,0 +1,205 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/metrics"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+var limiters sync.Map // 限流器，key 为限流规则 *table.TblRateLimit，规则被修改（热更新）之后为新的记录，对应新的限流器
+
+func init() {
+	table.OnPublish(prune)
+}
+
+// AcquireApp 应用维度限流（tbl_rate_limit 中 table_id 为 0 且 op 为空的规则），在解析请求之前执行。
+// 获取成功时返回 release，请求结束时必须调用以释放并发数。
+func AcquireApp(ctx context.Context, appid uint64) (release func(), err error) {
+	return acquire(ctx, appid, func(rule *table.TblRateLimit) bool {
+		return rule.TableId == 0 && rule.Op == ""
+	})
+}
+
+// AcquireTable 表、操作维度限流（tbl_rate_limit 中指定了 table_id 或 op 的规则），在执行单元执行之前执行。
+// 获取成功时返回 release，执行单元结束时必须调用以释放并发数。
+func AcquireTable(ctx context.Context, appid uint64, tableID int, op string) (release func(), err error) {
+	return acquire(ctx, appid, func(rule *table.TblRateLimit) bool {
+		if rule.TableId == 0 && rule.Op == "" {
+			return false
+		}
+
+		return (rule.TableId == 0 || rule.TableId == tableID) && (rule.Op == "" || rule.Op == op)
+	})
+}
+
+func acquire(ctx context.Context, appid uint64, match func(*table.TblRateLimit) bool) (func(), error) {
+	var acquired []*limiter
+
+	release := func() {
+		for _, l := range acquired {
+			l.release()
+		}
+	}
+
+	for _, rule := range table.Snap(ctx).GetRateLimits(appid) {
+		if !match(rule) {
+			continue
+		}
+
+		l := getLimiter(rule)
+
+		err := l.acquire(ctx)
+		if err != nil {
+			release()
+			metrics.IncrCounter("RateLimitReject", 1)
+			return nil, err
+		}
+
+		acquired = append(acquired, l)
+	}
+
+	return release, nil
+}
+
+// getLimiter 获取规则对应的限流器，并发请求通过 LoadOrStore 使用同一个限流器
+func getLimiter(rule *table.TblRateLimit) *limiter {
+	if v, ok := limiters.Load(rule); ok {
+		return v.(*limiter)
+	}
+
+	v, _ := limiters.LoadOrStore(rule, newLimiter(rule))
+	return v.(*limiter)
+}
+
+// prune 快照发布之后删除已被修改、删除的规则的限流器。固定了旧快照的请求仍持有旧限流器，释放不受影响
+func prune(s *table.Snapshot) {
+	limiters.Range(func(k, _ interface{}) bool {
+		rule := k.(*table.TblRateLimit)
+
+		for _, r := range s.GetRateLimits(rule.Appid) {
+			if r == rule {
+				return true
+			}
+		}
+
+		limiters.Delete(rule)
+		return true
+	})
+}
+
+// limiter 单条限流规则的限流器
+type limiter struct {
+	rule     *table.TblRateLimit
+	bucket   *tokenBucket
+	inflight int64
+}
+
+func newLimiter(rule *table.TblRateLimit) *limiter {
+	l := limiter{rule: rule}
+
+	if rule.QPS > 0 {
+		burst := rule.Burst
+		if burst <= 0 {
+			burst = rule.QPS
+		}
+
+		l.bucket = newTokenBucket(float64(rule.QPS), float64(burst))
+	}
+
+	return &l
+}
+
+func (l *limiter) acquire(ctx context.Context) error {
+	rule := l.rule
+
+	if rule.MaxInflight > 0 {
+		if atomic.AddInt64(&l.inflight, 1) > int64(rule.MaxInflight) {
+			atomic.AddInt64(&l.inflight, -1)
+			return errs.Newf(consts.ErrRateLimit, "appid [%d] exceeds max inflight %d of rate limit rule %d",
+				rule.Appid, rule.MaxInflight, rule.Id)
+		}
+	}
+
+	if l.bucket != nil && !l.allow(ctx) {
+		if rule.MaxInflight > 0 {
+			atomic.AddInt64(&l.inflight, -1)
+		}
+
+		return errs.Newf(consts.ErrRateLimit, "appid [%d] exceeds qps %d of rate limit rule %d",
+			rule.Appid, rule.QPS, rule.Id)
+	}
+
+	return nil
+}
+
+func (l *limiter) allow(ctx context.Context) bool {
+	if l.rule.Scope == consts.RateLimitShared && sharedCounter != "" {
+		return sharedAllow(ctx, l.rule)
+	}
+
+	return l.bucket.allow(time.Now())
+}
+
+func (l *limiter) release() {
+	if l.rule.MaxInflight > 0 {
+		atomic.AddInt64(&l.inflight, -1)
+	}
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶容量
+	tokens float64 // 当前令牌数
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
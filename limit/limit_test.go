@@ -0,0 +1,107 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+
+	b := newTokenBucket(10, 3)
+	b.last = now
+
+	for i := 0; i < 3; i++ {
+		if !b.allow(now) {
+			t.Fatalf("request %d within burst is rejected", i)
+		}
+	}
+
+	if b.allow(now) {
+		t.Error("request exceeds burst is allowed")
+	}
+
+	// 每 100ms 生成 1 个令牌
+	next := now.Add(100 * time.Millisecond)
+	if !b.allow(next) {
+		t.Error("token is not refilled")
+	}
+
+	if b.allow(next) {
+		t.Error("refilled more tokens than rate")
+	}
+
+	// 时钟回退不生成令牌
+	if b.allow(now) {
+		t.Error("clock going backwards refilled tokens")
+	}
+
+	// 长时间空闲最多累积 burst 个令牌
+	later := next.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if !b.allow(later) {
+			t.Fatalf("request %d after idle is rejected", i)
+		}
+	}
+
+	if b.allow(later) {
+		t.Error("tokens accumulated beyond burst")
+	}
+}
+
+func TestLimiterMaxInflight(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(&table.TblRateLimit{Id: 1, Appid: 1, MaxInflight: 2, Scope: consts.RateLimitLocal})
+
+	for i := 0; i < 2; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatalf("acquire %d error: %v", i, err)
+		}
+	}
+
+	if err := l.acquire(ctx); errs.Code(err) != consts.ErrRateLimit {
+		t.Fatalf("acquire over max inflight, err=%v, want code %d", err, consts.ErrRateLimit)
+	}
+
+	l.release()
+	if err := l.acquire(ctx); err != nil {
+		t.Errorf("acquire after release error: %v", err)
+	}
+}
+
+// qps 超限时归还已占用的并发数
+func TestLimiterQPSReleasesInflight(t *testing.T) {
+	ctx := context.Background()
+	l := newLimiter(&table.TblRateLimit{Id: 2, Appid: 1, QPS: 1, MaxInflight: 5, Scope: consts.RateLimitLocal})
+
+	if err := l.acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.acquire(ctx); errs.Code(err) != consts.ErrRateLimit {
+		t.Fatalf("acquire over qps, err=%v, want code %d", err, consts.ErrRateLimit)
+	}
+
+	if l.inflight != 1 {
+		t.Errorf("inflight=%d, want 1", l.inflight)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package limit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/orm/database/redis"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+const sharedPrefix = "horm_rate_limit_"
+
+var sharedCounter string // 集群限流共享计数器所在 redis 库名，计数时从请求固定的快照获取库信息
+
+// SetSharedCounter 设置集群限流共享计数器，store 为 tbl_db 中配置的 redis 库名，为空时集群限流规则退化为单实例限流
+func SetSharedCounter(store string) error {
+	if store != "" && getCounter(table.Current(), store) == nil {
+		return errs.Newf(consts.ErrRateLimit, "rate limit shared counter [%s] is not a redis db in tbl_db", store)
+	}
+
+	sharedCounter = store
+	return nil
+}
+
+// sharedAllow 集群限流，按秒计数，每秒请求数不超过 max(qps, burst)。共享计数器异常时放行，避免 redis 故障导致服务不可用。
+func sharedAllow(ctx context.Context, rule *table.TblRateLimit) bool {
+	sec := time.Now().Unix()
+	key := fmt.Sprintf("%s%d_%d", sharedPrefix, rule.Id, sec)
+
+	db := getCounter(table.Snap(ctx), sharedCounter)
+	if db == nil {
+		log.Errorf(ctx, consts.ErrRateLimit, "rate limit shared counter [%s] is not a redis db in config version %d",
+			sharedCounter, table.Snap(ctx).Version)
+		metrics.IncrCounter("RateLimitSharedFail", 1)
+		return true
+	}
+
+	query := redis.Redis{Cmd: cc.OpIncr, Key: key, Addr: db.Addr}
+
+	ret, _, _, err := query.Query(ctx)
+	if err != nil {
+		log.Errorf(ctx, consts.ErrRateLimit, "rate limit rule %d shared counter incr error: %v", rule.Id, err)
+		metrics.IncrCounter("RateLimitSharedFail", 1)
+		return true
+	}
+
+	count, _ := types.InterfaceToInt64(ret)
+	if count == 1 {
+		expire := redis.Redis{Cmd: cc.OpExpire, Key: key, Args: []interface{}{2}, Addr: db.Addr}
+		_, _, _, _ = expire.Query(ctx)
+	}
+
+	limit := rule.QPS
+	if rule.Burst > limit {
+		limit = rule.Burst
+	}
+
+	return count <= int64(limit)
+}
+
+// getCounter 从快照获取共享计数器所在 redis 库，库不存在或不是 redis 时返回 nil
+func getCounter(snap *table.Snapshot, name string) *obj.TblDB {
+	db := snap.GetDBByName(name)
+	if db == nil || db.Addr == nil || db.Addr.Type != cc.DBTypeRedis {
+		return nil
+	}
+
+	return db
+}
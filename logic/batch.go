@@ -0,0 +1,449 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logic
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/common/util"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/model/table"
+)
+
+const (
+	esBatchSize   = 10000 // elastic 批量查询的 size，与 index.max_result_window 默认值相同
+	esDefaultSize = 10    // elastic 未指定 size 时返回的记录数
+)
+
+var columnRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// subBatchKey 子查询批量执行结果在 context 中的 key
+type subBatchKey struct{}
+
+// batchResult 批量执行之后，拆分到单个子查询节点的执行结果
+type batchResult struct {
+	result interface{}
+	isNil  bool
+}
+
+// subBatch 子查询执行单元的批量执行结果，key 为每条父查询结果对应的子查询首节点
+type subBatch map[*obj.Tree]*batchResult
+
+// batchPlan 子查询批量执行计划
+type batchPlan struct {
+	parent *obj.Tree              // 父查询节点
+	sub    *obj.Tree              // 子查询执行单元（Real 节点）
+	dbType int                    // 数据库类型
+	where  string                 // 引用父查询结果的 where key（带 @）
+	column string                 // 引用父查询结果的列名
+	keys   map[*obj.Tree]string   // 子查询首节点 => 引用值（转为字符串，用于拆分批量结果）
+	values []interface{}          // 去重之后的引用值
+	index  map[string]int         // 引用值 => values 下标
+	rows   map[string][]types.Map // 引用值 => 批量结果中的记录
+}
+
+// batchSubQuery 父查询返回多条结果时，每条结果都会生成一个子查询节点并执行一次查询（N+1 问题）。
+// 对于仅通过 @{...} 引用父查询结果字段的子查询执行单元，将 N 次查询合并为一次批量查询（sql IN、elastic terms、
+// redis MGET），再将批量结果按引用值拆分到各个子查询节点，返回携带批量结果的 context。批量查询失败时，退化为逐条执行。
+func batchSubQuery(ctx context.Context, appid uint64, node *obj.Tree) context.Context {
+	if node.InTrans || len(node.SubQuery) < 2 {
+		return ctx
+	}
+
+	batches := map[*obj.Tree]subBatch{}
+
+	for sub := node.GetReal().Sub; sub != nil; sub = sub.Next {
+		plan := newBatchPlan(ctx, node, sub)
+		if plan == nil {
+			continue
+		}
+
+		batch, err := plan.execute(ctx, appid)
+		if err != nil {
+			log.Debugf(ctx, "[%s] batch sub query failed, execute one by one: %v", sub.GetPath(), err)
+			continue
+		}
+
+		batches[sub] = batch
+	}
+
+	if len(batches) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, subBatchKey{}, batches)
+}
+
+// getBatchResult 获取子查询节点的批量执行结果，未批量执行返回 nil
+func getBatchResult(ctx context.Context, node *obj.Tree) *batchResult {
+	if !node.IsSub {
+		return nil
+	}
+
+	batches, _ := ctx.Value(subBatchKey{}).(map[*obj.Tree]subBatch)
+	if len(batches) == 0 {
+		return nil
+	}
+
+	batch, ok := batches[node.GetReal()]
+	if !ok {
+		return nil
+	}
+
+	head := node
+	for head.Last != nil {
+		head = head.Last
+	}
+
+	return batch[head]
+}
+
+// newBatchPlan 生成子查询批量执行计划，不满足批量执行条件时返回 nil。
+// 满足条件的执行单元：非事务、表未配置插件（插件可能依赖单条查询的请求参数）、仅有一个引用且引用的是父查询结果的字段；
+// sql 为不分页、不分组、不联表的 find/find_all，where 顶层有且仅有一个引用且 key 为列名，引用值均为整数
+// （字符串在库中的比较受排序规则、类型转换影响，拆分结果时无法与库的比较结果一致）；elastic 为不分页、不滚动、
+// 没有附加参数（collapse、highlight 等）的 find/find_all，where 条件与 sql 相同；redis 为 key 引用父查询结果的 get。
+func newBatchPlan(ctx context.Context, parent, sub *obj.Tree) *batchPlan {
+	if sub.IsTransaction() || len(table.Snap(ctx).Plugins().TablePlugins(sub.GetTable().Id)) > 0 {
+		return nil
+	}
+
+	unit := sub.GetUnit()
+
+	referers := unitReferers(unit)
+	if len(referers) != 1 {
+		return nil
+	}
+
+	refererPath, field := pathAndField(referers[0])
+	if field == "" || absRefererPath(sub.GetPath(), refererPath) != parent.GetReal().GetPath() {
+		return nil
+	}
+
+	plan := batchPlan{
+		parent: parent,
+		sub:    sub,
+		dbType: sub.GetDB().Addr.Type,
+	}
+
+	switch plan.dbType {
+	case cc.DBTypeMySQL, cc.DBTypePostgreSQL, cc.DBTypeClickHouse,
+		cc.DBTypeOracle, cc.DBTypeDB2, cc.DBTypeSQLite:
+		if (sub.GetOp() != cc.OpFind && sub.GetOp() != cc.OpFindAll) || unit.Query != "" ||
+			len(unit.Group) > 0 || len(unit.Having) > 0 || len(unit.Join) > 0 ||
+			unit.Page > 0 || unit.Size > 0 || unit.From > 0 {
+			return nil
+		}
+
+		if !plan.whereColumn(unit) {
+			return nil
+		}
+	case cc.DBTypeElastic:
+		if (sub.GetOp() != cc.OpFind && sub.GetOp() != cc.OpFindAll) || unit.Query != "" ||
+			len(unit.Params) > 0 || unit.Scroll != nil || unit.Page > 0 || unit.Size > 0 || unit.From > 0 {
+			return nil
+		}
+
+		if !plan.whereColumn(unit) {
+			return nil
+		}
+	case cc.DBTypeRedis:
+		if sub.GetOp() != cc.OpGet || !argHasReferer(unit.Key) {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	plan.keys = make(map[*obj.Tree]string, len(parent.SubQuery))
+	plan.index = map[string]int{}
+
+	for _, head := range parent.SubQuery {
+		value, err := getFieldValue(field, head.ParentRet)
+		if err != nil {
+			return nil
+		}
+
+		value = types.Indirect(value)
+
+		var key string
+		var ok bool
+		if plan.dbType == cc.DBTypeRedis {
+			if !isScalar(value) {
+				return nil
+			}
+			key = batchKey(value)
+		} else if key, ok = intKey(value, false); !ok {
+			return nil
+		}
+		if _, ok := plan.index[key]; !ok {
+			plan.index[key] = len(plan.values)
+			plan.values = append(plan.values, value)
+		}
+
+		plan.keys[head] = key
+	}
+
+	return &plan
+}
+
+// whereColumn 获取 where 顶层唯一引用父查询结果的列，没有、有多个引用或者 key 不是列名时返回 false
+func (p *batchPlan) whereColumn(unit *proto.Unit) bool {
+	var refererKeys []string
+	for k := range unit.Where {
+		if types.FirstWord(util.RemoveComments(k), 1) == "@" {
+			refererKeys = append(refererKeys, k)
+		}
+	}
+
+	if len(refererKeys) != 1 {
+		return false
+	}
+
+	p.where, p.column = refererKeys[0], strings.TrimSpace(refererKeys[0][1:])
+
+	return columnRegexp.MatchString(p.column) && hasColumn(unit.Column, p.column)
+}
+
+// execute 执行批量查询，并将结果拆分到每条父查询结果对应的子查询节点
+func (p *batchPlan) execute(ctx context.Context, appid uint64) (subBatch, error) {
+	unit := *p.sub.GetUnit()
+	property := *p.sub.Property
+
+	if p.dbType == cc.DBTypeRedis {
+		keys := make([]interface{}, len(p.values))
+		for i, value := range p.values {
+			keys[i] = unit.Prefix + batchKey(value)
+		}
+
+		unit.Prefix = ""
+		unit.Key = keys[0].(string)
+		unit.Args = keys[1:]
+		unit.Op, property.Op = cc.OpMGet, cc.OpMGet
+	} else {
+		where := make(map[string]interface{}, len(unit.Where))
+		for k, v := range unit.Where {
+			if k != p.where {
+				where[k] = v
+			}
+		}
+
+		where[p.column] = p.values
+
+		unit.Where = where
+		unit.Op, property.Op = cc.OpFindAll, cc.OpFindAll
+
+		if p.dbType == cc.DBTypeElastic { // 未指定 size 时 elastic 只返回 10 条，批量查询需指定 size
+			unit.Size = esBatchSize
+		}
+	}
+
+	batchNode := &obj.Tree{
+		Name:     p.sub.Name,
+		Parent:   p.parent,
+		Unit:     &unit,
+		Property: &property,
+	}
+
+	ret, _, isNil, err := limitQuery(ctx, appid, batchNode)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.dbType == cc.DBTypeRedis {
+		return p.splitValues(ret, isNil)
+	}
+
+	return p.splitRows(ret, isNil)
+}
+
+// splitRows 将 sql、elastic 批量查询结果按引用列的值拆分，每个引用值的记录保持批量结果中的顺序。
+// elastic 逐条执行的 find_all 最多返回 10 条，拆分结果同样每个引用值最多保留 10 条；批量结果达到 esBatchSize 时
+// 可能有记录未返回，返回错误退化为逐条执行
+func (p *batchPlan) splitRows(ret interface{}, isNil bool) (subBatch, error) {
+	p.rows = map[string][]types.Map{}
+
+	if !isNil && ret != nil {
+		rv := reflect.ValueOf(ret)
+		if rv.Kind() != reflect.Slice {
+			return nil, errs.Newf(errs.ErrRefererResultType, "batch result type %T is not slice", ret)
+		}
+
+		if p.dbType == cc.DBTypeElastic && rv.Len() >= esBatchSize {
+			return nil, errs.Newf(errs.ErrRefererResultType, "elastic batch result reach size %d", esBatchSize)
+		}
+
+		for i := 0; i < rv.Len(); i++ {
+			row, err := types.ToMap(types.Interface(rv.Index(i)), "")
+			if err != nil {
+				return nil, err
+			}
+
+			value, ok := row[p.column]
+			if !ok {
+				return nil, errs.Newf(errs.ErrRefererFieldNotExist, "batch result has no column %s", p.column)
+			}
+
+			key, ok := intKey(types.Indirect(value), true)
+			if !ok {
+				return nil, errs.Newf(errs.ErrRefererResultType,
+					"batch result column %s value %v is not integer", p.column, value)
+			}
+
+			if p.dbType == cc.DBTypeElastic && len(p.rows[key]) >= esDefaultSize {
+				continue
+			}
+
+			p.rows[key] = append(p.rows[key], row)
+		}
+	}
+
+	batch := make(subBatch, len(p.keys))
+	for head, key := range p.keys {
+		rows := p.rows[key]
+		switch {
+		case len(rows) == 0:
+			batch[head] = &batchResult{isNil: true}
+		case p.sub.GetOp() == cc.OpFind:
+			batch[head] = &batchResult{result: map[string]interface{}(rows[0])}
+		default:
+			result := make([]map[string]interface{}, len(rows))
+			for i, row := range rows {
+				result[i] = row
+			}
+			batch[head] = &batchResult{result: result}
+		}
+	}
+
+	return batch, nil
+}
+
+// splitValues 将 redis MGET 结果按 key 拆分，MGET 无法区分空字符串与不存在的 key，统一当作不存在处理。
+func (p *batchPlan) splitValues(ret interface{}, isNil bool) (subBatch, error) {
+	values, _ := ret.([]string)
+	if !isNil && len(values) != len(p.values) {
+		return nil, errs.Newf(errs.ErrRefererResultType,
+			"mget return %d values, but request %d keys", len(values), len(p.values))
+	}
+
+	batch := make(subBatch, len(p.keys))
+	for head, key := range p.keys {
+		if isNil || values[p.index[key]] == "" {
+			batch[head] = &batchResult{isNil: true}
+		} else {
+			batch[head] = &batchResult{result: values[p.index[key]]}
+		}
+	}
+
+	return batch, nil
+}
+
+// hasColumn 查询结果是否包含列
+func hasColumn(columns []string, column string) bool {
+	if len(columns) == 0 {
+		return true
+	}
+
+	for _, c := range columns {
+		if c == column || c == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isScalar 是否为可用于批量查询的标量值
+func isScalar(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+
+	if _, ok := value.([]byte); ok {
+		return true
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		return false
+	default:
+		return true
+	}
+}
+
+// intKey 将整数引用值统一转为十进制字符串，用于拆分批量结果。parseString 为 true 时，
+// 接受库驱动以字符串返回的整数（批量结果中的列值），父查询结果中的字符串引用值不批量执行
+func intKey(value interface{}, parseString bool) (string, bool) {
+	switch v := value.(type) {
+	case []byte:
+		return intKey(string(v), parseString)
+	case stdjson.Number: // elastic 结果中的数值
+		return intKey(string(v), parseString)
+	case string:
+		if !parseString {
+			return "", false
+		}
+
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), true
+		}
+
+		if u, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64); err == nil {
+			return strconv.FormatUint(u, 10), true
+		}
+
+		return "", false
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), true
+	case reflect.Float32, reflect.Float64: // json 解析的数值，仅接受可精确表示的整数
+		f := rv.Float()
+		if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+			return "", false
+		}
+		return strconv.FormatInt(int64(f), 10), true
+	default:
+		return "", false
+	}
+}
+
+// batchKey 将引用值统一转为字符串，用于拆分批量结果
+func batchKey(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logic
+
+import (
+	stdjson "encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+)
+
+// 批量结果拆分到各子查询节点后，parseCompResult 的输出与逐条执行相同
+func TestSplitRowsMatchesPerRow(t *testing.T) {
+	parentRets := []map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}, {"id": int64(1)}}
+
+	for _, dbType := range []int{cc.DBTypeMySQL, cc.DBTypeElastic} {
+		for _, op := range []string{cc.OpFind, cc.OpFindAll} {
+			rows := batchTestRows(dbType)
+
+			perRow := batchTestTree(op, parentRets)
+			for _, head := range perRow.SubQuery {
+				head.Result, head.IsNil = batchTestQuery(dbType, op, rows, head.ParentRet)
+				head.Finished = consts.QueryFinishedYes
+			}
+
+			batched := batchTestTree(op, parentRets)
+			plan := batchTestPlan(dbType, batched)
+
+			batch, err := plan.splitRows(rows, false)
+			if err != nil {
+				t.Fatalf("db type %d, op %s: split rows error: %v", dbType, op, err)
+			}
+
+			for _, head := range batched.SubQuery {
+				head.Result, head.IsNil = batch[head].result, batch[head].isNil
+				head.Finished = consts.QueryFinishedYes
+			}
+
+			want, got := parseCompResult(perRow), parseCompResult(batched)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("db type %d, op %s: batch result %v, per row result %v", dbType, op, got, want)
+			}
+		}
+	}
+}
+
+// elastic 批量结果达到 esBatchSize 时可能有记录未返回，不能拆分
+func TestSplitRowsElasticTruncated(t *testing.T) {
+	rows := make([]map[string]interface{}, esBatchSize)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"uid": stdjson.Number("1")}
+	}
+
+	plan := batchTestPlan(cc.DBTypeElastic, batchTestTree(cc.OpFindAll, []map[string]interface{}{{"id": int64(1)}}))
+
+	if _, err := plan.splitRows(rows, false); err == nil {
+		t.Errorf("truncated elastic batch result should not be split")
+	}
+}
+
+// batchTestRows 子查询表中的记录，uid 为 1 的记录超过 elastic 默认返回的条数，uid 为 3 的记录不存在
+func batchTestRows(dbType int) []map[string]interface{} {
+	var rows []map[string]interface{}
+
+	for i, uid := range []int64{1, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 2} {
+		var value interface{} = uid
+		if dbType == cc.DBTypeElastic {
+			value = stdjson.Number(strconv.FormatInt(uid, 10))
+		}
+
+		rows = append(rows, map[string]interface{}{"uid": value, "seq": i})
+	}
+
+	return rows
+}
+
+// batchTestQuery 模拟逐条执行子查询 where uid = @{id}，elastic 未指定 size 时最多返回 10 条
+func batchTestQuery(dbType int, op string,
+	rows []map[string]interface{}, parentRet interface{}) (interface{}, bool) {
+	want, _ := intKey(parentRet.(map[string]interface{})["id"], false)
+
+	var result []map[string]interface{}
+	for _, row := range rows {
+		if key, _ := intKey(row["uid"], true); key == want {
+			result = append(result, row)
+		}
+	}
+
+	if dbType == cc.DBTypeElastic && len(result) > esDefaultSize {
+		result = result[:esDefaultSize]
+	}
+
+	switch {
+	case len(result) == 0:
+		return nil, true
+	case op == cc.OpFind:
+		return result[0], false
+	default:
+		return result, false
+	}
+}
+
+// batchTestTree 父查询返回多条结果，每条结果生成一个子查询节点
+func batchTestTree(op string, parentRets []map[string]interface{}) *obj.Tree {
+	sub := &obj.Tree{Name: "user", Property: &obj.Property{Op: op, Name: "user", Key: "user"}}
+
+	parent := &obj.Tree{
+		Name:     "order",
+		Sub:      sub,
+		HasSub:   true,
+		Finished: consts.QueryFinishedYes,
+		Property: &obj.Property{Op: cc.OpFindAll, Name: "order", Key: "order"},
+	}
+
+	for _, ret := range parentRets {
+		parent.SubQuery = append(parent.SubQuery, &obj.Tree{
+			Name:      sub.Name,
+			IsSub:     true,
+			Real:      sub,
+			Parent:    parent,
+			ParentRet: ret,
+		})
+	}
+
+	return parent
+}
+
+func batchTestPlan(dbType int, parent *obj.Tree) *batchPlan {
+	plan := &batchPlan{
+		parent: parent,
+		sub:    parent.Sub,
+		dbType: dbType,
+		where:  "@uid",
+		column: "uid",
+		keys:   map[*obj.Tree]string{},
+		index:  map[string]int{},
+	}
+
+	for _, head := range parent.SubQuery {
+		value := head.ParentRet.(map[string]interface{})["id"]
+		key, _ := intKey(value, false)
+
+		if _, ok := plan.index[key]; !ok {
+			plan.index[key] = len(plan.values)
+			plan.values = append(plan.values, value)
+		}
+
+		plan.keys[head] = key
+	}
+
+	return plan
+}
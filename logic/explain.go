@@ -0,0 +1,297 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logic
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/proto"
+	pf "github.com/horm-database/common/proto/plugin"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/common/util"
+	"github.com/horm-database/orm/database/sql"
+	"github.com/horm-database/orm/obj"
+)
+
+// explainKey 解释模式在 context 中的 key
+type explainKey struct{}
+
+// ExplainUnit 执行单元解释结果
+type ExplainUnit struct {
+	Path      string        `json:"path"`                // 执行单元路径
+	Op        string        `json:"op"`                  // 操作
+	DB        string        `json:"db"`                  // 数据库名称
+	DBType    string        `json:"db_type"`             // 数据库类型
+	Tables    []string      `json:"tables"`              // 经插件处理之后最终访问的表（分表）
+	Statement string        `json:"statement,omitempty"` // 将要执行的 sql 语句或 redis 命令
+	Params    []interface{} `json:"params,omitempty"`    // sql 参数
+	Request   *pf.Request   `json:"request,omitempty"`   // 经插件处理之后的请求参数，elastic 等无法生成语句时可据此查看
+	Skipped   bool          `json:"skipped,omitempty"`   // 插件未走 db 查询，直接返回了结果（比如命中缓存）
+	Plugins   []string      `json:"plugins,omitempty"`   // 可能有副作用、解释模式未执行的插件，语句未经这些插件处理
+	Error     string        `json:"error,omitempty"`     // 错误信息
+}
+
+// Explain 解释请求，生成分析树并执行插件链，但不执行 db 查询，返回每个执行单元将要执行的语句、访问的表。
+// 插件链只执行声明了无副作用（plugin.ExplainSafe）的插件，其余插件跳过并在结果中列出。
+// 引用了其他执行单元结果的参数，以 @{...} 占位符展示。
+func Explain(ctx context.Context, head *proto.RequestHeader, units []*proto.Unit) ([]*ExplainUnit, error) {
+	tree := &obj.Tree{}
+	err := createTree(ctx, tree, nil, units, head)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*ExplainUnit{}
+	explain(context.WithValue(ctx, explainKey{}, true), head.Appid, tree, &ret)
+	return ret, nil
+}
+
+// isExplain 是否为解释模式
+func isExplain(ctx context.Context) bool {
+	ok, _ := ctx.Value(explainKey{}).(bool)
+	return ok
+}
+
+// explain 按顺序解释同层级所有执行单元，包含其事务、嵌套子查询下的执行单元
+func explain(ctx context.Context, appid uint64, node *obj.Tree, ret *[]*ExplainUnit) {
+	for ; node != nil; node = node.Next {
+		if node.IsTransaction() {
+			explain(ctx, appid, node.TransInfo.Trans, ret)
+			continue
+		}
+
+		*ret = append(*ret, explainNode(ctx, appid, node))
+
+		if node.Sub != nil {
+			explain(ctx, appid, node.Sub, ret)
+		}
+	}
+}
+
+// explainNode 解释单个执行单元
+func explainNode(ctx context.Context, appid uint64, node *obj.Tree) *ExplainUnit {
+	dbInfo := node.GetDB()
+
+	eu := &ExplainUnit{
+		Path:   node.GetPath(),
+		Op:     node.GetOp(),
+		DB:     dbInfo.Name,
+		DBType: cc.DBTypeDesc[dbInfo.Addr.Type],
+		Tables: node.Tables(),
+	}
+
+	ret, _, _, err := query(ctx, appid, node)
+	if err != nil {
+		eu.Error = err.Error()
+		return eu
+	}
+
+	stmt, ok := ret.(*ExplainUnit)
+	if !ok {
+		eu.Skipped = true
+		return eu
+	}
+
+	eu.Tables = stmt.Tables
+	eu.Statement = stmt.Statement
+	eu.Params = stmt.Params
+	eu.Request = stmt.Request
+	eu.Plugins = stmt.Plugins
+	return eu
+}
+
+// explainRequest 在 db 查询处生成将要执行的语句，替代实际查询，skipped 为解释模式跳过的插件
+func explainRequest(req *pf.Request, node *obj.Tree, skipped []string) *ExplainUnit {
+	eu := &ExplainUnit{
+		Tables:  req.Tables,
+		Request: req,
+		Plugins: skipped,
+	}
+
+	switch node.GetDB().Addr.Type {
+	case cc.DBTypeMySQL, cc.DBTypePostgreSQL, cc.DBTypeClickHouse,
+		cc.DBTypeOracle, cc.DBTypeDB2, cc.DBTypeSQLite:
+		eu.Statement, eu.Params = explainSQL(req, node)
+	case cc.DBTypeRedis:
+		eu.Statement = explainRedis(req)
+	}
+
+	return eu
+}
+
+// explainRedis 生成 redis 命令
+func explainRedis(req *pf.Request) string {
+	args := []interface{}{req.Prefix + req.Key}
+	if req.Field != "" {
+		args = append(args, req.Field)
+	}
+	if req.Val != nil {
+		args = append(args, req.Val)
+	}
+	args = append(args, req.Args...)
+
+	cmd := strings.Builder{}
+	cmd.WriteString(strings.ToUpper(req.Op))
+
+	for _, arg := range util.FormatArgs(args) {
+		cmd.WriteString(" ")
+		cmd.WriteString(fmt.Sprint(arg))
+	}
+
+	return cmd.String()
+}
+
+// explainSQL 生成 sql 语句及参数，原生 sql 直接返回，联表查询无法生成语句，返回空
+func explainSQL(req *pf.Request, node *obj.Tree) (string, []interface{}) {
+	if req.Query != "" {
+		return req.Query, req.Args
+	}
+
+	if len(req.Join) > 0 || len(req.Tables) == 0 {
+		return "", nil
+	}
+
+	dbType := node.GetDB().Addr.Type
+
+	statement := &sql.Statement{}
+	statement.SetDBType(dbType)
+	statement.SetColumn(req.Column)
+	statement.SetTable(req.Tables[0], node.Property.Alias)
+
+	switch req.Op {
+	case cc.OpInsert, cc.OpReplace:
+		datas := req.Datas
+		if len(req.Data) > 0 {
+			datas = append(datas, req.Data)
+		}
+		statement.SetMaps(datas)
+	case cc.OpUpdate:
+		statement.UpdateMap(req.Data)
+	}
+
+	statement.Where(dbType, req.Where)
+	statement.Group(req.Group)
+	statement.Having(dbType, req.Having)
+	statement.Order(req.Order)
+
+	var querySQL string
+
+	switch req.Op {
+	case cc.OpInsert:
+		querySQL = sql.InsertSQL(statement)
+	case cc.OpReplace:
+		querySQL = sql.ReplaceSQL(statement)
+	case cc.OpUpdate:
+		querySQL = sql.UpdateSQL(statement)
+	case cc.OpDelete:
+		querySQL = sql.DeleteSQL(statement)
+	case cc.OpFind:
+		querySQL = sql.FindSQL(statement) + pageClause(dbType, 1, 0)
+	case cc.OpFindAll:
+		from := req.From
+		if req.Page > 0 {
+			from = uint64((req.Page - 1) * req.Size)
+		}
+
+		querySQL = sql.FindSQL(statement) + pageClause(dbType, req.Size, from)
+	default:
+		return "", nil
+	}
+
+	return strings.TrimSpace(querySQL), statement.GetParams()
+}
+
+// pageClause 生成分页子句，oracle、db2 使用 OFFSET ... ROWS FETCH NEXT ... ROWS ONLY
+func pageClause(dbType int, limit int, offset uint64) string {
+	var clause string
+
+	switch dbType {
+	case cc.DBTypeOracle, cc.DBTypeDB2:
+		if offset > 0 {
+			clause = fmt.Sprintf(" OFFSET %d ROWS", offset)
+		}
+
+		if limit > 0 {
+			clause += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", limit)
+		}
+	default:
+		if limit > 0 {
+			clause = fmt.Sprintf(" LIMIT %d", limit)
+		} else if offset > 0 && dbType == cc.DBTypeMySQL { // mysql 的 OFFSET 必须与 LIMIT 一起使用
+			clause = " LIMIT 18446744073709551615"
+		}
+
+		if offset > 0 {
+			clause += fmt.Sprintf(" OFFSET %d", offset)
+		}
+	}
+
+	return clause
+}
+
+// explainReferHandle 解释模式下被引用的执行单元并未执行，将引用替换为 @{...} 占位符
+func explainReferHandle(unit *proto.Unit) (where, having, data map[string]interface{},
+	datas []map[string]interface{}, key, field string, val interface{}, args []interface{}) {
+	where = placeholderMap(unit.Where)
+	having = placeholderMap(unit.Having)
+	data = placeholderMap(unit.Data)
+
+	if len(unit.Datas) > 0 {
+		datas = make([]map[string]interface{}, len(unit.Datas))
+		for k, tmp := range unit.Datas {
+			datas[k] = placeholderMap(tmp)
+		}
+	}
+
+	return where, having, data, datas, unit.Key, unit.Field, unit.Val, unit.Args
+}
+
+// placeholderMap 将 map 中的引用替换为 @{...} 占位符
+func placeholderMap(data map[string]interface{}) map[string]interface{} {
+	if len(data) == 0 {
+		return data
+	}
+
+	result := make(map[string]interface{}, len(data))
+
+	for k, v := range data {
+		if types.FirstWord(util.RemoveComments(k), 1) == "@" {
+			result[k[1:]] = fmt.Sprintf("@{%v}", v)
+			continue
+		}
+
+		switch rv := v.(type) {
+		case map[string]interface{}:
+			result[k] = placeholderMap(rv)
+		case []interface{}:
+			items := make([]interface{}, len(rv))
+			for i, item := range rv {
+				if mv, ok := item.(map[string]interface{}); ok {
+					items[i] = placeholderMap(mv)
+				} else {
+					items[i] = item
+				}
+			}
+			result[k] = items
+		default:
+			result[k] = v
+		}
+	}
+
+	return result
+}
@@ -28,17 +28,30 @@ import (
 	"github.com/horm-database/orm/obj"
 	"github.com/horm-database/server/consts"
 	"github.com/horm-database/server/model/table"
+	"github.com/horm-database/server/schema"
 )
 
+const defaultParallelNum = 16 // 请求默认的最大并发查询数
+
+var parallelNum = defaultParallelNum
+
+// SetParallelNum 设置单个请求（包括嵌套子查询）同时执行的最大查询数，num <= 0 时使用默认值
+func SetParallelNum(num int) {
+	if num <= 0 {
+		num = defaultParallelNum
+	}
+	parallelNum = num
+}
+
 // Parse 请求解析
 func Parse(ctx context.Context, head *proto.RequestHeader, units []*proto.Unit) (resp *proto.QueryResp, err error) {
 	tree := &obj.Tree{}
-	err = createTree(tree, nil, units, head)
+	err = createTree(ctx, tree, nil, units, head)
 	if err != nil {
 		return nil, err
 	}
 
-	execute(ctx, head.Appid, tree)
+	execute(withParallel(ctx), head.Appid, tree)
 
 	resp = &proto.QueryResp{}
 
@@ -57,7 +70,7 @@ func Parse(ctx context.Context, head *proto.RequestHeader, units []*proto.Unit)
 }
 
 // createTree 根据 unit 生成分析树
-func createTree(head, parent *obj.Tree, units []*proto.Unit, requestHeader *proto.RequestHeader) error {
+func createTree(ctx context.Context, head, parent *obj.Tree, units []*proto.Unit, requestHeader *proto.RequestHeader) error {
 	var node *obj.Tree
 
 	if parent == nil {
@@ -81,12 +94,12 @@ func createTree(head, parent *obj.Tree, units []*proto.Unit, requestHeader *prot
 					"parent and all child nodes belong to the same transaction, no need to repeat the definition")
 			}
 
-			err := InitTree(node, unit, requestHeader)
+			err := InitTree(ctx, node, unit, requestHeader)
 			if err != nil {
 				return err
 			}
 
-			err = createTransTree(node, unit.Trans, requestHeader)
+			err = createTransTree(ctx, node, unit.Trans, requestHeader)
 			if err != nil {
 				return err
 			}
@@ -95,7 +108,7 @@ func createTree(head, parent *obj.Tree, units []*proto.Unit, requestHeader *prot
 				node.TransInfo = parent.TransInfo
 			}
 
-			err := initTree(head, node, unit, requestHeader)
+			err := initTree(ctx, head, node, unit, requestHeader)
 			if err != nil {
 				return err
 			}
@@ -114,7 +127,7 @@ func createTree(head, parent *obj.Tree, units []*proto.Unit, requestHeader *prot
 }
 
 // 创建事务节点
-func createTransTree(head *obj.Tree, units []*proto.Unit, requestHeader *proto.RequestHeader) error {
+func createTransTree(ctx context.Context, head *obj.Tree, units []*proto.Unit, requestHeader *proto.RequestHeader) error {
 	// 初始化事务信息
 	var transInfo = &obj.TransInfo{}
 
@@ -133,7 +146,7 @@ func createTransTree(head *obj.Tree, units []*proto.Unit, requestHeader *proto.R
 				"all sibling nodes belong to the same transaction, no need to repeat the definition")
 		}
 
-		err := initTree(nil, node, unit, requestHeader)
+		err := initTree(ctx, nil, node, unit, requestHeader)
 		if err != nil {
 			return err
 		}
@@ -151,14 +164,14 @@ func createTransTree(head *obj.Tree, units []*proto.Unit, requestHeader *proto.R
 	return nil
 }
 
-func initTree(head, node *obj.Tree, unit *proto.Unit, requestHeader *proto.RequestHeader) error {
-	err := InitTree(node, unit, requestHeader)
+func initTree(ctx context.Context, head, node *obj.Tree, unit *proto.Unit, requestHeader *proto.RequestHeader) error {
+	err := InitTree(ctx, node, unit, requestHeader)
 	if err != nil {
 		return err
 	}
 
 	if len(unit.Sub) > 0 {
-		err = createTree(head, node, unit.Sub, requestHeader)
+		err = createTree(ctx, head, node, unit.Sub, requestHeader)
 		if err != nil {
 			return err
 		}
@@ -166,104 +179,129 @@ func initTree(head, node *obj.Tree, unit *proto.Unit, requestHeader *proto.Reque
 	return nil
 }
 
-// execute 执行查询节点
+// execute 执行查询节点，非事务内的同层级节点按引用依赖关系调度执行
 func execute(ctx context.Context, appid uint64, node *obj.Tree) {
+	if !node.InTrans && node.GetReal().Next != nil {
+		executeGraph(ctx, appid, node)
+		return
+	}
+
 	for {
-		realNode := node.GetReal()
+		executeNode(ctx, appid, node)
 
-		if realNode.IsTransaction() {
-			if node.IsSub { // 子查询，生成子查询自有的 TransInfo，并生成新的事务节点，Real 共用原有的事务节点。
-				node.TransInfo = &obj.TransInfo{
-					Trans: &obj.Tree{
-						Name:   realNode.TransInfo.Trans.Name,
-						Parent: node,
-						IsSub:  node.IsSub,
-						Real:   realNode.TransInfo.Trans,
-					},
-				}
-				// 事务查询节点的 TransInfo 都指向新生成的 TransInfo
-				node.TransInfo.Trans.TransInfo = node.TransInfo
-			}
+		if node.GetReal().Next == nil {
+			break
+		}
 
-			node.TransInfo.Trans.InTrans = true
-			execute(ctx, appid, node.TransInfo.Trans)
-			finishTrans(node)
-			node.TransInfo.ResetTxClient() // 事务完成，重置事务
-		} else {
-			var ret interface{}
+		node = nextNode(node)
+	}
+}
 
-			if node.InTrans && node.TransInfo.Rollback { //事务需回滚，不再执行 query 语句
-				node.Finished = consts.QueryFinishedRollback
-			} else {
-				ret, node.Detail, node.IsNil, node.Error = query(ctx, appid, node)
-				node.Finished = consts.QueryFinishedYes
-			}
+// nextNode 获取同层级下一个查询节点
+func nextNode(node *obj.Tree) *obj.Tree {
+	realNode := node.GetReal()
+
+	if node.IsSub { //每个子查询节点都应该有他自己的 Next 节点，而 Real 共用同一个。
+		node.Next = &obj.Tree{
+			Name:    realNode.Next.Name,
+			Last:    node,
+			Parent:  node.Parent,
+			IsSub:   node.IsSub,
+			Real:    realNode.Next,
+			InTrans: node.InTrans,
+		}
+
+		if node.InTrans {
+			// 事务中的所有生成的新节点 TransInfo 都指向同一个 TransInfo
+			node.Next.TransInfo = node.TransInfo
+		}
+	}
+
+	return node.Next
+}
 
-			if node.InTrans && node.Error != nil {
-				node.Finished = consts.QueryFinishedRollback
-				node.TransInfo.Rollback = true // 事务待回滚
+// executeNode 执行单个查询节点（包含其事务、嵌套子查询），不处理同层级的 Next 节点
+func executeNode(ctx context.Context, appid uint64, node *obj.Tree) {
+	realNode := node.GetReal()
+
+	if realNode.IsTransaction() {
+		if node.IsSub { // 子查询，生成子查询自有的 TransInfo，并生成新的事务节点，Real 共用原有的事务节点。
+			node.TransInfo = &obj.TransInfo{
+				Trans: &obj.Tree{
+					Name:   realNode.TransInfo.Trans.Name,
+					Parent: node,
+					IsSub:  node.IsSub,
+					Real:   realNode.TransInfo.Trans,
+				},
 			}
+			// 事务查询节点的 TransInfo 都指向新生成的 TransInfo
+			node.TransInfo.Trans.TransInfo = node.TransInfo
+		}
 
-			if realNode.Sub == nil { //不包含嵌套子查询
-				node.Result = ret
-			} else {
-				if node.Finished == consts.QueryFinishedYes && node.IsSuccess() && !node.IsNil {
-					node.HasSub = true
-
-					var rv reflect.Value
-					if realNode.IsArray() {
-						rv = reflect.ValueOf(ret)
-					} else {
-						rv = reflect.ValueOf([]interface{}{ret})
-					}
-					l := rv.Len()
+		node.TransInfo.Trans.InTrans = true
+		execute(ctx, appid, node.TransInfo.Trans)
+		finishTrans(node)
+		node.TransInfo.ResetTxClient() // 事务完成，重置事务
+		return
+	}
 
-					node.SubQuery = make([]*obj.Tree, l)
+	var ret interface{}
 
-					for k := 0; k < l; k++ {
-						var result = types.Interface(rv.Index(k))
+	if node.InTrans && node.TransInfo.Rollback { //事务需回滚，不再执行 query 语句
+		node.Finished = consts.QueryFinishedRollback
+	} else if batch := getBatchResult(ctx, node); batch != nil { // 子查询已批量执行
+		ret, node.IsNil = batch.result, batch.isNil
+		node.Finished = consts.QueryFinishedYes
+	} else {
+		ret, node.Detail, node.IsNil, node.Error = limitQuery(ctx, appid, node)
+		node.Finished = consts.QueryFinishedYes
+	}
 
-						node.SubQuery[k] = &obj.Tree{
-							Name:      realNode.Sub.Name,
-							IsSub:     true,
-							InTrans:   node.InTrans,
-							Real:      realNode.Sub, //根据查询结果数量，生成对应的子查询节点，Real 共用同一个。
-							Parent:    node,
-							ParentRet: result,
-						}
+	if node.InTrans && node.Error != nil {
+		node.Finished = consts.QueryFinishedRollback
+		node.TransInfo.Rollback = true // 事务待回滚
+	}
 
-						if node.InTrans {
-							// 事务中的所有生成的新节点 TransInfo 都指向同一个 TransInfo
-							node.SubQuery[k].TransInfo = node.TransInfo
-						}
+	if realNode.Sub == nil { //不包含嵌套子查询
+		node.Result = ret
+		return
+	}
 
-						execute(ctx, appid, node.SubQuery[k])
-					}
-				}
-			}
-		}
+	if node.Finished == consts.QueryFinishedYes && node.IsSuccess() && !node.IsNil {
+		node.HasSub = true
 
-		if realNode.Next == nil {
-			break
+		var rv reflect.Value
+		if realNode.IsArray() {
+			rv = reflect.ValueOf(ret)
+		} else {
+			rv = reflect.ValueOf([]interface{}{ret})
 		}
+		l := rv.Len()
 
-		if node.IsSub { //每个子查询节点都应该有他自己的 Next 节点，而 Real 共用同一个。
-			node.Next = &obj.Tree{
-				Name:    realNode.Next.Name,
-				Last:    node,
-				Parent:  node.Parent,
-				IsSub:   node.IsSub,
-				Real:    realNode.Next,
-				InTrans: node.InTrans,
+		node.SubQuery = make([]*obj.Tree, l)
+
+		for k := 0; k < l; k++ {
+			var result = types.Interface(rv.Index(k))
+
+			node.SubQuery[k] = &obj.Tree{
+				Name:      realNode.Sub.Name,
+				IsSub:     true,
+				InTrans:   node.InTrans,
+				Real:      realNode.Sub, //根据查询结果数量，生成对应的子查询节点，Real 共用同一个。
+				Parent:    node,
+				ParentRet: result,
 			}
 
 			if node.InTrans {
 				// 事务中的所有生成的新节点 TransInfo 都指向同一个 TransInfo
-				node.Next.TransInfo = node.TransInfo
+				node.SubQuery[k].TransInfo = node.TransInfo
 			}
 		}
 
-		node = node.Next
+		subCtx := batchSubQuery(ctx, appid, node)
+		for _, subNode := range node.SubQuery {
+			execute(subCtx, appid, subNode)
+		}
 	}
 }
 
@@ -418,7 +456,7 @@ func parseCompResult(node *obj.Tree) map[string]interface{} {
 }
 
 // InitTree 初始化分析树
-func InitTree(node *obj.Tree, unit *proto.Unit, requestHeader *proto.RequestHeader) error {
+func InitTree(ctx context.Context, node *obj.Tree, unit *proto.Unit, requestHeader *proto.RequestHeader) error {
 	if unit.Extend == nil {
 		unit.Extend = map[string]interface{}{}
 	}
@@ -462,7 +500,8 @@ func InitTree(node *obj.Tree, unit *proto.Unit, requestHeader *proto.RequestHead
 	}
 
 	if len(unit.Trans) == 0 {
-		tables, table, db, ambiguous := table.GetTableAndDB(property.Name, unit.Shard)
+		tables, table, db, ambiguous := table.Snap(ctx).GetTableAndDB(requestHeader.Appid,
+			property.Name, unit.Shard)
 		if ambiguous {
 			return errs.Newf(errs.ErrNameAmbiguity,
 				"[%s] there are multiple tables with the same name, please input namespace to separate", property.Path)
@@ -480,6 +519,11 @@ func InitTree(node *obj.Tree, unit *proto.Unit, requestHeader *proto.RequestHead
 
 	node.Property = &property
 
+	// 所有执行单元执行之前校验列、条件、写入数据与表结构是否相符
+	if property.Table != nil {
+		return schema.CheckUnit(ctx, node)
+	}
+
 	return nil
 }
 
@@ -28,10 +28,13 @@ import (
 	"github.com/horm-database/common/util"
 	"github.com/horm-database/orm/database"
 	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/audit"
 	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/limit"
 	"github.com/horm-database/server/model/table"
 	"github.com/horm-database/server/plugin"
 	"github.com/horm-database/server/plugin/conf"
+	"github.com/horm-database/server/schema"
 )
 
 // 节点查询
@@ -51,16 +54,42 @@ func query(ctx context.Context, appid uint64,
 	dbInfo := realNode.GetDB()
 	tblTable := realNode.GetTable()
 
+	// 表 ip 白名单
+	err = auth.TableIPCheck(ctx, realNode, appid)
+	if err != nil {
+		return
+	}
+
 	// 查看表权限
-	err = auth.PermissionCheck(realNode, appid, op, unit.Query, false)
+	err = auth.PermissionCheck(ctx, realNode, appid, op, unit.Query, false)
 	if err != nil {
 		return
 	}
 
+	// 表、操作维度限流，解释模式不执行语句，无需限流
+	if !isExplain(ctx) {
+		var release func()
+		release, err = limit.AcquireTable(ctx, appid, tblTable.Id, op)
+		if err != nil {
+			return
+		}
+		defer release()
+	}
+
 	// 引用处理
-	where, having, data, datas, key, field, val, args, isNil, err := referHandle(dbInfo.Addr.Type, unit, node)
-	if err != nil || isNil {
-		return nil, nil, isNil, err
+	var where, having, data map[string]interface{}
+	var datas []map[string]interface{}
+	var key, field string
+	var val interface{}
+	var args []interface{}
+
+	if isExplain(ctx) { // 解释模式，被引用的执行单元未执行，引用替换为占位符
+		where, having, data, datas, key, field, val, args = explainReferHandle(unit)
+	} else {
+		where, having, data, datas, key, field, val, args, isNil, err = referHandle(dbInfo.Addr.Type, unit, node)
+		if err != nil || isNil {
+			return nil, nil, isNil, err
+		}
 	}
 
 	// 插件请求/返回参数初始化
@@ -112,10 +141,16 @@ func query(ctx context.Context, appid uint64,
 		return
 	}
 
+	// 解释模式只执行无副作用的插件
+	var skipped []string
+	if isExplain(ctx) {
+		chain, skipped = chain.explainSafe()
+	}
+
 	dbExecFilter := func(ctx context.Context) error {
 		// 校验是否有执行权限
 		if req.Op != op || req.Query != unit.Query {
-			err = auth.PermissionCheck(realNode, appid, req.Op, req.Query, true)
+			err = auth.PermissionCheck(ctx, realNode, appid, req.Op, req.Query, true)
 			if err != nil {
 				return err
 			}
@@ -127,8 +162,35 @@ func query(ctx context.Context, appid uint64,
 			return err
 		}
 
+		// 校验表结构
+		err = schema.Check(ctx, realNode, req)
+		if err != nil {
+			return err
+		}
+
+		// 校验列权限
+		err = auth.ColumnCheck(ctx, realNode, appid, req)
+		if err != nil {
+			return err
+		}
+
+		// 行级过滤
+		err = auth.RowFilter(ctx, realNode, appid, req)
+		if err != nil {
+			return err
+		}
+
+		if isExplain(ctx) { // 解释模式，不执行 db 查询，返回将要执行的语句
+			rsp.Result = explainRequest(req, realNode, skipped)
+			return nil
+		}
+
+		// 写操作审计
+		auditEntry := audit.Begin(ctx, appid, realNode, req, node.TransInfo)
+
 		// 走 db 查询
 		result, detail, isNil, err = database.QueryResult(ctx, req, realNode, dbInfo.Addr, node.TransInfo)
+		auditEntry.Finish(ctx, result, err)
 
 		rsp.IsNil = isNil
 		rsp.Detail = detail
@@ -137,7 +199,7 @@ func query(ctx context.Context, appid uint64,
 		return nil
 	}
 
-	err = chain.Handle(ctx, req, rsp, unit.Extend, dbExecFilter)
+	err = handleChain(ctx, realNode, appid, chain, req, rsp, unit.Extend, dbExecFilter)
 	if err != nil {
 		return
 	}
@@ -145,13 +207,29 @@ func query(ctx context.Context, appid uint64,
 	return rsp.Result, rsp.Detail, rsp.IsNil, rsp.Error
 }
 
+// handleChain 执行插件链，并剔除结果中无权查询的列。插件（如缓存）可能不执行 next 直接返回结果，
+// 所以列剔除作用于插件链最终返回的结果，而不只是 db 查询结果
+func handleChain(ctx context.Context, node *obj.Tree, appid uint64, chain Chain,
+	req *pf.Request, rsp *pf.Response, extend types.Map, next conf.HandleFunc) error {
+	err := chain.Handle(ctx, req, rsp, extend, next)
+	if err != nil {
+		return err
+	}
+
+	if rsp.Error == nil && !rsp.IsNil && !isExplain(ctx) {
+		rsp.Result = auth.ColumnFilter(ctx, node, appid, rsp.Result)
+	}
+
+	return nil
+}
+
 // 获取插件链
 func getPluginChain(ctx context.Context, appid uint64, tblTable *obj.TblTable) (Chain, error) {
-	tablePlugins := table.GetTablePlugins(tblTable.Id)
+	plugins := table.Snap(ctx).Plugins() // 请求固定的快照，插件热加载不影响本次请求
 
 	ret := Chain{}
-	for _, tablePlugin := range tablePlugins {
-		tblPlugin := table.GetPlugin(tablePlugin.PluginID)
+	for _, tablePlugin := range plugins.TablePlugins(tblTable.Id) {
+		tblPlugin := plugins.Plugin(tablePlugin.PluginID)
 
 		if tblPlugin == nil {
 			e := errs.NewPluginf(errs.ErrPluginNotFound, "not find plugin : %d", tablePlugin.PluginID)
@@ -180,6 +258,7 @@ func getPluginChain(ctx context.Context, appid uint64, tblTable *obj.TblTable) (
 
 		ret = append(ret, &PluginHandler{
 			appid: appid,
+			name:  funcName,
 			tp:    tablePlugin,
 			f:     f,
 		})
@@ -190,6 +269,7 @@ func getPluginChain(ctx context.Context, appid uint64, tblTable *obj.TblTable) (
 
 type PluginHandler struct {
 	appid uint64
+	name  string
 	tp    *table.TblTablePlugin
 	f     plugin.Plugin
 }
@@ -197,6 +277,22 @@ type PluginHandler struct {
 // Chain chains of plugin handler
 type Chain []*PluginHandler
 
+// explainSafe 返回只包含无副作用插件的执行链，及被跳过的插件
+func (c Chain) explainSafe() (Chain, []string) {
+	var ret Chain
+	var skipped []string
+
+	for _, h := range c {
+		if safe, ok := h.f.(plugin.ExplainSafe); ok && safe.ExplainSafe() {
+			ret = append(ret, h)
+		} else {
+			skipped = append(skipped, h.name)
+		}
+	}
+
+	return ret, skipped
+}
+
 // Handle invokes every server side filters in the chain.
 func (c Chain) Handle(ctx context.Context, req *pf.Request, rsp *pf.Response, extend types.Map, next conf.HandleFunc) error {
 	for i := len(c) - 1; i >= 0; i-- {
@@ -0,0 +1,93 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logic
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	cc "github.com/horm-database/common/consts"
+	pf "github.com/horm-database/common/proto/plugin"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/model/table"
+	"github.com/horm-database/server/plugin/conf"
+)
+
+// cachePlugin 模拟命中缓存的插件，不执行 next 直接返回缓存的结果
+type cachePlugin struct {
+	result interface{}
+}
+
+func (p *cachePlugin) Handle(ctx context.Context, req *pf.Request, rsp *pf.Response,
+	extend types.Map, conf conf.PluginConfig, next conf.HandleFunc) error {
+	rsp.Result = p.result
+	return nil
+}
+
+// 插件短路插件链返回结果时，同样剔除无权查询的列，且不修改插件持有的结果
+func TestHandleChainColumnFilter(t *testing.T) {
+	const appid, tableID = 900001, 900001
+
+	table.UpdateDBInfo(&table.ConfigRows{
+		AppInfos: []*table.TblAppInfo{{Appid: appid, Name: "column_filter", Status: 1}},
+		AccessTables: []*table.TblAccessTable{
+			{Id: tableID, Appid: appid, TableId: tableID, Op: cc.OpFindAll, ReadColumn: "id,name", Status: 1},
+		},
+	}, nil)
+
+	if err := auth.SetPermissionMode(auth.ModeEnforce); err != nil {
+		t.Fatal(err)
+	}
+	defer auth.SetPermissionMode(auth.ModeOff)
+
+	cached := []map[string]interface{}{
+		{"id": 1, "name": "alice", "password": "secret"},
+		{"id": 2, "name": "bob", "password": "secret"},
+	}
+
+	chain := Chain{{
+		appid: appid,
+		name:  "cache",
+		tp:    &table.TblTablePlugin{ScheduleConf: &conf.ScheduleConfig{}},
+		f:     &cachePlugin{result: cached},
+	}}
+
+	node := &obj.Tree{Name: "student", Property: &obj.Property{Op: cc.OpFindAll, Table: &obj.TblTable{Id: tableID}}}
+
+	next := func(ctx context.Context) error {
+		t.Fatal("plugin short-circuited the chain, db query should not be executed")
+		return nil
+	}
+
+	rsp := &pf.Response{}
+	err := handleChain(context.Background(), node, appid, chain, &pf.Request{Op: cc.OpFindAll}, rsp, types.Map{}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]interface{}{{"id": 1, "name": "alice"}, {"id": 2, "name": "bob"}}
+	if !reflect.DeepEqual(rsp.Result, want) {
+		t.Errorf("result = %v, want %v", rsp.Result, want)
+	}
+
+	for _, row := range cached {
+		if _, ok := row["password"]; !ok {
+			t.Errorf("cached result modified: %v", row)
+		}
+	}
+}
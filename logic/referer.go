@@ -267,18 +267,7 @@ func getRefererParam(arg string) string {
 // findReferer 找到被引用节点结果
 func findReferer(node *obj.Tree, referer string) (ret interface{}, isNil bool, err error) {
 	refererPath, refererField := pathAndField(referer)
-	if !filepath.IsAbs(refererPath) { // 相对路径转化为绝对路径
-		if len(refererPath) < 3 || refererPath[:3] != "../" {
-			if len(refererPath) >= 2 && refererPath[:2] == "./" {
-				refererPath = "." + refererPath
-			} else {
-				refererPath = "../" + refererPath
-			}
-		}
-
-		path := node.GetReal().GetPath()
-		refererPath = filepath.Join(path, refererPath)
-	}
+	refererPath = absRefererPath(node.GetReal().GetPath(), refererPath)
 
 	for {
 		var cur *obj.Tree
@@ -362,6 +351,23 @@ func findReferer(node *obj.Tree, referer string) (ret interface{}, isNil bool, e
 	}
 }
 
+// absRefererPath 将引用路径转化为绝对路径，path 为引用者所在执行单元路径
+func absRefererPath(path, refererPath string) string {
+	if filepath.IsAbs(refererPath) {
+		return refererPath
+	}
+
+	if len(refererPath) < 3 || refererPath[:3] != "../" {
+		if len(refererPath) >= 2 && refererPath[:2] == "./" {
+			refererPath = "." + refererPath
+		} else {
+			refererPath = "../" + refererPath
+		}
+	}
+
+	return filepath.Join(path, refererPath)
+}
+
 func findRefererByPath(cur *obj.Tree, referer string,
 	refererPathArr []string, refererField string, ret *[]interface{}, find *bool, e *error) {
 	for {
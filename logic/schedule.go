@@ -0,0 +1,253 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logic
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/proto"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/common/util"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+)
+
+// executeGraph 分析同层级节点之间的引用关系生成依赖图（DAG），没有依赖关系的节点并发执行，同时执行的查询数受请求的
+// 并发额度（见 withParallel）限制。引用了其他节点结果的节点，待被引用节点执行完毕之后再执行。
+func executeGraph(ctx context.Context, appid uint64, head *obj.Tree) {
+	nodes := siblingNodes(head)
+
+	deps := make([][]int, len(nodes))
+	done := make([]chan struct{}, len(nodes))
+	for i, node := range nodes {
+		deps[i] = siblingDeps(node, nodes[:i])
+		done[i] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *obj.Tree) {
+			defer func() {
+				if e := recover(); e != nil {
+					node.Error = errs.Newf(errs.ErrPanic, "[%s] execute panic: %v", node.GetReal().GetPath(), e)
+					node.Finished = consts.QueryFinishedYes
+					log.Error(ctx, errs.ErrPanic, node.Error.Error())
+				}
+
+				close(done[i])
+				wg.Done()
+			}()
+
+			for _, dep := range deps[i] {
+				<-done[dep]
+			}
+
+			// 被引用的节点执行失败，不再执行
+			if failed := failedDep(nodes, deps[i]); failed != nil {
+				depFailed(node, failed)
+				return
+			}
+
+			if ctx.Err() != nil {
+				node.Error = canceledError(ctx, node)
+				return
+			}
+
+			executeNode(ctx, appid, node)
+		}(i, node)
+	}
+
+	wg.Wait()
+}
+
+type parallelKey struct{}
+
+// withParallel 生成请求的并发额度，整个请求（包括嵌套子查询、批量子查询）同时执行的查询不超过 parallelNum
+func withParallel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, parallelKey{}, make(chan struct{}, parallelNum))
+}
+
+// limitQuery 占用请求的并发额度执行查询，请求已超时或被取消时不执行。额度只在查询期间占用，
+// 节点等待依赖、执行嵌套子查询时不占用，嵌套执行不会因额度耗尽而死锁
+func limitQuery(ctx context.Context, appid uint64,
+	node *obj.Tree) (result interface{}, detail *proto.Detail, isNil bool, err error) {
+	if pool, ok := ctx.Value(parallelKey{}).(chan struct{}); ok {
+		select {
+		case pool <- struct{}{}:
+		case <-ctx.Done():
+			return nil, nil, false, canceledError(ctx, node)
+		}
+
+		defer func() { <-pool }()
+	}
+
+	if ctx.Err() != nil {
+		return nil, nil, false, canceledError(ctx, node)
+	}
+
+	return query(ctx, appid, node)
+}
+
+// siblingNodes 获取同层级的所有查询节点，子查询节点的 Next 节点在此生成
+func siblingNodes(head *obj.Tree) []*obj.Tree {
+	nodes := []*obj.Tree{head}
+
+	node := head
+	for node.GetReal().Next != nil {
+		node = nextNode(node)
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+// siblingDeps 获取节点依赖的同层级前置节点下标。引用只能查找到前置节点（见 findReferer），
+// 被引用路径与前置节点路径相同、或者为其子路径时，视为依赖该前置节点。
+func siblingDeps(node *obj.Tree, lasts []*obj.Tree) []int {
+	if len(lasts) == 0 {
+		return nil
+	}
+
+	var refererPaths []string
+	unitRefererPaths(node.GetReal().GetUnit(), node.GetReal().GetPath(), &refererPaths)
+
+	var deps []int
+	for i, last := range lasts {
+		lastPath := last.GetReal().GetPath()
+		for _, refererPath := range refererPaths {
+			if refererPath == lastPath || strings.HasPrefix(refererPath, lastPath+"/") {
+				deps = append(deps, i)
+				break
+			}
+		}
+	}
+
+	return deps
+}
+
+// unitRefererPaths 获取执行单元（包含其事务、嵌套子查询下的执行单元）所有引用的绝对路径
+func unitRefererPaths(unit *proto.Unit, path string, refererPaths *[]string) {
+	if unit == nil {
+		return
+	}
+
+	if len(unit.Trans) == 1 { //事务下只有一个执行单元，当成普通执行单元
+		unit = unit.Trans[0]
+	}
+
+	for _, referer := range unitReferers(unit) {
+		refererPath, _ := pathAndField(referer)
+		*refererPaths = append(*refererPaths, absRefererPath(path, refererPath))
+	}
+
+	for _, transUnit := range unit.Trans {
+		unitRefererPaths(transUnit, path+"/"+unitKey(transUnit), refererPaths)
+	}
+
+	for _, subUnit := range unit.Sub {
+		unitRefererPaths(subUnit, path+"/"+unitKey(subUnit), refererPaths)
+	}
+}
+
+// unitReferers 获取执行单元自身的所有引用
+func unitReferers(unit *proto.Unit) []string {
+	var referers []string
+
+	mapReferers(unit.Where, &referers)
+	mapReferers(unit.Having, &referers)
+	mapReferers(unit.Data, &referers)
+
+	for _, data := range unit.Datas {
+		mapReferers(data, &referers)
+	}
+
+	args := []interface{}{unit.Key, unit.Field, unit.Val}
+	args = append(args, unit.Args...)
+
+	for _, arg := range args {
+		if str, ok := arg.(string); ok && argHasReferer(str) {
+			referers = append(referers, getRefererParam(str))
+		}
+	}
+
+	return referers
+}
+
+// mapReferers 获取 map 中的所有引用
+func mapReferers(data map[string]interface{}, referers *[]string) {
+	for k, v := range data {
+		if types.FirstWord(util.RemoveComments(k), 1) == "@" {
+			if referer, ok := v.(string); ok {
+				*referers = append(*referers, referer)
+			}
+			continue
+		}
+
+		switch rv := v.(type) {
+		case map[string]interface{}:
+			mapReferers(rv, referers)
+		case []interface{}:
+			for _, item := range rv {
+				if mv, ok := item.(map[string]interface{}); ok {
+					mapReferers(mv, referers)
+				}
+			}
+		}
+	}
+}
+
+// unitKey 获取执行单元 key，有别名时取别名
+func unitKey(unit *proto.Unit) string {
+	name, alias := util.Alias(unit.Name)
+	if alias != "" {
+		return alias
+	}
+	return name
+}
+
+// failedDep 获取执行失败（包括 panic、被取消）的依赖节点
+func failedDep(nodes []*obj.Tree, deps []int) *obj.Tree {
+	for _, dep := range deps {
+		if nodes[dep].Error != nil {
+			return nodes[dep]
+		}
+	}
+
+	return nil
+}
+
+// depFailed 依赖的节点执行失败，节点以引用失败结束，事务中的节点标记事务回滚
+func depFailed(node, failed *obj.Tree) {
+	node.Error = errs.Newf(errs.ErrRefererUnitFailed, "[%s] referer unit [%s] failed",
+		node.GetReal().GetPath(), failed.GetReal().GetPath())
+	node.Finished = consts.QueryFinishedYes
+
+	if node.InTrans && node.TransInfo != nil {
+		node.Finished = consts.QueryFinishedRollback
+		node.TransInfo.Rollback = true
+	}
+}
+
+// canceledError 请求已超时或被取消，执行单元不再执行
+func canceledError(ctx context.Context, node *obj.Tree) error {
+	return errs.Newf(consts.ErrQueryCanceled, "[%s] unit is not executed, request context is done: %v",
+		node.GetReal().GetPath(), ctx.Err())
+}
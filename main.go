@@ -21,8 +21,13 @@ import (
 
 	"github.com/horm-database/common/log"
 	"github.com/horm-database/server/api"
+	"github.com/horm-database/server/audit"
+	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/limit"
+	"github.com/horm-database/server/logic"
 	"github.com/horm-database/server/model"
 	"github.com/horm-database/server/plugin"
+	"github.com/horm-database/server/schema"
 	"github.com/horm-database/server/srv"
 	"github.com/horm-database/server/srv/codec"
 )
@@ -33,18 +38,99 @@ func main() {
 	// 注册插件处理函数
 	plugin.Register()
 
+	err := model.SetSource(srv.Config().Source.Type, srv.Config().Source.Dir)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	model.SetSnapshot(srv.Config().Source.SnapshotDir, srv.Config().Source.SnapshotKeep)
 	model.Init(codec.GCtx, srv.Config().MachineID)
 
+	logic.SetParallelNum(srv.Config().Server.ParallelNum)
+
+	err = auth.SetSignMode(srv.Config().Auth.SignMode)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	err = auth.SetPermissionMode(srv.Config().Auth.PermissionMode)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	auth.SetGrantWarnWindow(srv.Config().Auth.GrantWarn)
+	auth.SetAdminAppids(srv.Config().Auth.AdminAppids)
+
+	err = auth.SetReplayConfig(srv.Config().Auth.ClockSkew,
+		srv.Config().Auth.NonceStore, srv.Config().Auth.NonceCapacity)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	err = auth.SetJWTConfig(srv.Config().Auth.JWKSFile, srv.Config().Auth.JWTAppidClaim,
+		srv.Config().Auth.JWTIssuer, srv.Config().Auth.JWTAudience)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	err = limit.SetSharedCounter(srv.Config().Limit.SharedCounter)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	sourceConf := srv.Config().Source
+	err = model.SetNotify(codec.GCtx, sourceConf.Notify, sourceConf.NotifyChannel, sourceConf.SyncInterval)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	model.SetReconcileInterval(sourceConf.Reconcile)
+
+	err = schema.SetMode(srv.Config().Schema.Mode, srv.Config().Schema.Refresh)
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
+	schema.SetFetch(srv.Config().Schema.Concurrency, srv.Config().Schema.Timeout)
+
+	auditConf := srv.Config().Audit
+	audit.SetBeforeImage(auditConf.BeforeImage, auditConf.BeforeImageLimit)
+
+	err = audit.SetSink(&audit.SinkConfig{
+		Store:          auditConf.Store,
+		Table:          auditConf.Table,
+		File:           auditConf.File,
+		MaxSize:        auditConf.MaxSize,
+		MaxBackups:     auditConf.MaxBackups,
+		QueueSize:      auditConf.QueueSize,
+		EnqueueTimeout: auditConf.EnqueueTimeout,
+	})
+	if err != nil {
+		log.Fatal(codec.GCtx, err)
+	}
+
 	go func() {
 		for {
 			go model.SyncDbNewToLocal(codec.GCtx)
 			//go batch.InsertHandle(codec.GCtx)
 			//go batch.FailedCheck(codec.GCtx)
-			time.Sleep(2 * time.Second)
+			time.Sleep(model.SyncInterval())
 		}
 	}()
 
-	if err := server.Serve(); err != nil {
+	go schema.Run(codec.GCtx) // 配置快照发布时拉取新增、修改的表结构
+
+	go func() {
+		for {
+			auth.GrantExpireWarn(codec.GCtx)
+			time.Sleep(time.Hour)
+		}
+	}()
+
+	err = server.Serve()
+	audit.Close() // 写入队列中剩余的审计记录
+
+	if err != nil {
 		log.Fatal(codec.GCtx, err)
 	}
 }
@@ -17,195 +17,212 @@ package model
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
 	"github.com/horm-database/common/snowflake"
-	"github.com/horm-database/go-horm/horm"
-	"github.com/horm-database/orm"
-	"github.com/horm-database/orm/obj"
 	"github.com/horm-database/server/consts"
 	"github.com/horm-database/server/model/table"
 )
 
-var SyncTime time.Time
+const defaultReconcileInterval = 60 * time.Second // 全量对账间隔默认值
 
-func Init(ctx context.Context, machineID int) {
-	snowflake.SetMachineID(machineID)
-
-	SyncTime = time.Now()
+var (
+	SyncTime       time.Time
+	syncLock       sync.Mutex
+	syncPluginLock sync.Mutex
 
-	initWorkspace(ctx)
-	initDBConfig(ctx)
-	initTableConfig(ctx)
-	initAppInfo(ctx)
-	initPlugin(ctx)
-}
-
-// 初始化 workspace 信息
-func initWorkspace(ctx context.Context) {
-	//初始化执行实例信息
-	var workspace table.TblWorkspace
-	_, err := orm.NewORM(consts.DBConfigName).
-		Name("tbl_workspace").Find().Exec(ctx, &workspace)
-	if err != nil {
-		panic(fmt.Errorf("initial tbl_db from db error: %s", err))
-	}
+	reconcileInterval = defaultReconcileInterval // 全量对账间隔
+	lastReconcile     time.Time                  // 最近一次全量对账时间
+)
 
-	if workspace.Id == 0 {
-		return
+// SetReconcileInterval 设置全量对账间隔（单位 ms），默认 60 秒。全量对账需扫描所有配置表的主键，
+// 只在该间隔、变更通知要求全量同步以及只读配置模式下执行，配置的物理删除在该间隔内生效（开启变更通知时由通知即时生效）
+func SetReconcileInterval(interval int) {
+	reconcileInterval = time.Duration(interval) * time.Millisecond
+	if reconcileInterval <= 0 {
+		reconcileInterval = defaultReconcileInterval
 	}
-
-	table.SetWorkspace(&workspace)
 }
 
-// 初始化数据库配置表到 body
-func initDBConfig(ctx context.Context) {
-	//初始化执行实例信息
-	dbs := []*obj.TblDB{}
-	_, err := orm.NewORM(consts.DBConfigName).
-		Name("tbl_db").FindAll().Exec(ctx, &dbs)
-	if err != nil {
-		panic(fmt.Errorf("initial tbl_db from db error: %s", err))
-	}
+func Init(ctx context.Context, machineID int) {
+	snowflake.SetMachineID(machineID)
 
-	if len(dbs) == 0 {
-		return
-	}
+	SyncTime = time.Now()
 
-	for _, db := range dbs {
-		table.SetDB(db)
+	err := initConfig(ctx)
+	if err == nil {
+		saveSnapshot(ctx)
+		return
 	}
-}
 
-// 初始化表配置信息到 body
-func initTableConfig(ctx context.Context) {
-	tables := make([]*obj.TblTable, 0)
-	_, err := orm.NewORM(consts.DBConfigName).
-		Name("tbl_table").FindAll().Exec(ctx, &tables)
-	if err != nil {
-		panic(fmt.Errorf("initial tbl_table from db error: %s", err))
+	if snapshotDir == "" {
+		panic(err)
 	}
 
-	if len(tables) == 0 {
-		return
+	// 配置数据源不可用时从本地快照启动，同步时从数据源全量拉取，直到数据源恢复
+	d, path, e := loadSnapshot()
+	if e != nil {
+		panic(fmt.Errorf("%v, and load config snapshot error: %v", err, e))
 	}
 
-	for _, tbl := range tables {
-		table.SetTable(tbl)
+	if e = restoreSnapshot(d); e != nil {
+		panic(fmt.Errorf("%v, and restore config snapshot %s error: %v", err, path, e))
 	}
-}
 
-// 初始化接入者信息
-func initAppInfo(ctx context.Context) {
-	//初始化执行实例信息
-	appInfos := make([]*table.TblAppInfo, 0)
-	accessDBs := make([]*table.TblAccessDB, 0)
-	accessTables := make([]*table.TblAccessTable, 0)
+	SyncTime = time.Time{}
+	degraded.Store(true)
+	metrics.IncrCounter("ConfigDegraded", 1)
 
-	c := orm.NewORM(consts.DBConfigName)
+	log.Errorf(ctx, consts.ErrConfigSync, "%v, start in read-only config mode with config snapshot %s "+
+		"(v%d saved at %s), keep retrying the config source", err, path, d.Version, d.Time.Format(time.RFC3339))
+}
 
-	_, err := c.Name("tbl_app_info").FindAll().Exec(ctx, &appInfos)
+// initConfig 从配置数据源获取 workspace、库、表、应用及其秘钥、限流规则、授权、插件配置，全部获取成功后才生效
+func initConfig(ctx context.Context) error {
+	workspace, err := source.Workspace(ctx)
 	if err != nil {
-		panic(fmt.Errorf("initial tbl_app_info from db error: %s", err))
+		return fmt.Errorf("initial tbl_workspace error: %s", err)
 	}
 
-	if len(appInfos) == 0 {
-		return
+	rows, err := source.Rows(ctx, time.Time{})
+	if err != nil {
+		return fmt.Errorf("initial config error: %s", err)
 	}
 
-	_, err = c.Name("tbl_access_db").FindAll().Exec(ctx, &accessDBs)
+	plugin, tablePlugin, err := source.Plugins(ctx)
 	if err != nil {
-		panic(fmt.Errorf("initial tbl_access_db from db error: %s", err))
+		return fmt.Errorf("init plugin error: %s", err)
 	}
 
-	_, err = c.Name("tbl_access_table").FindAll().Exec(ctx, &accessTables)
+	// 插件链校验失败时不发布任何配置，由调用方从本地快照启动
+	_, _, err = table.LoadPlugins(plugin, tablePlugin)
 	if err != nil {
-		panic(fmt.Errorf("initial tbl_access_table from db error: %s", err))
+		return fmt.Errorf("init tbl_table_plugin error: %s", err)
 	}
 
-	for _, info := range appInfos {
-		table.SetAppInfo(info)
+	if workspace != nil {
+		table.SetWorkspace(workspace)
 	}
 
-	if len(accessDBs) > 0 {
-		for _, accessDB := range accessDBs {
-			table.SetAccessDB(accessDB)
-		}
+	table.UpdateDBInfo(rows, nil)
+
+	return nil
+}
+
+// SyncDbNewToLocal 定时将配置数据源的新数据更新到本地
+func SyncDbNewToLocal(ctx context.Context) {
+	now := time.Now()
+
+	if syncLock.TryLock() { // 上一轮同步尚未完成时跳过
+		syncDbNewToLocal(ctx, now, now.Sub(lastReconcile) >= reconcileInterval)
+		syncLock.Unlock()
 	}
 
-	if len(accessTables) > 0 {
-		for _, accessTable := range accessTables {
-			table.SetAccessTable(accessTable)
-		}
+	if syncPluginLock.TryLock() {
+		syncPluginToLocal(ctx, now)
+		syncPluginLock.Unlock()
 	}
 }
 
-// 初始化插件
-func initPlugin(ctx context.Context) {
-	plugin := make([]*table.TblPlugin, 0)
-	tablePlugin := make([]*table.TblTablePlugin, 0)
+// syncDbNewToLocal 增量同步配置，reconcile 为 true 时全量对账，调用方需持有 syncLock
+func syncDbNewToLocal(ctx context.Context, now time.Time, reconcile bool) {
+	if degraded.Load() {
+		metrics.IncrCounter("ConfigDegraded", 1)
 
-	c := orm.NewORM(consts.DBConfigName)
+		workspace, err := source.Workspace(ctx)
+		if err != nil {
+			log.Errorf(ctx, consts.ErrConfigSync, "config source is still unavailable, "+
+				"keep running in read-only config mode: %v", err)
+			return
+		}
 
-	_, err := c.Name("tbl_plugin").FindAll().Exec(ctx, &plugin)
-	if err != nil {
-		panic(fmt.Errorf("init tbl_plugin from db error: %s", err))
+		if workspace != nil {
+			table.SetWorkspace(workspace)
+		}
 	}
 
-	if len(plugin) == 0 {
+	//获取最新配置信息
+	rows, err := source.Rows(ctx, SyncTime)
+	if err != nil { // 本轮不推进同步时间，下一轮重新拉取
+		log.Errorf(ctx, consts.ErrConfigSync, "sync config error: %v", err)
 		return
 	}
 
-	_, err = c.Name("tbl_table_plugin").FindAll().Exec(ctx, &tablePlugin)
-	if err != nil {
-		panic(fmt.Errorf("init tbl_table_plugin from db error: %s", err))
+	// 新上线（或重新上线）的应用，其秘钥、限流规则、授权可能早于本轮同步时间，需要全量拉取
+	var newAppids []uint64
+	for _, info := range rows.AppInfos {
+		if !table.Current().HasAppInfo(info.Appid) {
+			newAppids = append(newAppids, info.Appid)
+		}
 	}
 
-	for _, f := range plugin {
-		table.SetPlugin(f)
+	if len(newAppids) > 0 {
+		appRows, err := source.AppRows(ctx, newAppids)
+		if err != nil {
+			log.Errorf(ctx, consts.ErrConfigSync, "sync config of new app error: %v", err)
+			return
+		}
+
+		rows.AppSecrets = append(rows.AppSecrets, appRows.AppSecrets...)
+		rows.RateLimits = append(rows.RateLimits, appRows.RateLimits...)
+		rows.AccessDBs = append(rows.AccessDBs, appRows.AccessDBs...)
+		rows.AccessTables = append(rows.AccessTables, appRows.AccessTables...)
 	}
 
-	if len(tablePlugin) > 0 {
-		err = table.InitTablePlugin(tablePlugin)
+	// 全量对账，删除数据源中已物理删除的配置。只读配置模式下需要对账删除本地快照中已不存在的配置后才能退出
+	var keys *table.SyncKeys
+	if reconcile || degraded.Load() {
+		keys, err = source.Keys(ctx)
 		if err != nil {
-			panic(fmt.Errorf("init tbl_table_plugin error: %s", err))
+			log.Errorf(ctx, consts.ErrConfigSync, "sync config keys error: %v", err)
+			if degraded.Load() {
+				return
+			}
+			keys = nil
+		} else {
+			lastReconcile = now
 		}
 	}
-}
-
-// SyncDbNewToLocal 定时将数据库新数据更新到本地
-func SyncDbNewToLocal(ctx context.Context) {
-	now := time.Now()
 
-	syncDbNewToLocal(ctx, now)
-	syncPluginToLocal(ctx, now)
-}
-
-func syncDbNewToLocal(ctx context.Context, now time.Time) {
-	c := orm.NewORM(consts.DBConfigName)
+	SyncTime = now
 
-	//获取最新配置信息
-	dbs := make([]*obj.TblDB, 0)
-	tables := make([]*obj.TblTable, 0)
-	appInfos := make([]*table.TblAppInfo, 0)
-	accessDBs := make([]*table.TblAccessDB, 0)
-	accessTables := make([]*table.TblAccessTable, 0)
+	version, changes := table.UpdateDBInfo(rows, keys)
+	if len(changes) > 0 {
+		log.Infof(ctx, "config snapshot v%d published, %d changes: %s", version, len(changes), strings.Join(changes, "; "))
+	}
 
-	where := horm.Where{"updated_at >=": SyncTime.Format("2006-01-02 15:04:05")}
+	if degraded.CompareAndSwap(true, false) {
+		log.Infof(ctx, "config source recovered, leave read-only config mode")
+		saveSnapshot(ctx)
+	} else if len(changes) > 0 {
+		saveSnapshot(ctx)
+	}
+}
 
-	_, _ = c.Name("tbl_db").FindAll(where).Exec(ctx, &dbs)
-	_, _ = c.Name("tbl_table").FindAll(where).Exec(ctx, &tables)
-	_, _ = c.Name("tbl_app_info").FindAll(where).Exec(ctx, &appInfos)
-	_, _ = c.Name("tbl_access_db").FindAll(where).Exec(ctx, &accessDBs)
-	_, _ = c.Name("tbl_access_table").FindAll(where).Exec(ctx, &accessTables)
+// syncPluginToLocal 全量同步插件及表插件链，有变更时原子替换，执行中的请求继续使用旧插件链，调用方需持有 syncPluginLock
+func syncPluginToLocal(ctx context.Context, now time.Time) {
+	plugin, tablePlugin, err := source.Plugins(ctx)
+	if err != nil {
+		log.Errorf(ctx, consts.ErrConfigSync, "sync plugin error: %v", err)
+		return
+	}
 
-	SyncTime = now
+	version, changes, err := table.LoadPlugins(plugin, tablePlugin)
+	if err != nil {
+		log.Errorf(ctx, consts.ErrConfigSync, "sync plugin error: %v", err)
+	}
 
-	table.UpdateDBInfo(dbs, tables, appInfos, accessDBs, accessTables)
+	if len(changes) > 0 {
+		log.Infof(ctx, "config snapshot v%d published, %d plugin changes: %s",
+			version, len(changes), strings.Join(changes, "; "))
+		saveSnapshot(ctx)
+	}
 }
 
-func syncPluginToLocal(ctx context.Context, now time.Time) {}
-
 // InitTable 表结构获取
 func InitTable(ctx context.Context) {
 	//var client = horm.NewMySQLClient(config.DBConfig, 30000000)
@@ -0,0 +1,262 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+const (
+	defaultSyncInterval       = 2 * time.Second  // 未开启变更通知时的定时同步间隔
+	defaultNotifySyncInterval = 60 * time.Second // 开启变更通知后的定时同步间隔，作为通知丢失时的兜底
+	defaultNotifyChannel      = "horm_config_change"
+)
+
+// Notice 配置变更通知，由管理平台在配置变更后发出，实例收到后只拉取变更的记录
+type Notice struct {
+	Table string   `json:"table"` // 变更的配置表，为空或 * 时全量同步
+	IDs   []uint64 `json:"ids"`   // 变更记录的主键，tbl_app_info 为 appid，tbl_plugin、tbl_table_plugin、tbl_workspace 不需要
+}
+
+// Bus 配置变更通知的发布订阅通道
+type Bus interface {
+	// Publish 发布变更通知
+	Publish(ctx context.Context, notices []*Notice) error
+
+	// Subscribe 订阅变更通知，通道重连后以全量同步通知补偿断开期间丢失的通知，直到服务退出
+	Subscribe(ctx context.Context, handle func(ctx context.Context, notices []*Notice))
+}
+
+var (
+	bus          Bus           // 变更通知通道，为 nil 时只能通过管理接口通知本实例
+	syncInterval time.Duration // 定时同步间隔
+)
+
+// SetNotify 设置配置变更通知通道并开始订阅，需要在 Init 之后调用。store 为空不开启，memory 为进程内通道（用于测试），
+// 否则为 tbl_db 中的 redis 库名，channel 为 redis 订阅频道，默认 horm_config_change。
+// interval 为定时同步间隔（单位 ms），未开启通知时默认 2 秒，开启通知后默认 60 秒，作为通知丢失时的兜底
+func SetNotify(ctx context.Context, store, channel string, interval int) error {
+	syncInterval = time.Duration(interval) * time.Millisecond
+
+	switch store {
+	case "":
+		bus = nil
+		if syncInterval <= 0 {
+			syncInterval = defaultSyncInterval
+		}
+		return nil
+	case consts.NotifyStoreMemory:
+		bus = newMemoryBus()
+	default:
+		if channel == "" {
+			channel = defaultNotifyChannel
+		}
+
+		b, err := newRedisBus(store, channel)
+		if err != nil {
+			return err
+		}
+		bus = b
+	}
+
+	if syncInterval <= 0 {
+		syncInterval = defaultNotifySyncInterval
+	}
+
+	go bus.Subscribe(ctx, applyNotices)
+
+	return nil
+}
+
+// SyncInterval 定时同步间隔
+func SyncInterval() time.Duration {
+	if syncInterval <= 0 {
+		return defaultSyncInterval
+	}
+
+	return syncInterval
+}
+
+// Notify 配置变更通知，开启通知通道时发布到通道，由所有实例（包括本实例）拉取变更，否则只在本实例拉取变更
+func Notify(ctx context.Context, notices []*Notice) error {
+	for _, n := range notices {
+		if !validNotice(n) {
+			return fmt.Errorf("unsupported config table [%s] in notice", n.Table)
+		}
+	}
+
+	if bus != nil {
+		return bus.Publish(ctx, notices)
+	}
+
+	applyNotices(ctx, notices)
+	return nil
+}
+
+// applyNotices 按变更通知拉取配置，同一张表的通知合并拉取
+func applyNotices(ctx context.Context, notices []*Notice) {
+	var full, plugin, workspace bool
+
+	ids := map[string][]uint64{}
+	for _, n := range notices {
+		switch n.Table {
+		case "", "*":
+			full = true
+		case "tbl_plugin", "tbl_table_plugin":
+			plugin = true
+		case "tbl_workspace":
+			workspace = true
+		default:
+			if validNotice(n) {
+				ids[n.Table] = append(ids[n.Table], n.IDs...)
+			} else {
+				log.Errorf(ctx, consts.ErrConfigSync, "unsupported config table [%s] in notice", n.Table)
+			}
+		}
+	}
+
+	now := time.Now()
+
+	if full {
+		syncLock.Lock()
+		syncDbNewToLocal(ctx, now, true)
+		syncLock.Unlock()
+
+		plugin = true
+	} else {
+		for name, tableIDs := range ids {
+			syncEntities(ctx, name, tableIDs)
+		}
+	}
+
+	if plugin {
+		syncPluginLock.Lock()
+		syncPluginToLocal(ctx, now)
+		syncPluginLock.Unlock()
+	}
+
+	if workspace && !full {
+		ws, err := source.Workspace(ctx)
+		if err != nil {
+			log.Errorf(ctx, consts.ErrConfigSync, "sync workspace error: %v", err)
+		} else if ws != nil {
+			table.SetWorkspace(ws)
+		}
+	}
+}
+
+// syncEntities 拉取表 name 中变更的记录，数据源中已不存在的记录从快照中删除
+func syncEntities(ctx context.Context, name string, ids []uint64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	syncLock.Lock()
+	defer syncLock.Unlock()
+
+	rows, err := source.Find(ctx, name, ids)
+	if err != nil {
+		log.Errorf(ctx, consts.ErrConfigSync, "sync %s %v error: %v", name, ids, err)
+		return
+	}
+
+	// 新上线（或重新上线）的应用，拉取其全部秘钥、限流规则、授权
+	if name == "tbl_app_info" {
+		var newAppids []uint64
+		for _, info := range rows.AppInfos {
+			if !table.Current().HasAppInfo(info.Appid) {
+				newAppids = append(newAppids, info.Appid)
+			}
+		}
+
+		if len(newAppids) > 0 {
+			appRows, err := source.AppRows(ctx, newAppids)
+			if err != nil {
+				log.Errorf(ctx, consts.ErrConfigSync, "sync config of new app %v error: %v", newAppids, err)
+				return
+			}
+
+			rows.AppSecrets = appRows.AppSecrets
+			rows.RateLimits = appRows.RateLimits
+			rows.AccessDBs = appRows.AccessDBs
+			rows.AccessTables = appRows.AccessTables
+		}
+	}
+
+	// 以快照中的记录加上拉取到的记录为全量主键，通知中拉取不到的记录视为已删除
+	keys := table.Current().Keys()
+	keys.AddRows(rows)
+
+	found := rows.Keys(name)
+	for _, id := range ids {
+		if !found[id] {
+			keys.Remove(name, id)
+		}
+	}
+
+	version, changes := table.UpdateDBInfo(rows, keys)
+	if len(changes) > 0 {
+		log.Infof(ctx, "config snapshot v%d published by notice, %d changes: %s",
+			version, len(changes), strings.Join(changes, "; "))
+		saveSnapshot(ctx)
+	}
+}
+
+func validNotice(n *Notice) bool {
+	switch n.Table {
+	case "", "*", "tbl_plugin", "tbl_table_plugin", "tbl_workspace":
+		return true
+	default:
+		return (&table.SyncKeys{}).Remove(n.Table, 0)
+	}
+}
+
+// memoryBus 进程内变更通知通道
+type memoryBus struct {
+	lock     sync.RWMutex
+	handlers []func(ctx context.Context, notices []*Notice)
+}
+
+func newMemoryBus() *memoryBus {
+	return &memoryBus{}
+}
+
+// Publish 同步通知所有订阅者
+func (b *memoryBus) Publish(ctx context.Context, notices []*Notice) error {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	for _, handle := range b.handlers {
+		handle(ctx, notices)
+	}
+
+	return nil
+}
+
+// Subscribe 订阅变更通知
+func (b *memoryBus) Subscribe(ctx context.Context, handle func(ctx context.Context, notices []*Notice)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.handlers = append(b.handlers, handle)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/json"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+	"github.com/horm-database/orm/database/redis"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+const (
+	redisPublish        = "publish"
+	redisDialTimeout    = time.Second
+	redisReconnectDelay = time.Second
+)
+
+// redisBus redis 发布订阅变更通知通道，消息为 Notice 列表的 json。每次发布、订阅连接时从快照获取库信息，库地址变更后生效
+type redisBus struct {
+	store   string // tbl_db 中配置的 redis 库名
+	channel string
+}
+
+func newRedisBus(store, channel string) (*redisBus, error) {
+	if _, err := getRedisDB(table.Current(), store); err != nil {
+		return nil, err
+	}
+
+	return &redisBus{store: store, channel: channel}, nil
+}
+
+// getRedisDB 从快照获取通知通道所在 redis 库
+func getRedisDB(snap *table.Snapshot, store string) (*obj.TblDB, error) {
+	db := snap.GetDBByName(store)
+	if db == nil || db.Addr == nil || db.Addr.Type != cc.DBTypeRedis || db.Addr.Conn == nil {
+		return nil, fmt.Errorf("config notify store [%s] is not a redis db in config version %d", store, snap.Version)
+	}
+
+	return db, nil
+}
+
+// Publish 发布变更通知
+func (b *redisBus) Publish(ctx context.Context, notices []*Notice) error {
+	msg, err := json.Api.Marshal(notices)
+	if err != nil {
+		return err
+	}
+
+	db, err := getRedisDB(table.Snap(ctx), b.store)
+	if err != nil {
+		return err
+	}
+
+	query := redis.Redis{Cmd: redisPublish, Key: b.channel, Args: []interface{}{msg}, Addr: db.Addr}
+
+	_, _, _, err = query.Query(ctx)
+	if err != nil {
+		return fmt.Errorf("publish config notice to %s error: %v", b.channel, err)
+	}
+
+	return nil
+}
+
+// Subscribe 使用独立连接订阅频道，连接断开后重连，并全量同步一次以补偿断开期间丢失的通知
+func (b *redisBus) Subscribe(ctx context.Context, handle func(ctx context.Context, notices []*Notice)) {
+	for reconnect := false; ctx.Err() == nil; reconnect = true {
+		if reconnect {
+			time.Sleep(redisReconnectDelay)
+		}
+
+		err := b.receive(ctx, handle, reconnect)
+		if err != nil && ctx.Err() == nil {
+			metrics.IncrCounter("ConfigNotifyFail", 1)
+			log.Errorf(ctx, consts.ErrConfigSync, "config notify subscribe %s error: %v", b.channel, err)
+		}
+	}
+}
+
+func (b *redisBus) receive(ctx context.Context,
+	handle func(ctx context.Context, notices []*Notice), reconnect bool) error {
+	db, err := getRedisDB(table.Current(), b.store)
+	if err != nil {
+		return err
+	}
+
+	conn, err := redigo.DialURL("redis://"+db.Addr.Conn.DSN,
+		redigo.DialPassword(db.Addr.Conn.Password), redigo.DialConnectTimeout(redisDialTimeout))
+	if err != nil {
+		return err
+	}
+
+	psc := redigo.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err = psc.Subscribe(b.channel); err != nil {
+		return err
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() { // 服务退出时关闭连接，结束阻塞的 Receive
+		select {
+		case <-ctx.Done():
+			_ = psc.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redigo.Subscription:
+			if v.Kind == "subscribe" && reconnect {
+				handle(ctx, []*Notice{{Table: "*"}})
+			}
+		case redigo.Message:
+			var notices []*Notice
+			if err = json.Api.Unmarshal(v.Data, &notices); err != nil {
+				log.Errorf(ctx, consts.ErrConfigSync, "decode config notice [%s] error: %v", v.Data, err)
+				continue
+			}
+
+			handle(ctx, notices)
+		case error:
+			return v
+		}
+	}
+}
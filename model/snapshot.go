@@ -0,0 +1,177 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/horm-database/common/json"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+const (
+	defaultSnapshotKeep = 5
+	snapshotPrefix      = "config-"
+	snapshotSuffix      = ".json"
+)
+
+var (
+	snapshotDir  string                // 本地配置快照目录，为空不保存快照
+	snapshotKeep = defaultSnapshotKeep // 最多保留的快照文件数
+	saveLock     sync.Mutex            // 串行写快照文件
+	degraded     atomic.Bool           // 是否以本地快照启动、配置数据源尚未恢复（只读配置模式）
+)
+
+// SetSnapshot 设置本地配置快照目录及最多保留的快照文件数（默认 5），每次同步发布新配置后保存快照，
+// 启动时配置数据源不可用则从最新的快照启动。快照包含应用秘钥，文件权限为 0600
+func SetSnapshot(dir string, keep int) {
+	snapshotDir = dir
+	if keep <= 0 {
+		keep = defaultSnapshotKeep
+	}
+	snapshotKeep = keep
+}
+
+// Degraded 是否处于只读配置模式：启动时配置数据源不可用，以本地快照启动，且数据源尚未恢复
+func Degraded() bool {
+	return degraded.Load()
+}
+
+// saveSnapshot 保存当前快照到本地，只读配置模式下不保存，避免覆盖数据源的最新配置
+func saveSnapshot(ctx context.Context) {
+	if snapshotDir == "" || degraded.Load() {
+		return
+	}
+
+	saveLock.Lock()
+	defer saveLock.Unlock()
+
+	d := table.Current().Dump()
+
+	buf, err := json.Api.Marshal(d)
+	if err != nil {
+		log.Errorf(ctx, consts.ErrConfigSnapshot, "encode config snapshot v%d error: %v", d.Version, err)
+		return
+	}
+
+	err = os.MkdirAll(snapshotDir, 0755)
+	if err != nil {
+		log.Errorf(ctx, consts.ErrConfigSnapshot, "create config snapshot dir %s error: %v", snapshotDir, err)
+		return
+	}
+
+	name := fmt.Sprintf("%s%s-v%d%s", snapshotPrefix,
+		d.Time.Format("20060102150405.000000"), d.Version, snapshotSuffix)
+	path := filepath.Join(snapshotDir, name)
+
+	// 先写临时文件再改名，避免进程退出时留下不完整的快照
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0600); err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp)
+		log.Errorf(ctx, consts.ErrConfigSnapshot, "write config snapshot %s error: %v", path, err)
+		return
+	}
+
+	files, err := snapshotFiles()
+	if err != nil {
+		log.Errorf(ctx, consts.ErrConfigSnapshot, "list config snapshot dir %s error: %v", snapshotDir, err)
+		return
+	}
+
+	for i := 0; i < len(files)-snapshotKeep; i++ {
+		if err = os.Remove(files[i]); err != nil {
+			log.Errorf(ctx, consts.ErrConfigSnapshot, "remove config snapshot %s error: %v", files[i], err)
+		}
+	}
+}
+
+// loadSnapshot 加载最新的可用快照，最新的快照损坏时依次尝试更早的快照
+func loadSnapshot() (*table.Dump, string, error) {
+	files, err := snapshotFiles()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no config snapshot in %s", snapshotDir)
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		var buf []byte
+		buf, err = os.ReadFile(files[i])
+		if err != nil {
+			continue
+		}
+
+		d := table.Dump{}
+		if err = json.Api.Unmarshal(buf, &d); err != nil {
+			err = fmt.Errorf("decode config snapshot %s error: %v", files[i], err)
+			continue
+		}
+
+		return &d, files[i], nil
+	}
+
+	return nil, "", err
+}
+
+// snapshotFiles 快照文件，按保存时间升序
+func snapshotFiles() ([]string, error) {
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			files = append(files, filepath.Join(snapshotDir, name))
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// restoreSnapshot 从本地快照恢复 workspace、库、表、应用权限及插件配置，插件链无法恢复时返回错误，不发布任何配置
+func restoreSnapshot(d *table.Dump) error {
+	_, _, err := table.LoadPlugins(d.Plugins, d.TablePlugins)
+	if err != nil {
+		return fmt.Errorf("restore plugin error: %v", err)
+	}
+
+	if d.Workspace != nil {
+		table.SetWorkspace(d.Workspace)
+	}
+
+	table.UpdateDBInfo(d.Rows(), nil)
+
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/horm-database/go-horm/horm"
+	"github.com/horm-database/orm"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+// Source 配置数据源，提供 workspace、库、表、应用及其秘钥、限流规则、授权、插件配置
+type Source interface {
+	// Workspace 获取 workspace 信息，没有时返回 nil
+	Workspace(ctx context.Context) (*table.TblWorkspace, error)
+
+	// Rows 获取 since 之后新增、修改的配置，since 为零值时返回全部配置
+	Rows(ctx context.Context, since time.Time) (*table.ConfigRows, error)
+
+	// AppRows 获取指定应用的全部秘钥、限流规则、授权
+	AppRows(ctx context.Context, appids []uint64) (*table.ConfigRows, error)
+
+	// Find 获取表 name 中主键为 ids 的记录，tbl_app_info 的主键为 appid，不存在的记录不返回
+	Find(ctx context.Context, name string, ids []uint64) (*table.ConfigRows, error)
+
+	// Keys 获取当前存在的所有记录主键，用于全量对账
+	Keys(ctx context.Context) (*table.SyncKeys, error)
+
+	// Plugins 获取全部插件及表插件
+	Plugins(ctx context.Context) ([]*table.TblPlugin, []*table.TblTablePlugin, error)
+}
+
+var source Source = dbSource{}
+
+// SetSource 设置配置数据源，typ 为 db（默认，consts.DBConfigName 配置库）或 file（dir 目录下的 yaml/json 文件），
+// 需要在 Init 之前调用
+func SetSource(typ, dir string) error {
+	switch typ {
+	case "", consts.ConfigSourceDB:
+		source = dbSource{}
+	case consts.ConfigSourceFile:
+		if dir == "" {
+			return fmt.Errorf("config source file dir is empty")
+		}
+		source = newFileSource(dir)
+	default:
+		return fmt.Errorf("unknown config source type [%s], should be db or file", typ)
+	}
+
+	return nil
+}
+
+// dbSource 配置库数据源
+type dbSource struct{}
+
+// Workspace 获取 workspace 信息
+func (dbSource) Workspace(ctx context.Context) (*table.TblWorkspace, error) {
+	var workspace table.TblWorkspace
+	_, err := orm.NewORM(consts.DBConfigName).
+		Name("tbl_workspace").Find().Exec(ctx, &workspace)
+	if err != nil {
+		return nil, fmt.Errorf("find tbl_workspace error: %v", err)
+	}
+
+	if workspace.Id == 0 {
+		return nil, nil
+	}
+
+	return &workspace, nil
+}
+
+// Rows 查询 updated_at 不早于 since 的库、表、表别名、应用及其秘钥、限流规则、授权记录
+func (dbSource) Rows(ctx context.Context, since time.Time) (*table.ConfigRows, error) {
+	var where horm.Where
+	if !since.IsZero() {
+		where = horm.Where{"updated_at >=": since.Format("2006-01-02 15:04:05")}
+	}
+
+	c := orm.NewORM(consts.DBConfigName)
+	rows := &table.ConfigRows{}
+
+	for name, result := range map[string]interface{}{
+		"tbl_db":          &rows.DBs,
+		"tbl_table":       &rows.Tables,
+		"tbl_table_alias": &rows.TableAliases,
+		"tbl_app_info":    &rows.AppInfos,
+	} {
+		_, err := c.Name(name).FindAll(where).Exec(ctx, result)
+		if err != nil {
+			return nil, fmt.Errorf("find %s error: %v", name, err)
+		}
+	}
+
+	err := findAppRows(ctx, c, where, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// AppRows 查询应用的全部秘钥、限流规则、授权记录
+func (dbSource) AppRows(ctx context.Context, appids []uint64) (*table.ConfigRows, error) {
+	rows := &table.ConfigRows{}
+
+	err := findAppRows(ctx, orm.NewORM(consts.DBConfigName), horm.Where{"appid": appids}, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// Find 查询表 name 中主键为 ids 的记录
+func (dbSource) Find(ctx context.Context, name string, ids []uint64) (*table.ConfigRows, error) {
+	rows := &table.ConfigRows{}
+
+	result, ok := configResult(rows, name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported config table %s", name)
+	}
+
+	pk := "id"
+	if name == "tbl_app_info" {
+		pk = "appid"
+	}
+
+	_, err := orm.NewORM(consts.DBConfigName).Name(name).FindAll(horm.Where{pk: ids}).Exec(ctx, result)
+	if err != nil {
+		return nil, fmt.Errorf("find %s error: %v", name, err)
+	}
+
+	return rows, nil
+}
+
+// Keys 获取配置库中当前存在的所有记录主键
+func (dbSource) Keys(ctx context.Context) (*table.SyncKeys, error) {
+	c := orm.NewORM(consts.DBConfigName)
+	keys := table.SyncKeys{}
+
+	var err error
+
+	if keys.DBs, err = syncIDs(ctx, c, "tbl_db"); err != nil {
+		return nil, err
+	}
+
+	if keys.Tables, err = syncIDs(ctx, c, "tbl_table"); err != nil {
+		return nil, err
+	}
+
+	if keys.TableAliases, err = syncIDs(ctx, c, "tbl_table_alias"); err != nil {
+		return nil, err
+	}
+
+	if keys.AppSecrets, err = syncIDs(ctx, c, "tbl_app_secret"); err != nil {
+		return nil, err
+	}
+
+	if keys.RateLimits, err = syncIDs(ctx, c, "tbl_rate_limit"); err != nil {
+		return nil, err
+	}
+
+	if keys.AccessDBs, err = syncIDs(ctx, c, "tbl_access_db"); err != nil {
+		return nil, err
+	}
+
+	if keys.AccessTables, err = syncIDs(ctx, c, "tbl_access_table"); err != nil {
+		return nil, err
+	}
+
+	apps := make([]*table.TblAppInfo, 0)
+	_, err = c.Name("tbl_app_info").Column("appid").FindAll().Exec(ctx, &apps)
+	if err != nil {
+		return nil, fmt.Errorf("find tbl_app_info appid error: %v", err)
+	}
+
+	keys.Apps = make(map[uint64]bool, len(apps))
+	for _, app := range apps {
+		keys.Apps[app.Appid] = true
+	}
+
+	return &keys, nil
+}
+
+// Plugins 获取全部插件及表插件
+func (dbSource) Plugins(ctx context.Context) ([]*table.TblPlugin, []*table.TblTablePlugin, error) {
+	plugin := make([]*table.TblPlugin, 0)
+	tablePlugin := make([]*table.TblTablePlugin, 0)
+
+	c := orm.NewORM(consts.DBConfigName)
+
+	_, err := c.Name("tbl_plugin").FindAll().Exec(ctx, &plugin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("find tbl_plugin error: %v", err)
+	}
+
+	_, err = c.Name("tbl_table_plugin").FindAll().Exec(ctx, &tablePlugin)
+	if err != nil {
+		return nil, nil, fmt.Errorf("find tbl_table_plugin error: %v", err)
+	}
+
+	return plugin, tablePlugin, nil
+}
+
+// findAppRows 查询满足条件的应用秘钥、限流规则、授权记录
+func findAppRows(ctx context.Context, c *orm.ORM, where horm.Where, rows *table.ConfigRows) error {
+	for name, result := range map[string]interface{}{
+		"tbl_app_secret":   &rows.AppSecrets,
+		"tbl_rate_limit":   &rows.RateLimits,
+		"tbl_access_db":    &rows.AccessDBs,
+		"tbl_access_table": &rows.AccessTables,
+	} {
+		_, err := c.Name(name).FindAll(where).Exec(ctx, result)
+		if err != nil {
+			return fmt.Errorf("find %s error: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// configResult 表 name 的记录在 rows 中对应的字段
+func configResult(rows *table.ConfigRows, name string) (interface{}, bool) {
+	switch name {
+	case "tbl_db":
+		return &rows.DBs, true
+	case "tbl_table":
+		return &rows.Tables, true
+	case "tbl_table_alias":
+		return &rows.TableAliases, true
+	case "tbl_app_info":
+		return &rows.AppInfos, true
+	case "tbl_app_secret":
+		return &rows.AppSecrets, true
+	case "tbl_rate_limit":
+		return &rows.RateLimits, true
+	case "tbl_access_db":
+		return &rows.AccessDBs, true
+	case "tbl_access_table":
+		return &rows.AccessTables, true
+	default:
+		return nil, false
+	}
+}
+
+func syncIDs(ctx context.Context, c *orm.ORM, name string) (map[int]bool, error) {
+	rows := make([]*struct {
+		Id int `orm:"id,int"`
+	}, 0)
+
+	_, err := c.Name(name).Column("id").FindAll().Exec(ctx, &rows)
+	if err != nil {
+		return nil, fmt.Errorf("find %s id error: %v", name, err)
+	}
+
+	ids := make(map[int]bool, len(rows))
+	for _, row := range rows {
+		ids[row.Id] = true
+	}
+
+	return ids, nil
+}
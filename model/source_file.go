@@ -0,0 +1,450 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/horm-database/common/json"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/model/table"
+	"gopkg.in/yaml.v3"
+)
+
+// fileTables 文件数据源支持的配置表，每个表对应目录下的一个 <表名>.yaml、<表名>.yml 或 <表名>.json 文件，
+// 文件内容为记录列表，字段与配置库表字段相同，tbl_workspace 为单条记录。文件不存在时表为空
+var fileTables = []string{
+	"tbl_workspace",
+	"tbl_db",
+	"tbl_table",
+	"tbl_table_alias",
+	"tbl_app_info",
+	"tbl_app_secret",
+	"tbl_rate_limit",
+	"tbl_access_db",
+	"tbl_access_table",
+	"tbl_plugin",
+	"tbl_table_plugin",
+}
+
+var fileExts = []string{".yaml", ".yml", ".json"}
+
+// fileSource 本地目录配置数据源，每轮同步 stat 轮询文件大小、修改时间（不监听文件事件），有变化时重新加载，
+// 修改在一个同步周期内生效。文件解析失败时保留上一次成功加载的配置
+type fileSource struct {
+	dir string
+
+	lock    sync.Mutex
+	sign    string                       // 配置文件签名（文件名、大小、修改时间）
+	data    map[string][]fileRow         // 最近一次成功加载的配置，key 为表名
+	keys    *table.SyncKeys              // 最近一次成功加载的配置主键
+	applied map[string]map[string]string // 已生效的记录，表名 -> 主键 -> 记录 json
+	pending map[string]map[string]string // 上一次 Rows 返回后的记录，调用方推进 since 后才生效
+	since   time.Time                    // 上一次 Rows 的 since
+}
+
+// fileRow 文件中的一条记录，保存 json 原文，每次返回时重新解析，已发布快照中的配置不会被修改
+type fileRow struct {
+	key   string
+	id    int
+	appid uint64
+	raw   []byte
+}
+
+func newFileSource(dir string) *fileSource {
+	return &fileSource{dir: dir}
+}
+
+// Workspace 获取 tbl_workspace 文件中的 workspace 信息
+func (s *fileSource) Workspace(ctx context.Context) (*table.TblWorkspace, error) {
+	data, _, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := data["tbl_workspace"]
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	var workspace table.TblWorkspace
+	if err = json.Api.Unmarshal(rows[0].raw, &workspace); err != nil {
+		return nil, fmt.Errorf("decode tbl_workspace error: %v", err)
+	}
+
+	if workspace.Id == 0 {
+		return nil, nil
+	}
+
+	return &workspace, nil
+}
+
+// Rows 文件没有可靠的修改时间，返回与已生效记录不同的记录，since 为零值时返回全部记录。
+// 调用方只在应用成功后推进 since，since 大于上一次的 since 时上一次返回的记录才算生效，否则重新返回
+func (s *fileSource) Rows(ctx context.Context, since time.Time) (*table.ConfigRows, error) {
+	data, _, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if since.IsZero() {
+		s.applied = nil
+	} else if s.pending != nil && since.After(s.since) {
+		s.applied = s.pending
+	}
+
+	changed := map[string][]fileRow{}
+	rowed := make(map[string]map[string]string, len(data))
+
+	for name, rows := range data {
+		last := s.applied[name]
+		cur := make(map[string]string, len(rows))
+
+		for _, row := range rows {
+			cur[row.key] = string(row.raw)
+			if last[row.key] != string(row.raw) {
+				changed[name] = append(changed[name], row)
+			}
+		}
+
+		rowed[name] = cur
+	}
+
+	ret, err := decodeConfigRows(changed, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pending, s.since = rowed, since
+
+	return ret, nil
+}
+
+// AppRows 获取文件中指定应用的全部秘钥、限流规则、授权
+func (s *fileSource) AppRows(ctx context.Context, appids []uint64) (*table.ConfigRows, error) {
+	data, _, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make(map[uint64]bool, len(appids))
+	for _, appid := range appids {
+		apps[appid] = true
+	}
+
+	return decodeConfigRows(map[string][]fileRow{
+		"tbl_app_secret":   data["tbl_app_secret"],
+		"tbl_rate_limit":   data["tbl_rate_limit"],
+		"tbl_access_db":    data["tbl_access_db"],
+		"tbl_access_table": data["tbl_access_table"],
+	}, apps)
+}
+
+// Find 获取文件中表 name 主键为 ids 的记录
+func (s *fileSource) Find(ctx context.Context, name string, ids []uint64) (*table.ConfigRows, error) {
+	if _, ok := configResult(&table.ConfigRows{}, name); !ok {
+		return nil, fmt.Errorf("unsupported config table %s", name)
+	}
+
+	data, _, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		keys[fmt.Sprint(id)] = true
+	}
+
+	var rows []fileRow
+	for _, row := range data[name] {
+		if keys[row.key] {
+			rows = append(rows, row)
+		}
+	}
+
+	return decodeConfigRows(map[string][]fileRow{name: rows}, nil)
+}
+
+// Keys 获取文件中当前存在的所有记录主键
+func (s *fileSource) Keys(ctx context.Context) (*table.SyncKeys, error) {
+	_, keys, err := s.load()
+	return keys, err
+}
+
+// Plugins 获取文件中的全部插件及表插件
+func (s *fileSource) Plugins(ctx context.Context) ([]*table.TblPlugin, []*table.TblTablePlugin, error) {
+	data, _, err := s.load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plugin, err := decodeRows[table.TblPlugin]("tbl_plugin", data["tbl_plugin"], nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tablePlugin, err := decodeRows[table.TblTablePlugin]("tbl_table_plugin", data["tbl_table_plugin"], nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return plugin, tablePlugin, nil
+}
+
+// load 配置文件有变化时重新加载，返回最近一次成功加载的配置，加载失败时返回错误及上一次的配置
+func (s *fileSource) load() (map[string][]fileRow, *table.SyncKeys, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	files, sign, err := s.scan()
+	if err == nil && (s.data == nil || sign != s.sign) {
+		var data map[string][]fileRow
+		data, err = readFiles(files)
+		if err == nil {
+			s.data, s.keys, s.sign = data, fileKeys(data), sign
+		}
+	}
+
+	if err != nil && s.data == nil {
+		return nil, nil, err
+	}
+
+	return s.data, s.keys, err
+}
+
+// scan 查找各表的配置文件，返回表名 -> 文件路径及文件签名
+func (s *fileSource) scan() (map[string]string, string, error) {
+	files := map[string]string{}
+
+	var sign strings.Builder
+	for _, name := range fileTables {
+		for _, ext := range fileExts {
+			path := filepath.Join(s.dir, name+ext)
+
+			info, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			if err != nil {
+				return nil, "", fmt.Errorf("stat config file %s error: %v", path, err)
+			}
+
+			if _, ok := files[name]; ok {
+				return nil, "", fmt.Errorf("duplicate config file of %s in %s", name, s.dir)
+			}
+
+			files[name] = path
+			fmt.Fprintf(&sign, "%s:%d:%d;", path, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+
+	return files, sign.String(), nil
+}
+
+// readFiles 读取并解析配置文件
+func readFiles(files map[string]string) (map[string][]fileRow, error) {
+	data := make(map[string][]fileRow, len(files))
+
+	for name, path := range files {
+		rows, err := readFile(name, path)
+		if err != nil {
+			return nil, err
+		}
+
+		data[name] = rows
+	}
+
+	return data, nil
+}
+
+// readFile 解析配置文件，yaml 先解析为通用结构再转为 json，与 json 文件一样按 json tag 解析到配置结构
+func readFile(name, path string) ([]fileRow, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file %s error: %v", path, err)
+	}
+
+	var content interface{}
+	if filepath.Ext(path) == ".json" {
+		err = json.Api.Unmarshal(buf, &content)
+	} else {
+		err = yaml.Unmarshal(buf, &content)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s error: %v", path, err)
+	}
+
+	var items []interface{}
+	switch v := content.(type) {
+	case nil:
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		if name != "tbl_workspace" {
+			return nil, fmt.Errorf("config file %s should be a list of %s records", path, name)
+		}
+		items = []interface{}{v}
+	default:
+		return nil, fmt.Errorf("config file %s should be a list of %s records", path, name)
+	}
+
+	rows := make([]fileRow, 0, len(items))
+	exists := make(map[string]bool, len(items))
+
+	for i, item := range items {
+		raw, err := json.Api.Marshal(item)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s record %d encode error: %v", path, i, err)
+		}
+
+		row := fileRow{raw: raw}
+
+		var pk struct {
+			Id    int    `json:"id"`
+			Appid uint64 `json:"appid"`
+		}
+
+		if err = json.Api.Unmarshal(raw, &pk); err != nil {
+			return nil, fmt.Errorf("config file %s record %d decode error: %v", path, i, err)
+		}
+
+		row.id, row.appid = pk.Id, pk.Appid
+
+		if name == "tbl_app_info" {
+			row.key = fmt.Sprint(pk.Appid)
+		} else {
+			row.key = fmt.Sprint(pk.Id)
+		}
+
+		if row.key == "0" && name != "tbl_workspace" {
+			return nil, fmt.Errorf("config file %s record %d has no primary key", path, i)
+		}
+
+		if exists[row.key] {
+			return nil, fmt.Errorf("config file %s has duplicate primary key %s", path, row.key)
+		}
+
+		exists[row.key] = true
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// fileKeys 配置文件中的记录主键
+func fileKeys(data map[string][]fileRow) *table.SyncKeys {
+	ids := func(name string) map[int]bool {
+		ret := make(map[int]bool, len(data[name]))
+		for _, row := range data[name] {
+			ret[row.id] = true
+		}
+		return ret
+	}
+
+	keys := table.SyncKeys{
+		DBs:          ids("tbl_db"),
+		Tables:       ids("tbl_table"),
+		TableAliases: ids("tbl_table_alias"),
+		AppSecrets:   ids("tbl_app_secret"),
+		RateLimits:   ids("tbl_rate_limit"),
+		AccessDBs:    ids("tbl_access_db"),
+		AccessTables: ids("tbl_access_table"),
+		Apps:         make(map[uint64]bool, len(data["tbl_app_info"])),
+	}
+
+	for _, row := range data["tbl_app_info"] {
+		keys.Apps[row.appid] = true
+	}
+
+	return &keys
+}
+
+// decodeConfigRows 将记录解析为库、表、表别名、应用及其秘钥、限流规则、授权，apps 不为空时只返回这些应用的记录
+func decodeConfigRows(data map[string][]fileRow, apps map[uint64]bool) (*table.ConfigRows, error) {
+	rows := &table.ConfigRows{}
+
+	var err error
+
+	if rows.DBs, err = decodeRows[obj.TblDB]("tbl_db", data["tbl_db"], apps); err != nil {
+		return nil, err
+	}
+
+	if rows.Tables, err = decodeRows[obj.TblTable]("tbl_table", data["tbl_table"], apps); err != nil {
+		return nil, err
+	}
+
+	if rows.TableAliases, err = decodeRows[table.TblTableAlias]("tbl_table_alias",
+		data["tbl_table_alias"], apps); err != nil {
+		return nil, err
+	}
+
+	if rows.AppInfos, err = decodeRows[table.TblAppInfo]("tbl_app_info", data["tbl_app_info"], apps); err != nil {
+		return nil, err
+	}
+
+	if rows.AppSecrets, err = decodeRows[table.TblAppSecret]("tbl_app_secret",
+		data["tbl_app_secret"], apps); err != nil {
+		return nil, err
+	}
+
+	if rows.RateLimits, err = decodeRows[table.TblRateLimit]("tbl_rate_limit",
+		data["tbl_rate_limit"], apps); err != nil {
+		return nil, err
+	}
+
+	if rows.AccessDBs, err = decodeRows[table.TblAccessDB]("tbl_access_db",
+		data["tbl_access_db"], apps); err != nil {
+		return nil, err
+	}
+
+	if rows.AccessTables, err = decodeRows[table.TblAccessTable]("tbl_access_table",
+		data["tbl_access_table"], apps); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// decodeRows 将记录解析为新的配置结构，apps 不为空时只返回这些应用的记录
+func decodeRows[T any](name string, rows []fileRow, apps map[uint64]bool) ([]*T, error) {
+	ret := make([]*T, 0, len(rows))
+
+	for _, row := range rows {
+		if apps != nil && !apps[row.appid] {
+			continue
+		}
+
+		v := new(T)
+		if err := json.Api.Unmarshal(row.raw, v); err != nil {
+			return nil, fmt.Errorf("decode %s record %s error: %v", name, row.key, err)
+		}
+
+		ret = append(ret, v)
+	}
+
+	return ret, nil
+}
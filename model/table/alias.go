@@ -0,0 +1,123 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"strings"
+
+	"github.com/horm-database/common/util"
+	"github.com/horm-database/server/consts"
+)
+
+const shardSeparator = "_" // 分表名中表名与分表后缀的分隔符，比如 student_0
+
+func (b *builder) setAlias(alias *TblTableAlias) {
+	if old := b.aliasMap[alias.Id]; old != nil {
+		b.deleteAlias(old)
+	}
+
+	_, tableName := util.Namespace(alias.Alias)
+
+	if _, exists := b.aliasNameMap[tableName]; !exists {
+		b.aliasNameMap[tableName] = map[int]*TblTableAlias{}
+	}
+
+	b.aliasMap[alias.Id] = alias
+	b.aliasNameMap[tableName][alias.Id] = alias
+}
+
+func (b *builder) deleteAlias(alias *TblTableAlias) {
+	delete(b.aliasMap, alias.Id)
+
+	_, tableName := util.Namespace(alias.Alias)
+
+	aliases := b.aliasNameMap[tableName]
+	delete(aliases, alias.Id)
+	if len(aliases) == 0 {
+		delete(b.aliasNameMap, tableName)
+	}
+}
+
+// getAlias 获取执行单元名对应的表别名，应用的别名优先于 workspace 的别名（appid 为 0）。
+// 别名不能遮蔽同名物理表，同名物理表（执行单元名带库名时为该库下的同名表）映射到其它表时为歧义。
+// 执行单元名不带库名时，没有同样不带库名的别名，则带库名的同名别名与同名物理表一起参与歧义判断，映射到多个表时为歧义
+func (s *Snapshot) getAlias(appid uint64, dbname, tableName string) (alias *TblTableAlias, ambiguous bool) {
+	aliases := s.aliasNameMap[tableName]
+	if len(aliases) == 0 {
+		return nil, false
+	}
+
+	exact := map[string]*TblTableAlias{} // 别名中的库名 -> 表别名
+	for _, a := range aliases {
+		if a.Status != consts.TableAliasStatusNormal || (a.Appid != appid && a.Appid != 0) {
+			continue
+		}
+
+		aliasDB, _ := util.Namespace(a.Alias)
+		if old := exact[aliasDB]; old == nil || old.Appid == 0 {
+			exact[aliasDB] = a
+		}
+	}
+
+	if a := exact[dbname]; a != nil {
+		db := s.dbNameMap[dbname]
+		for _, tbl := range s.tableMap[tableName] {
+			if tbl.Id != a.TableId && (dbname == "" || db != nil && tbl.DB == db.Id) {
+				return nil, true
+			}
+		}
+
+		return a, false
+	}
+
+	if dbname != "" || len(exact) == 0 {
+		return nil, false
+	}
+
+	targets := map[int]bool{}
+	for _, tbl := range s.tableMap[tableName] {
+		targets[tbl.Id] = true
+	}
+
+	for _, a := range exact {
+		targets[a.TableId] = true
+		alias = a
+	}
+
+	if len(targets) > 1 {
+		return nil, true
+	}
+
+	return alias, false
+}
+
+// aliasShard 分表名中的别名前缀替换为物理表名，使分表名可以通过物理表的 table_verify 校验。
+// 只替换与别名相同、或者别名之后紧跟分隔符的分表名，别名 student 不会改写 students_1
+func aliasShard(aliasName, tableName string, shard []string) []string {
+	if aliasName == tableName {
+		return shard
+	}
+
+	tables := make([]string, len(shard))
+	for i, name := range shard {
+		if name == aliasName || strings.HasPrefix(name, aliasName+shardSeparator) {
+			tables[i] = tableName + name[len(aliasName):]
+		} else {
+			tables[i] = name
+		}
+	}
+
+	return tables
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/consts"
+)
+
+func TestAliasShard(t *testing.T) {
+	shard := []string{"student", "student_1", "student_2024061211", "students_1", "studentx"}
+	want := []string{"tbl_student", "tbl_student_1", "tbl_student_2024061211", "students_1", "studentx"}
+
+	if got := aliasShard("student", "tbl_student", shard); !reflect.DeepEqual(got, want) {
+		t.Errorf("aliasShard = %v, want %v", got, want)
+	}
+
+	if got := aliasShard("student", "student", shard); !reflect.DeepEqual(got, shard) {
+		t.Errorf("aliasShard = %v, want %v", got, shard)
+	}
+}
+
+// 别名不能遮蔽映射到其它表的同名物理表
+func TestGetAliasShadowsTable(t *testing.T) {
+	db1, db2 := &obj.TblDB{Id: 1, Name: "db1"}, &obj.TblDB{Id: 2, Name: "db2"}
+	tables := []*obj.TblTable{
+		{Id: 1, DB: db1.Id, Name: "student"},
+		{Id: 2, DB: db2.Id, Name: "tbl_student"},
+		{Id: 3, DB: db2.Id, Name: "teacher"},
+	}
+
+	cases := []struct {
+		alias     string
+		tableID   int
+		dbname    string
+		name      string
+		ambiguous bool
+		found     bool
+	}{
+		{"student", 2, "", "student", true, false},         // 与 db1 的物理表 student 冲突
+		{"student", 1, "", "student", false, true},         // 映射到同名物理表本身
+		{"pupil", 2, "", "pupil", false, true},             // 没有同名物理表
+		{"db2::student", 2, "db2", "student", false, true}, // db2 下没有物理表 student
+		{"db2::teacher", 2, "db2", "teacher", true, false}, // 与 db2 的物理表 teacher 冲突
+		{"db2::teacher", 2, "db1", "teacher", false, false},
+	}
+
+	for _, c := range cases {
+		s := &Snapshot{
+			dbNameMap:    map[string]*obj.TblDB{db1.Name: db1, db2.Name: db2},
+			tableMap:     map[string]map[int]*obj.TblTable{},
+			aliasNameMap: map[string]map[int]*TblTableAlias{},
+		}
+
+		for _, tbl := range tables {
+			if s.tableMap[tbl.Name] == nil {
+				s.tableMap[tbl.Name] = map[int]*obj.TblTable{}
+			}
+			s.tableMap[tbl.Name][tbl.DB] = tbl
+		}
+
+		a := &TblTableAlias{Id: 1, Alias: c.alias, TableId: c.tableID, Status: consts.TableAliasStatusNormal}
+		s.aliasNameMap[c.name] = map[int]*TblTableAlias{a.Id: a}
+
+		alias, ambiguous := s.getAlias(100, c.dbname, c.name)
+		if ambiguous != c.ambiguous || (alias != nil) != c.found {
+			t.Errorf("alias %s -> table %d, name %s::%s: alias=%v, ambiguous=%v, want found=%v, ambiguous=%v",
+				c.alias, c.tableID, c.dbname, c.name, alias, ambiguous, c.found, c.ambiguous)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"time"
+
+	"github.com/horm-database/orm/obj"
+)
+
+// Dump 快照的原始配置记录，用于持久化到本地及从本地恢复快照。解析后的字段（库地址、插件配置等）不保存，恢复时重新解析
+type Dump struct {
+	Version      uint64            `json:"version"`   // 快照版本号
+	Time         time.Time         `json:"time"`      // 导出时间
+	Workspace    *TblWorkspace     `json:"workspace"` // workspace 信息
+	DBs          []*obj.TblDB      `json:"dbs"`
+	Tables       []*obj.TblTable   `json:"tables"`
+	AppInfos     []*TblAppInfo     `json:"app_infos"`
+	AppSecrets   []*TblAppSecret   `json:"app_secrets"`
+	RateLimits   []*TblRateLimit   `json:"rate_limits"`
+	AccessDBs    []*TblAccessDB    `json:"access_dbs"`
+	AccessTables []*TblAccessTable `json:"access_tables"`
+	TableAliases []*TblTableAlias  `json:"table_aliases"`
+	Plugins      []*TblPlugin      `json:"plugins"`
+	TablePlugins []*TblTablePlugin `json:"table_plugins"`
+}
+
+// Dump 导出快照的原始配置记录
+func (s *Snapshot) Dump() *Dump {
+	d := &Dump{Version: s.Version, Time: time.Now()}
+
+	if ws := s.workspace; ws.Id != 0 {
+		d.Workspace = &ws
+	}
+
+	for _, db := range s.dbMap {
+		c := *db
+		c.Addr = nil
+		d.DBs = append(d.DBs, &c)
+	}
+
+	for _, tbl := range s.tableIDMap {
+		d.Tables = append(d.Tables, tbl)
+	}
+
+	for _, alias := range s.aliasMap {
+		d.TableAliases = append(d.TableAliases, alias)
+	}
+
+	for _, appInfo := range s.appInfoMap {
+		d.AppInfos = append(d.AppInfos, appInfo.Info)
+
+		for _, secret := range appInfo.Secrets {
+			d.AppSecrets = append(d.AppSecrets, secret)
+		}
+
+		for _, rateLimit := range appInfo.RateLimits {
+			d.RateLimits = append(d.RateLimits, rateLimit)
+		}
+
+		for _, accessDB := range appInfo.AccessDB {
+			d.AccessDBs = append(d.AccessDBs, accessDB)
+		}
+
+		for _, accessTable := range appInfo.AccessTable {
+			d.AccessTables = append(d.AccessTables, accessTable)
+		}
+	}
+
+	for _, plugin := range s.plugins.plugin {
+		d.Plugins = append(d.Plugins, plugin)
+	}
+
+	for _, tf := range s.plugins.rows {
+		c := *tf
+		c.ScheduleConf, c.Conf = nil, nil
+		d.TablePlugins = append(d.TablePlugins, &c)
+	}
+
+	return d
+}
+
+// Rows 库、表、表别名、应用及其秘钥、限流规则、授权记录
+func (d *Dump) Rows() *ConfigRows {
+	return &ConfigRows{
+		DBs:          d.DBs,
+		Tables:       d.Tables,
+		AppInfos:     d.AppInfos,
+		AppSecrets:   d.AppSecrets,
+		RateLimits:   d.RateLimits,
+		AccessDBs:    d.AccessDBs,
+		AccessTables: d.AccessTables,
+		TableAliases: d.TableAliases,
+	}
+}
@@ -36,15 +36,43 @@ type TblWorkspace struct {
 }
 
 type TblAppInfo struct {
-	Appid     uint64    `orm:"appid,uint64" json:"appid"`                         // 应用appid
-	Name      string    `orm:"name,string" json:"name"`                           // 应用名称
-	Secret    string    `orm:"secret,string" json:"secret"`                       // 应用秘钥
-	Intro     string    `orm:"intro,string" json:"intro"`                         // 简介
-	Creator   uint64    `orm:"creator,uint64,omitempty" json:"creator,omitempty"` // Creator
-	Manager   string    `orm:"manager,string" json:"manager"`                     // 管理员，多个逗号分隔
-	Status    int8      `orm:"status,int8" json:"status"`                         // 1-正常 2-下线
-	CreatedAt time.Time `orm:"created_at,datetime,omitempty" json:"created_at"`   // 记录创建时间
-	UpdatedAt time.Time `orm:"updated_at,datetime,omitempty" json:"updated_at"`   // 记录最后修改时间
+	Appid       uint64    `orm:"appid,uint64" json:"appid"`                         // 应用appid
+	Name        string    `orm:"name,string" json:"name"`                           // 应用名称
+	Secret      string    `orm:"secret,string" json:"secret"`                       // 应用秘钥
+	ForbidMD5   int8      `orm:"forbid_md5,int8" json:"forbid_md5"`                 // 是否禁止 md5 签名 0-否 1-是
+	AllowIP     string    `orm:"allow_ip,string" json:"allow_ip"`                   // 允许访问的 ip 或 CIDR，逗号分隔，空串为不限制
+	CertSubject string    `orm:"cert_subject,string" json:"cert_subject"`           // 双向 tls 客户端证书 subject 或 CN，匹配的连接以该应用认证
+	Intro       string    `orm:"intro,string" json:"intro"`                         // 简介
+	Creator     uint64    `orm:"creator,uint64,omitempty" json:"creator,omitempty"` // Creator
+	Manager     string    `orm:"manager,string" json:"manager"`                     // 管理员，多个逗号分隔
+	Status      int8      `orm:"status,int8" json:"status"`                         // 1-正常 2-下线
+	CreatedAt   time.Time `orm:"created_at,datetime,omitempty" json:"created_at"`   // 记录创建时间
+	UpdatedAt   time.Time `orm:"updated_at,datetime,omitempty" json:"updated_at"`   // 记录最后修改时间
+}
+
+type TblAppSecret struct {
+	Id        int       `orm:"id,int,omitempty" json:"id"`
+	Appid     uint64    `orm:"appid,uint64" json:"appid"`                       // 应用appid
+	Secret    string    `orm:"secret,string" json:"secret"`                     // 应用秘钥
+	Status    int8      `orm:"status,int8" json:"status"`                       // 状态：1-正常 2-下线
+	ValidFrom time.Time `orm:"valid_from,datetime" json:"valid_from"`           // 生效时间，为空则立即生效
+	ValidTo   time.Time `orm:"valid_to,datetime" json:"valid_to"`               // 失效时间，为空则永久有效
+	CreatedAt time.Time `orm:"created_at,datetime,omitempty" json:"created_at"` // 记录创建时间
+	UpdatedAt time.Time `orm:"updated_at,datetime,omitempty" json:"updated_at"` // 记录最后修改时间
+}
+
+type TblRateLimit struct {
+	Id          int       `orm:"id,int,omitempty" json:"id"`
+	Appid       uint64    `orm:"appid,uint64" json:"appid"`                       // 应用appid
+	TableId     int       `orm:"table_id,int" json:"table_id"`                    // 表id，0 为应用维度限流
+	Op          string    `orm:"op,string" json:"op"`                             // 限流的表操作，空串为所有操作
+	QPS         int       `orm:"qps,int" json:"qps"`                              // 每秒请求数，0 为不限制
+	Burst       int       `orm:"burst,int" json:"burst"`                          // 突发请求数，0 时等于 qps
+	MaxInflight int       `orm:"max_inflight,int" json:"max_inflight"`            // 单实例最大并发请求数，0 为不限制
+	Scope       int8      `orm:"scope,int8" json:"scope"`                         // 限流范围 1-单实例 2-集群
+	Status      int8      `orm:"status,int8" json:"status"`                       // 状态：1-正常 2-下线
+	CreatedAt   time.Time `orm:"created_at,datetime,omitempty" json:"created_at"` // 记录创建时间
+	UpdatedAt   time.Time `orm:"updated_at,datetime,omitempty" json:"updated_at"` // 记录最后修改时间
 }
 
 type TblAccessDB struct {
@@ -54,6 +82,8 @@ type TblAccessDB struct {
 	Root      int8      `orm:"root,int8" json:"root"`                                   // 超级权限 1-超级权限（所有权限，包含DDL）  2-表数据权限（库下表的所有增删改查权限，不包含 DDL）  3-无
 	Op        string    `orm:"op,string" json:"op"`                                     // 支持的操作
 	Status    int8      `orm:"status,int8" json:"status"`                               // 状态：1-正常 2-下线 3-审核中 4-审核撤回 5-拒绝
+	StartAt   time.Time `orm:"start_at,datetime" json:"start_at"`                       // 授权生效时间，为空则立即生效
+	ExpireAt  time.Time `orm:"expire_at,datetime" json:"expire_at"`                     // 授权过期时间，为空则永久有效
 	ApplyUser uint64    `orm:"apply_user,uint64,omitempty" json:"apply_user,omitempty"` // 申请者
 	Reason    string    `orm:"reason,string" json:"reason"`                             // 接入原因
 	CreatedAt time.Time `orm:"created_at,datetime,omitempty" json:"created_at"`         // 记录创建时间
@@ -61,16 +91,34 @@ type TblAccessDB struct {
 }
 
 type TblAccessTable struct {
+	Id           int       `orm:"id,int,omitempty" json:"id"`
+	Appid        uint64    `orm:"appid,uint64" json:"appid"`                               // 应用appid
+	TableId      int       `orm:"table_id,int" json:"table_id"`                            // 表id
+	QueryAll     int8      `orm:"query_all,int8" json:"query_all"`                         // 是否支持所有的 query 语句，1-true 2-false
+	Op           string    `orm:"op,string" json:"op"`                                     // 支持的表操作
+	ReadColumn   string    `orm:"read_column,string" json:"read_column"`                   // 允许查询、作为条件的列，逗号分隔，空串为不限制
+	WriteColumn  string    `orm:"write_column,string" json:"write_column"`                 // 允许写入的列，逗号分隔，空串为不限制
+	ColumnPolicy int8      `orm:"column_policy,int8" json:"column_policy"`                 // 越权列处理策略 1-拒绝请求 2-剔除越权的查询列、写入列
+	RowFilter    string    `orm:"row_filter,string" json:"row_filter"`                     // 行级过滤条件，json 格式的 where 条件，比如 {"tenant_id":42}
+	AllowIP      string    `orm:"allow_ip,string" json:"allow_ip"`                         // 允许访问该表的 ip 或 CIDR，逗号分隔，空串为不限制
+	Status       int8      `orm:"status,int8" json:"status"`                               // 状态：1-正常 2-下线 3-审核中 4-审核撤回 5-拒绝
+	StartAt      time.Time `orm:"start_at,datetime" json:"start_at"`                       // 授权生效时间，为空则立即生效
+	ExpireAt     time.Time `orm:"expire_at,datetime" json:"expire_at"`                     // 授权过期时间，为空则永久有效
+	ApplyUser    uint64    `orm:"apply_user,uint64,omitempty" json:"apply_user,omitempty"` // 申请者
+	Reason       string    `orm:"reason,string" json:"reason"`                             // 接入原因
+	CreatedAt    time.Time `orm:"created_at,datetime,omitempty" json:"created_at"`         // 记录创建时间
+	UpdatedAt    time.Time `orm:"updated_at,datetime,omitempty" json:"updated_at"`         // 记录最后修改时间
+}
+
+type TblTableAlias struct {
 	Id        int       `orm:"id,int,omitempty" json:"id"`
-	Appid     uint64    `orm:"appid,uint64" json:"appid"`                               // 应用appid
-	TableId   int       `orm:"table_id,int" json:"table_id"`                            // 表id
-	QueryAll  int8      `orm:"query_all,int8" json:"query_all"`                         // 是否支持所有的 query 语句，1-true 2-false
-	Op        string    `orm:"op,string" json:"op"`                                     // 支持的表操作
-	Status    int8      `orm:"status,int8" json:"status"`                               // 状态：1-正常 2-下线 3-审核中 4-审核撤回 5-拒绝
-	ApplyUser uint64    `orm:"apply_user,uint64,omitempty" json:"apply_user,omitempty"` // 申请者
-	Reason    string    `orm:"reason,string" json:"reason"`                             // 接入原因
-	CreatedAt time.Time `orm:"created_at,datetime,omitempty" json:"created_at"`         // 记录创建时间
-	UpdatedAt time.Time `orm:"updated_at,datetime,omitempty" json:"updated_at"`         // 记录最后修改时间
+	Alias     string    `orm:"alias,string" json:"alias"`                       // 逻辑表名（执行单元名），可带库名 db::name
+	Appid     uint64    `orm:"appid,uint64" json:"appid"`                       // 应用appid，0 为 workspace 下所有应用
+	TableId   int       `orm:"table_id,int" json:"table_id"`                    // 映射的物理表id
+	Intro     string    `orm:"intro,string" json:"intro"`                       // 简介
+	Status    int8      `orm:"status,int8" json:"status"`                       // 状态：1-正常 2-下线
+	CreatedAt time.Time `orm:"created_at,datetime,omitempty" json:"created_at"` // 记录创建时间
+	UpdatedAt time.Time `orm:"updated_at,datetime,omitempty" json:"updated_at"` // 记录最后修改时间
 }
 
 type TblPlugin struct {
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"fmt"
+
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/json"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/plugin/conf"
+	sc "github.com/horm-database/server/srv/codec"
+)
+
+// Plugins 插件及表插件链，随配置快照整体替换，执行中的请求继续使用旧插件链，新请求使用新插件链。生成后不再修改
+type Plugins struct {
+	plugin       map[int]*TblPlugin        // 插件
+	tablePlugins map[int][]*TblTablePlugin // 表插件链，已排序并剔除停用的插件
+	rows         map[int]*TblTablePlugin   // tbl_table_plugin 全部记录（包含停用的），用于对比变更
+}
+
+// Plugins 获取插件及表插件链
+func (s *Snapshot) Plugins() *Plugins {
+	return s.plugins
+}
+
+// TablePlugins 表插件链
+func (p *Plugins) TablePlugins(tableID int) []*TblTablePlugin {
+	return p.tablePlugins[tableID]
+}
+
+// Plugin 插件
+func (p *Plugins) Plugin(id int) *TblPlugin {
+	return p.plugin[id]
+}
+
+// LoadPlugins 全量加载插件及表插件，通过 SortTablePlugins 重建表插件链后发布新快照，返回当前快照版本及变更说明，
+// 无变更时不发布。先校验所有表的插件链，任意表插件链排序失败时不发布，插件及所有表插件链保持不变，返回第一个失败原因
+func LoadPlugins(pluginRows []*TblPlugin, tablePluginRows []*TblTablePlugin) (version uint64, changes []string, err error) {
+	buildLock.Lock()
+	defer buildLock.Unlock()
+
+	cur := Current()
+	old := cur.plugins
+
+	changes = pluginChanges(old, pluginRows, tablePluginRows)
+	if len(changes) == 0 {
+		return cur.Version, nil, nil
+	}
+
+	p := &Plugins{
+		plugin:       make(map[int]*TblPlugin, len(pluginRows)),
+		tablePlugins: map[int][]*TblTablePlugin{},
+		rows:         make(map[int]*TblTablePlugin, len(tablePluginRows)),
+	}
+
+	for _, f := range pluginRows {
+		p.plugin[f.Id] = f
+	}
+
+	tableRows := map[int][]*TblTablePlugin{}
+	for _, tf := range tablePluginRows {
+		parseTablePlugin(tf)
+		p.rows[tf.Id] = tf
+		tableRows[tf.TableId] = append(tableRows[tf.TableId], tf)
+	}
+
+	sortedRows := make(map[int][]*TblTablePlugin, len(tableRows))
+	for tableID, rows := range tableRows {
+		sorted, e := SortTablePlugins(rows)
+		if e != nil {
+			return cur.Version, nil, fmt.Errorf("table %d plugin chain is invalid, keep all old plugins: %v", tableID, e)
+		}
+
+		sortedRows[tableID] = sorted
+	}
+
+	for tableID, sorted := range sortedRows {
+		chain := make([]*TblTablePlugin, 0, len(sorted))
+		for _, tf := range sorted {
+			if tf.Status != consts.TablePluginStatusDisable {
+				chain = append(chain, tf)
+			}
+		}
+
+		p.tablePlugins[tableID] = chain
+	}
+
+	b := newBuilder()
+	b.plugins = p
+
+	return b.publish(), changes, nil
+}
+
+// parseTablePlugin 解析表插件配置及调度配置
+func parseTablePlugin(tf *TblTablePlugin) {
+	tf.Conf = getPluginConfig(tf.PluginID, tf.PluginVersion, tf.Config)
+	tf.ScheduleConf = &conf.ScheduleConfig{}
+	if tf.ScheduleConfig != "" {
+		err := json.Api.Unmarshal([]byte(tf.ScheduleConfig), &tf.ScheduleConf)
+		if err != nil {
+			log.Errorf(sc.GCtx, errs.ErrPluginConfigDecode,
+				"unmarshal plugin schedule config error=[%v], plugin_id=[%d], plugin_version=[%d], schedule_config=[%s]",
+				err, tf.PluginID, tf.PluginVersion, tf.ScheduleConfig)
+		}
+	}
+}
+
+// pluginChanges 对比快照与配置库中的插件、表插件记录，返回变更说明
+func pluginChanges(old *Plugins, pluginRows []*TblPlugin, tablePluginRows []*TblTablePlugin) (changes []string) {
+	exists := make(map[int]bool, len(pluginRows))
+	for _, f := range pluginRows {
+		exists[f.Id] = true
+
+		o := old.plugin[f.Id]
+		if o == nil {
+			changes = append(changes, fmt.Sprintf("tbl_plugin %d [%s] added", f.Id, f.Name))
+		} else if o.Name != f.Name || o.Version != f.Version || o.SupportTypes != f.SupportTypes || o.Online != f.Online {
+			changes = append(changes, fmt.Sprintf("tbl_plugin %d [%s] updated", f.Id, f.Name))
+		}
+	}
+
+	for id, f := range old.plugin {
+		if !exists[id] {
+			changes = append(changes, fmt.Sprintf("tbl_plugin %d [%s] deleted", id, f.Name))
+		}
+	}
+
+	exists = make(map[int]bool, len(tablePluginRows))
+	for _, tf := range tablePluginRows {
+		exists[tf.Id] = true
+
+		o := old.rows[tf.Id]
+		if o == nil {
+			changes = append(changes, fmt.Sprintf("tbl_table_plugin %d (table %d, plugin %d) added",
+				tf.Id, tf.TableId, tf.PluginID))
+		} else if o.TableId != tf.TableId || o.PluginID != tf.PluginID || o.PluginVersion != tf.PluginVersion ||
+			o.Front != tf.Front || o.ScheduleConfig != tf.ScheduleConfig || o.Config != tf.Config || o.Status != tf.Status {
+			changes = append(changes, fmt.Sprintf("tbl_table_plugin %d (table %d, plugin %d) updated, status %d",
+				tf.Id, tf.TableId, tf.PluginID, tf.Status))
+		}
+	}
+
+	for id, tf := range old.rows {
+		if !exists[id] {
+			changes = append(changes, fmt.Sprintf("tbl_table_plugin %d (table %d, plugin %d) deleted",
+				id, tf.TableId, tf.PluginID))
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/horm-database/orm/obj"
+)
+
+var (
+	snapshot     atomic.Value      // *Snapshot 当前快照
+	buildLock    = new(sync.Mutex) // 串行生成快照
+	publishHooks []func(*Snapshot) // 快照发布回调
+)
+
+func init() {
+	snapshot.Store(&Snapshot{
+		dbMap:      map[int]*obj.TblDB{},
+		dbNameMap:  map[string]*obj.TblDB{},
+		tableMap:   map[string]map[int]*obj.TblTable{},
+		tableIDMap: map[int]*obj.TblTable{},
+		appInfoMap: map[uint64]*AppInfo{},
+		plugins:    &Plugins{},
+
+		aliasMap:     map[int]*TblTableAlias{},
+		aliasNameMap: map[string]map[int]*TblTableAlias{},
+	})
+}
+
+// Snapshot 库、表、应用权限及插件配置的不可变快照，带版本号。配置变更时复制当前快照修改后整体原子替换，
+// 已发布的快照及其中的配置不再修改，请求通过 WithSnapshot 固定一个快照，整个执行树使用同一份配置
+type Snapshot struct {
+	Version uint64 // 快照版本号，每次发布加 1
+
+	workspace  TblWorkspace
+	dbMap      map[int]*obj.TblDB
+	dbNameMap  map[string]*obj.TblDB
+	tableMap   map[string]map[int]*obj.TblTable
+	tableIDMap map[int]*obj.TblTable
+	appInfoMap map[uint64]*AppInfo
+	plugins    *Plugins
+
+	aliasMap     map[int]*TblTableAlias            // 表别名
+	aliasNameMap map[string]map[int]*TblTableAlias // 别名中的表名 -> 表别名
+}
+
+type snapshotKey struct{}
+
+// Current 获取当前快照
+func Current() *Snapshot {
+	return snapshot.Load().(*Snapshot)
+}
+
+// WithSnapshot 请求固定使用当前快照，已固定时不替换
+func WithSnapshot(ctx context.Context) context.Context {
+	return PinSnapshot(ctx, Current())
+}
+
+// PinSnapshot 请求固定使用指定快照，已固定时不替换。传输层解帧时使用的快照需要固定到请求，保证帧秘钥与请求配置一致
+func PinSnapshot(ctx context.Context, s *Snapshot) context.Context {
+	if _, ok := ctx.Value(snapshotKey{}).(*Snapshot); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, snapshotKey{}, s)
+}
+
+// Snap 获取请求固定的快照，未固定时返回当前快照
+func Snap(ctx context.Context) *Snapshot {
+	if s, ok := ctx.Value(snapshotKey{}).(*Snapshot); ok {
+		return s
+	}
+
+	return Current()
+}
+
+// GetTables 获取当前快照的所有表
+func GetTables() map[string]map[int]*obj.TblTable {
+	return Current().GetTables()
+}
+
+// GetTablesDB 从当前快照获取表所在库
+func GetTablesDB(t *obj.TblTable) *obj.TblDB {
+	return Current().GetTablesDB(t)
+}
+
+// GetTableAndDB 根据数据名称从当前快照返回表名/索引名/redis、及其数据库信息
+func GetTableAndDB(appid uint64, name string, shard []string) (tables []string,
+	tblTable *obj.TblTable, db *obj.TblDB, ambiguous bool) {
+	return Current().GetTableAndDB(appid, name, shard)
+}
+
+// builder 基于当前快照生成新快照，应用信息在首次修改时复制
+type builder struct {
+	*Snapshot
+	copied map[uint64]bool // 已复制的应用
+}
+
+// newBuilder 复制当前快照，调用方需持有 buildLock
+func newBuilder() *builder {
+	cur := Current()
+
+	s := &Snapshot{
+		Version:    cur.Version,
+		workspace:  cur.workspace,
+		dbMap:      copyMap(cur.dbMap),
+		dbNameMap:  copyMap(cur.dbNameMap),
+		tableMap:   make(map[string]map[int]*obj.TblTable, len(cur.tableMap)),
+		tableIDMap: copyMap(cur.tableIDMap),
+		appInfoMap: copyMap(cur.appInfoMap),
+		plugins:    cur.plugins,
+
+		aliasMap:     copyMap(cur.aliasMap),
+		aliasNameMap: make(map[string]map[int]*TblTableAlias, len(cur.aliasNameMap)),
+	}
+
+	for name, tables := range cur.tableMap {
+		s.tableMap[name] = copyMap(tables)
+	}
+
+	for name, aliases := range cur.aliasNameMap {
+		s.aliasNameMap[name] = copyMap(aliases)
+	}
+
+	return &builder{Snapshot: s, copied: map[uint64]bool{}}
+}
+
+// app 获取可修改的应用信息，应用不存在时返回 nil
+func (b *builder) app(appid uint64) *AppInfo {
+	appInfo := b.appInfoMap[appid]
+	if appInfo == nil || b.copied[appid] {
+		return appInfo
+	}
+
+	appInfo = appInfo.clone()
+	b.appInfoMap[appid] = appInfo
+	b.copied[appid] = true
+
+	return appInfo
+}
+
+// OnPublish 注册快照发布回调，每次发布新快照之后按注册顺序调用。回调在持有 buildLock 时执行，不能阻塞，
+// 需要在启动时（发布第一个快照之前）注册
+func OnPublish(f func(s *Snapshot)) {
+	publishHooks = append(publishHooks, f)
+}
+
+// publish 发布新快照，版本号加 1
+func (b *builder) publish() uint64 {
+	b.Version++
+	snapshot.Store(b.Snapshot)
+
+	for _, f := range publishHooks {
+		f(b.Snapshot)
+	}
+
+	return b.Version
+}
+
+func (a *AppInfo) clone() *AppInfo {
+	c := *a
+	c.AccessDB = copyMap(a.AccessDB)
+	c.AccessTable = copyMap(a.AccessTable)
+	c.DBOps = copyMap(a.DBOps)
+	c.TableOPs = copyMap(a.TableOPs)
+	c.Secrets = copyMap(a.Secrets)
+	c.Columns = copyMap(a.Columns)
+	c.RowFilters = copyMap(a.RowFilters)
+	c.RateLimits = copyMap(a.RateLimits)
+	c.TableIP = copyMap(a.TableIP)
+	return &c
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	ret := make(map[K]V, len(m))
+	for k, v := range m {
+		ret[k] = v
+	}
+	return ret
+}
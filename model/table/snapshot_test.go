@@ -0,0 +1,93 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"context"
+	"testing"
+
+	"github.com/horm-database/server/consts"
+)
+
+// 发布新快照时复制修改，已发布、被请求固定的快照不受影响
+func TestSnapshotCopyOnWrite(t *testing.T) {
+	const appid = 700001
+
+	UpdateDBInfo(&ConfigRows{
+		AppInfos:     []*TblAppInfo{{Appid: appid, Name: "copy_on_write", Status: consts.AppStatusNormal}},
+		AccessTables: []*TblAccessTable{{Id: 700001, Appid: appid, TableId: 1, Op: "find"}},
+	}, nil)
+
+	old := Current()
+	ctx := PinSnapshot(context.Background(), old)
+
+	version, changes := UpdateDBInfo(&ConfigRows{
+		AccessTables: []*TblAccessTable{{Id: 700001, Appid: appid, TableId: 1, Op: "find,insert"}},
+	}, nil)
+
+	cur := Current()
+	if version != old.Version+1 || cur.Version != version || len(changes) != 1 {
+		t.Fatalf("version=%d, current version=%d, changes=%v, want version %d", version, cur.Version, changes, old.Version+1)
+	}
+
+	if !cur.GetAppInfo(appid).TableOPs[1]["insert"] {
+		t.Error("new snapshot is not updated")
+	}
+
+	if old.GetAppInfo(appid).TableOPs[1]["insert"] || old.GetAppInfo(appid) == cur.GetAppInfo(appid) {
+		t.Error("published snapshot is modified")
+	}
+
+	if Snap(ctx) != old || Snap(WithSnapshot(ctx)) != old {
+		t.Error("pinned snapshot is replaced")
+	}
+
+	if Snap(context.Background()) != cur {
+		t.Error("unpinned request should use current snapshot")
+	}
+
+	// 对账删除授权
+	version, changes = UpdateDBInfo(&ConfigRows{}, &SyncKeys{Apps: map[uint64]bool{appid: true}})
+	if version != cur.Version+1 || len(changes) == 0 {
+		t.Fatalf("version=%d, changes=%v, want version %d", version, changes, cur.Version+1)
+	}
+
+	if Current().GetAppInfo(appid).AccessTable[1] != nil || cur.GetAppInfo(appid).AccessTable[1] == nil {
+		t.Error("deleted access table should only be removed from new snapshot")
+	}
+}
+
+// 配置无变化时不发布新快照
+func TestSnapshotUnchanged(t *testing.T) {
+	cur := Current()
+
+	version, changes := UpdateDBInfo(&ConfigRows{}, nil)
+	if version != cur.Version || changes != nil || Current() != cur {
+		t.Errorf("empty rows published a new snapshot, version=%d, changes=%v", version, changes)
+	}
+
+	ws := &TblWorkspace{Id: 1, Name: "snapshot_test", Token: "token"}
+	SetWorkspace(ws)
+	published := Current()
+
+	SetWorkspace(&TblWorkspace{Id: 1, Name: "snapshot_test", Token: "token"})
+	if Current() != published {
+		t.Error("unchanged workspace published a new snapshot")
+	}
+
+	if published.Workspace().Token != ws.Token {
+		t.Errorf("workspace token=%s, want %s", published.Workspace().Token, ws.Token)
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package table
+
+import (
+	"fmt"
+
+	"github.com/horm-database/orm/obj"
+)
+
+// ConfigRows 配置库中新增、修改的库、表、应用及其秘钥、限流规则、授权记录
+type ConfigRows struct {
+	DBs          []*obj.TblDB
+	Tables       []*obj.TblTable
+	AppInfos     []*TblAppInfo
+	AppSecrets   []*TblAppSecret
+	RateLimits   []*TblRateLimit
+	AccessDBs    []*TblAccessDB
+	AccessTables []*TblAccessTable
+	TableAliases []*TblTableAlias
+}
+
+// SyncKeys 配置库中当前存在的所有记录主键，用于全量对账，找出已被物理删除的配置
+type SyncKeys struct {
+	DBs          map[int]bool    // tbl_db.id
+	Tables       map[int]bool    // tbl_table.id
+	Apps         map[uint64]bool // tbl_app_info.appid
+	AppSecrets   map[int]bool    // tbl_app_secret.id
+	RateLimits   map[int]bool    // tbl_rate_limit.id
+	AccessDBs    map[int]bool    // tbl_access_db.id
+	AccessTables map[int]bool    // tbl_access_table.id
+	TableAliases map[int]bool    // tbl_table_alias.id
+}
+
+// removeDeleted 删除快照中存在、但配置库中已不存在的库、表、应用、秘钥、限流规则及授权，返回变更说明
+func (b *builder) removeDeleted(keys *SyncKeys) (changes []string) {
+	for id, db := range b.dbMap {
+		if !keys.DBs[id] {
+			delete(b.dbMap, id)
+			if b.dbNameMap[db.Name] == db {
+				delete(b.dbNameMap, db.Name)
+			}
+			changes = append(changes, fmt.Sprintf("tbl_db %d [%s] deleted", id, db.Name))
+		}
+	}
+
+	for id, tbl := range b.tableIDMap {
+		if !keys.Tables[id] {
+			b.deleteTable(tbl)
+			changes = append(changes, fmt.Sprintf("tbl_table %d [%s] deleted", id, tbl.Name))
+		}
+	}
+
+	for id, alias := range b.aliasMap {
+		if !keys.TableAliases[id] {
+			b.deleteAlias(alias)
+			changes = append(changes, fmt.Sprintf("tbl_table_alias %d [%s] (appid %d) deleted", id, alias.Alias, alias.Appid))
+		}
+	}
+
+	for appid, appInfo := range b.appInfoMap {
+		if !keys.Apps[appid] {
+			delete(b.appInfoMap, appid)
+			changes = append(changes, fmt.Sprintf("tbl_app_info %d [%s] deleted", appid, appInfo.Info.Name))
+			continue
+		}
+
+		for id := range appInfo.Secrets {
+			if !keys.AppSecrets[id] {
+				delete(b.app(appid).Secrets, id)
+				changes = append(changes, fmt.Sprintf("tbl_app_secret %d of appid %d deleted", id, appid))
+			}
+		}
+
+		for id := range appInfo.RateLimits {
+			if !keys.RateLimits[id] {
+				delete(b.app(appid).RateLimits, id)
+				changes = append(changes, fmt.Sprintf("tbl_rate_limit %d of appid %d deleted", id, appid))
+			}
+		}
+
+		for dbID, accessDB := range appInfo.AccessDB {
+			if !keys.AccessDBs[accessDB.Id] {
+				deleteAccessDB(b.app(appid), dbID)
+				changes = append(changes, fmt.Sprintf("tbl_access_db %d (appid %d, db %d) deleted",
+					accessDB.Id, appid, dbID))
+			}
+		}
+
+		for tableID, accessTable := range appInfo.AccessTable {
+			if !keys.AccessTables[accessTable.Id] {
+				deleteAccessTable(b.app(appid), tableID)
+				changes = append(changes, fmt.Sprintf("tbl_access_table %d (appid %d, table %d) deleted",
+					accessTable.Id, appid, tableID))
+			}
+		}
+	}
+
+	return changes
+}
+
+// empty 是否没有新增、修改的记录
+func (r *ConfigRows) empty() bool {
+	return len(r.DBs) == 0 && len(r.Tables) == 0 && len(r.AppInfos) == 0 && len(r.AppSecrets) == 0 &&
+		len(r.RateLimits) == 0 && len(r.AccessDBs) == 0 && len(r.AccessTables) == 0 && len(r.TableAliases) == 0
+}
+
+// hasDeleted 快照中是否存在配置库中已删除的配置
+func (s *Snapshot) hasDeleted(keys *SyncKeys) bool {
+	for id := range s.dbMap {
+		if !keys.DBs[id] {
+			return true
+		}
+	}
+
+	for id := range s.tableIDMap {
+		if !keys.Tables[id] {
+			return true
+		}
+	}
+
+	for id := range s.aliasMap {
+		if !keys.TableAliases[id] {
+			return true
+		}
+	}
+
+	for appid, appInfo := range s.appInfoMap {
+		if !keys.Apps[appid] {
+			return true
+		}
+
+		for id := range appInfo.Secrets {
+			if !keys.AppSecrets[id] {
+				return true
+			}
+		}
+
+		for id := range appInfo.RateLimits {
+			if !keys.RateLimits[id] {
+				return true
+			}
+		}
+
+		for _, accessDB := range appInfo.AccessDB {
+			if !keys.AccessDBs[accessDB.Id] {
+				return true
+			}
+		}
+
+		for _, accessTable := range appInfo.AccessTable {
+			if !keys.AccessTables[accessTable.Id] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Keys 快照中所有记录主键
+func (s *Snapshot) Keys() *SyncKeys {
+	keys := &SyncKeys{
+		DBs:          make(map[int]bool, len(s.dbMap)),
+		Tables:       make(map[int]bool, len(s.tableIDMap)),
+		Apps:         make(map[uint64]bool, len(s.appInfoMap)),
+		AppSecrets:   map[int]bool{},
+		RateLimits:   map[int]bool{},
+		AccessDBs:    map[int]bool{},
+		AccessTables: map[int]bool{},
+		TableAliases: make(map[int]bool, len(s.aliasMap)),
+	}
+
+	for id := range s.dbMap {
+		keys.DBs[id] = true
+	}
+
+	for id := range s.tableIDMap {
+		keys.Tables[id] = true
+	}
+
+	for id := range s.aliasMap {
+		keys.TableAliases[id] = true
+	}
+
+	for appid, appInfo := range s.appInfoMap {
+		keys.Apps[appid] = true
+
+		for id := range appInfo.Secrets {
+			keys.AppSecrets[id] = true
+		}
+
+		for id := range appInfo.RateLimits {
+			keys.RateLimits[id] = true
+		}
+
+		for _, accessDB := range appInfo.AccessDB {
+			keys.AccessDBs[accessDB.Id] = true
+		}
+
+		for _, accessTable := range appInfo.AccessTable {
+			keys.AccessTables[accessTable.Id] = true
+		}
+	}
+
+	return keys
+}
+
+// Remove 删除表 name 中主键为 id 的记录，tbl_app_info 的主键为 appid，返回是否支持该表
+func (k *SyncKeys) Remove(name string, id uint64) bool {
+	switch name {
+	case "tbl_db":
+		delete(k.DBs, int(id))
+	case "tbl_table":
+		delete(k.Tables, int(id))
+	case "tbl_app_info":
+		delete(k.Apps, id)
+	case "tbl_app_secret":
+		delete(k.AppSecrets, int(id))
+	case "tbl_rate_limit":
+		delete(k.RateLimits, int(id))
+	case "tbl_access_db":
+		delete(k.AccessDBs, int(id))
+	case "tbl_access_table":
+		delete(k.AccessTables, int(id))
+	case "tbl_table_alias":
+		delete(k.TableAliases, int(id))
+	default:
+		return false
+	}
+
+	return true
+}
+
+// AddRows 添加记录的主键
+func (k *SyncKeys) AddRows(r *ConfigRows) {
+	for _, v := range r.DBs {
+		k.DBs[v.Id] = true
+	}
+
+	for _, v := range r.Tables {
+		k.Tables[v.Id] = true
+	}
+
+	for _, v := range r.AppInfos {
+		k.Apps[v.Appid] = true
+	}
+
+	for _, v := range r.AppSecrets {
+		k.AppSecrets[v.Id] = true
+	}
+
+	for _, v := range r.RateLimits {
+		k.RateLimits[v.Id] = true
+	}
+
+	for _, v := range r.AccessDBs {
+		k.AccessDBs[v.Id] = true
+	}
+
+	for _, v := range r.AccessTables {
+		k.AccessTables[v.Id] = true
+	}
+
+	for _, v := range r.TableAliases {
+		k.TableAliases[v.Id] = true
+	}
+}
+
+// Keys 记录中表 name 的主键，tbl_app_info 的主键为 appid
+func (r *ConfigRows) Keys(name string) map[uint64]bool {
+	keys := map[uint64]bool{}
+
+	switch name {
+	case "tbl_db":
+		for _, v := range r.DBs {
+			keys[uint64(v.Id)] = true
+		}
+	case "tbl_table":
+		for _, v := range r.Tables {
+			keys[uint64(v.Id)] = true
+		}
+	case "tbl_app_info":
+		for _, v := range r.AppInfos {
+			keys[v.Appid] = true
+		}
+	case "tbl_app_secret":
+		for _, v := range r.AppSecrets {
+			keys[uint64(v.Id)] = true
+		}
+	case "tbl_rate_limit":
+		for _, v := range r.RateLimits {
+			keys[uint64(v.Id)] = true
+		}
+	case "tbl_access_db":
+		for _, v := range r.AccessDBs {
+			keys[uint64(v.Id)] = true
+		}
+	case "tbl_access_table":
+		for _, v := range r.AccessTables {
+			keys[uint64(v.Id)] = true
+		}
+	case "tbl_table_alias":
+		for _, v := range r.TableAliases {
+			keys[uint64(v.Id)] = true
+		}
+	}
+
+	return keys
+}
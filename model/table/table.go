@@ -15,68 +15,102 @@
 package table
 
 import (
+	"fmt"
+	"net"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/horm-database/common/errs"
 	"github.com/horm-database/common/json"
 	"github.com/horm-database/common/log"
 	"github.com/horm-database/common/util"
 	"github.com/horm-database/orm/obj"
-	"github.com/horm-database/server/plugin/conf"
+	"github.com/horm-database/server/consts"
 	sc "github.com/horm-database/server/srv/codec"
 )
 
-var (
-	pluginLock   = new(sync.RWMutex)
-	plugin       = map[int]*TblPlugin{}
-	tablePlugins = map[int][]*TblTablePlugin{}
-
-	dbLock     = new(sync.RWMutex)
-	dbMap      = map[int]*obj.TblDB{}
-	dbNameMap  = map[string]*obj.TblDB{}
-	tableMap   = map[string]map[int]*obj.TblTable{}
-	appInfoMap = map[uint64]*AppInfo{}
-
-	wsLock    = new(sync.RWMutex)
-	workspace = TblWorkspace{}
-)
+// RowFilterInvalid 行级过滤条件解析失败时的标记，拒绝所有访问
+const RowFilterInvalid = "__invalid_row_filter__"
 
 // AppInfo 数据访问者信息
 type AppInfo struct {
-	Info        *TblAppInfo             // 应用信息
-	AccessDB    map[int]*TblAccessDB    // 可以访问的仓库
-	AccessTable map[int]*TblAccessTable // 可以访问的表
-	DBOps       map[int]map[string]bool // 支持的库操作
-	TableOPs    map[int]map[string]bool // 支持的表操作
+	Info        *TblAppInfo                    // 应用信息
+	AccessDB    map[int]*TblAccessDB           // 可以访问的仓库
+	AccessTable map[int]*TblAccessTable        // 可以访问的表
+	DBOps       map[int]map[string]bool        // 支持的库操作
+	TableOPs    map[int]map[string]bool        // 支持的表操作
+	Secrets     map[int]*TblAppSecret          // 应用秘钥（支持多个秘钥同时有效，用于秘钥轮换）
+	Columns     map[int]*ColumnPolicy          // 表列权限，未限制列的表不存在
+	RowFilters  map[int]map[string]interface{} // 表行级过滤条件，未限制行的表不存在
+	RateLimits  map[int]*TblRateLimit          // 限流规则
+	AllowIP     IPAllowlist                    // 应用 ip 白名单，为 nil 不限制
+	TableIP     map[int]IPAllowlist            // 表 ip 白名单，未限制 ip 的表不存在
 }
 
-// GetTables 获取所有表
-func GetTables() map[string]map[int]*obj.TblTable {
-	dbLock.RLock()
-	defer dbLock.RUnlock()
-	return tableMap
+// IPAllowlist ip 白名单，元素为 ip 或 CIDR，非 nil 的空白名单拒绝所有 ip
+type IPAllowlist []*net.IPNet
+
+// Contains ip 是否在白名单中
+func (l IPAllowlist) Contains(ip net.IP) bool {
+	for _, n := range l {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
 }
 
-func GetTablesDB(t *obj.TblTable) *obj.TblDB {
-	dbLock.RLock()
-	ret := dbMap[t.DB]
-	dbLock.RUnlock()
-	return ret
+// ColumnPolicy 列权限
+type ColumnPolicy struct {
+	Read  map[string]bool // 允许查询、作为条件的列，为空不限制
+	Write map[string]bool // 允许写入的列，为空不限制
+	Strip bool            // 是否剔除越权的查询列、写入列，否则拒绝请求
 }
 
-// GetTableAndDB 根据数据名称（执行单元名）返回表名/索引名/redis、及其数据库信息
-func GetTableAndDB(name string, shard []string) (tables []string,
-	tblTable *obj.TblTable, db *obj.TblDB, ambiguous bool) {
-	dbLock.RLock()
-	defer dbLock.RUnlock()
+// GetTables 获取所有表，返回值只读
+func (s *Snapshot) GetTables() map[string]map[int]*obj.TblTable {
+	return s.tableMap
+}
+
+// GetDBByName 根据库名获取数据库信息
+func (s *Snapshot) GetDBByName(name string) *obj.TblDB {
+	return s.dbNameMap[name]
+}
+
+// GetDBTables 获取库下所有表
+func (s *Snapshot) GetDBTables(dbID int) []*obj.TblTable {
+	var tables []*obj.TblTable
+	for _, dbTables := range s.tableMap {
+		if tbl := dbTables[dbID]; tbl != nil {
+			tables = append(tables, tbl)
+		}
+	}
+
+	return tables
+}
 
+func (s *Snapshot) GetTablesDB(t *obj.TblTable) *obj.TblDB {
+	return s.dbMap[t.DB]
+}
+
+// GetTableAndDB 根据数据名称（执行单元名）返回表名/索引名/redis、及其数据库信息。执行单元名优先按应用、workspace 的表别名解析，
+// 别名映射的物理表名与别名不同时，分表名中的别名前缀替换为物理表名
+func (s *Snapshot) GetTableAndDB(appid uint64, name string, shard []string) (tables []string,
+	tblTable *obj.TblTable, db *obj.TblDB, ambiguous bool) {
 	dbname, tableName := util.Namespace(name)
 
-	tblTables, _ := tableMap[tableName]
+	alias, ambiguous := s.getAlias(appid, dbname, tableName)
+	if ambiguous {
+		return nil, nil, nil, true
+	}
+
+	tblTables, _ := s.tableMap[tableName]
 
-	if dbname == "" {
-		if len(tables) > 1 { //有多个同名表
+	if alias != nil {
+		tblTable = s.tableIDMap[alias.TableId]
+	} else if dbname == "" {
+		if len(tblTables) > 1 { //有多个同名表
 			return nil, nil, nil, true
 		}
 
@@ -84,7 +118,7 @@ func GetTableAndDB(name string, shard []string) (tables []string,
 			tblTable = tmp
 		}
 	} else {
-		db, _ := dbNameMap[dbname]
+		db, _ := s.dbNameMap[dbname]
 		if db != nil {
 			tblTable = tblTables[db.Id]
 		}
@@ -94,51 +128,47 @@ func GetTableAndDB(name string, shard []string) (tables []string,
 		return
 	}
 
-	db = dbMap[tblTable.DB]
+	db = s.dbMap[tblTable.DB]
 
 	if len(shard) > 0 {
-		tables = shard
+		tables = aliasShard(tableName, tblTable.Name, shard)
 	} else {
-		tables = []string{tableName}
+		tables = []string{tblTable.Name}
 	}
 
 	return
 }
 
+// SetWorkspace 更新 workspace，有变化时发布新快照
 func SetWorkspace(ws *TblWorkspace) {
-	wsLock.Lock()
-	defer wsLock.Unlock()
-	workspace = *ws
-}
+	buildLock.Lock()
+	defer buildLock.Unlock()
 
-func GetWorkspace() TblWorkspace {
-	wsLock.RLock()
-	defer wsLock.RUnlock()
-	return workspace
-}
+	if Current().workspace == *ws {
+		return
+	}
 
-func GetAppInfo(appid uint64) *AppInfo {
-	dbLock.RLock()
-	defer dbLock.RUnlock()
-	return appInfoMap[appid]
+	b := newBuilder()
+	b.workspace = *ws
+	b.publish()
 }
 
-func GetTablePlugins(tableID int) []*TblTablePlugin {
-	pluginLock.RLock()
-	defer pluginLock.RUnlock()
-	return tablePlugins[tableID]
+// Workspace 获取快照中的 workspace
+func (s *Snapshot) Workspace() TblWorkspace {
+	return s.workspace
 }
 
-func GetPlugin(id int) *TblPlugin {
-	pluginLock.RLock()
-	defer pluginLock.RUnlock()
-	return plugin[id]
-}
+// GetAppInfo 获取应用信息，应用已下线时返回 nil
+func (s *Snapshot) GetAppInfo(appid uint64) *AppInfo {
+	appInfo := s.appInfoMap[appid]
+	if appInfo == nil || appInfo.Info.Status == consts.AppStatusOffline {
+		return nil
+	}
 
-func SetDB(db *obj.TblDB) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+	return appInfo
+}
 
+func (b *builder) setDB(db *obj.TblDB) {
 	var err error
 
 	db.Addr = &util.DBAddress{
@@ -159,161 +189,453 @@ func SetDB(db *obj.TblDB) {
 		log.Errorf(sc.GCtx, errs.ErrDBAddressParse, "parse db %s address error: %v", db.Name, err)
 	}
 
-	dbMap[db.Id] = db
-	dbNameMap[db.Name] = db
+	if old := b.dbMap[db.Id]; old != nil && old.Name != db.Name { // 库改名
+		delete(b.dbNameMap, old.Name)
+	}
+
+	b.dbMap[db.Id] = db
+	b.dbNameMap[db.Name] = db
 }
 
-func SetTable(table *obj.TblTable) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+func (b *builder) setTable(table *obj.TblTable) {
+	if old := b.tableIDMap[table.Id]; old != nil && (old.Name != table.Name || old.DB != table.DB) { // 表改名或迁移库
+		b.deleteTable(old)
+	}
 
-	_, exists := tableMap[table.Name]
+	_, exists := b.tableMap[table.Name]
 	if !exists {
-		tableMap[table.Name] = map[int]*obj.TblTable{}
+		b.tableMap[table.Name] = map[int]*obj.TblTable{}
 	}
 
-	tableMap[table.Name][table.DB] = table
+	b.tableMap[table.Name][table.DB] = table
+	b.tableIDMap[table.Id] = table
 }
 
-func SetAppInfo(info *TblAppInfo) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+func (b *builder) deleteTable(table *obj.TblTable) {
+	if b.tableMap[table.Name][table.DB] == b.tableIDMap[table.Id] {
+		delete(b.tableMap[table.Name], table.DB)
+		if len(b.tableMap[table.Name]) == 0 {
+			delete(b.tableMap, table.Name)
+		}
+	}
 
-	appInfoMap[info.Appid] = &AppInfo{
+	delete(b.tableIDMap, table.Id)
+}
+
+func newAppInfo(info *TblAppInfo) *AppInfo {
+	return &AppInfo{
 		Info:        info,
+		AllowIP:     parseIPAllowlist(info.Appid, info.AllowIP),
 		AccessDB:    map[int]*TblAccessDB{},
 		AccessTable: map[int]*TblAccessTable{},
 		TableOPs:    map[int]map[string]bool{},
 		DBOps:       map[int]map[string]bool{},
+		Secrets:     map[int]*TblAppSecret{},
+		Columns:     map[int]*ColumnPolicy{},
+		RowFilters:  map[int]map[string]interface{}{},
+		RateLimits:  map[int]*TblRateLimit{},
+		TableIP:     map[int]IPAllowlist{},
+	}
+}
+
+// setAccessDB 更新库授权，应用不存在时返回 false
+func (b *builder) setAccessDB(accessDB *TblAccessDB) bool {
+	appInfo := b.app(accessDB.Appid)
+	if appInfo == nil {
+		return false
+	}
+
+	for dbID, old := range appInfo.AccessDB { // 授权记录修改了库
+		if old.Id == accessDB.Id && dbID != accessDB.DB {
+			deleteAccessDB(appInfo, dbID)
+		}
 	}
+
+	appInfo.AccessDB[accessDB.DB] = accessDB
+	appInfo.DBOps[accessDB.DB] = map[string]bool{}
+	ops := strings.Split(accessDB.Op, ",")
+	for _, op := range ops {
+		appInfo.DBOps[accessDB.DB][op] = true
+	}
+
+	return true
 }
 
-func SetAccessDB(accessDB *TblAccessDB) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+func deleteAccessDB(appInfo *AppInfo, dbID int) {
+	delete(appInfo.AccessDB, dbID)
+	delete(appInfo.DBOps, dbID)
+}
+
+// setAccessTable 更新表授权，应用不存在时返回 false
+func (b *builder) setAccessTable(accessTable *TblAccessTable) bool {
+	appInfo := b.app(accessTable.Appid)
+	if appInfo == nil {
+		return false
+	}
 
-	appInfo, ok := appInfoMap[accessDB.Appid]
-	if ok {
-		appInfo.AccessDB[accessDB.DB] = accessDB
-		appInfo.DBOps[accessDB.DB] = map[string]bool{}
-		ops := strings.Split(accessDB.Op, ",")
-		for _, op := range ops {
-			appInfo.DBOps[accessDB.DB][op] = true
+	for tableID, old := range appInfo.AccessTable { // 授权记录修改了表
+		if old.Id == accessTable.Id && tableID != accessTable.TableId {
+			deleteAccessTable(appInfo, tableID)
 		}
 	}
+
+	appInfo.AccessTable[accessTable.TableId] = accessTable
+	appInfo.TableOPs[accessTable.TableId] = map[string]bool{}
+	ops := strings.Split(accessTable.Op, ",")
+	for _, op := range ops {
+		appInfo.TableOPs[accessTable.TableId][op] = true
+	}
+	setColumnPolicy(appInfo, accessTable)
+	setRowFilter(appInfo, accessTable)
+	setTableIP(appInfo, accessTable)
+
+	return true
+}
+
+func deleteAccessTable(appInfo *AppInfo, tableID int) {
+	delete(appInfo.AccessTable, tableID)
+	delete(appInfo.TableOPs, tableID)
+	delete(appInfo.Columns, tableID)
+	delete(appInfo.RowFilters, tableID)
+	delete(appInfo.TableIP, tableID)
 }
 
-func SetAccessTable(accessTable *TblAccessTable) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+// GetRateLimits 获取应用所有正常状态的限流规则
+func (s *Snapshot) GetRateLimits(appid uint64) []*TblRateLimit {
+	appInfo := s.appInfoMap[appid]
+	if appInfo == nil {
+		return nil
+	}
 
-	appInfo, ok := appInfoMap[accessTable.Appid]
-	if ok {
-		appInfo.AccessTable[accessTable.TableId] = accessTable
-		appInfo.TableOPs[accessTable.TableId] = map[string]bool{}
-		ops := strings.Split(accessTable.Op, ",")
-		for _, op := range ops {
-			appInfo.TableOPs[accessTable.TableId][op] = true
+	var rateLimits []*TblRateLimit
+	for _, rateLimit := range appInfo.RateLimits {
+		if rateLimit.Status == consts.RateLimitStatusNormal {
+			rateLimits = append(rateLimits, rateLimit)
 		}
 	}
+
+	return rateLimits
 }
 
-func SetPlugin(f *TblPlugin) {
-	pluginLock.Lock()
-	defer pluginLock.Unlock()
+// GetAppSecrets 获取应用在 now 时刻所有有效的秘钥，包含应用信息中的秘钥
+func (s *Snapshot) GetAppSecrets(appid uint64, now time.Time) []string {
+	appInfo := s.appInfoMap[appid]
+	if appInfo == nil {
+		return nil
+	}
+
+	var secrets []string
+	if appInfo.Info.Secret != "" {
+		secrets = append(secrets, appInfo.Info.Secret)
+	}
+
+	for _, secret := range appInfo.Secrets {
+		if secret.Status != consts.SecretStatusNormal || secret.Secret == "" {
+			continue
+		}
+
+		if !secret.ValidFrom.IsZero() && now.Before(secret.ValidFrom) {
+			continue
+		}
 
-	plugin[f.Id] = f
+		if !secret.ValidTo.IsZero() && !now.Before(secret.ValidTo) {
+			continue
+		}
+
+		secrets = append(secrets, secret.Secret)
+	}
+
+	return secrets
 }
 
-func InitTablePlugin(tableFitlers []*TblTablePlugin) error {
-	pluginLock.Lock()
-	defer pluginLock.Unlock()
+// GetExpiringGrants 获取在 (now, now+within] 时间内过期的正常状态的库、表授权
+func (s *Snapshot) GetExpiringGrants(now time.Time, within time.Duration) (accessDBs []*TblAccessDB, accessTables []*TblAccessTable) {
+	deadline := now.Add(within)
+	expiring := func(status int8, expireAt time.Time) bool {
+		return status == consts.AuthStatusNormal && !expireAt.IsZero() &&
+			expireAt.After(now) && !expireAt.After(deadline)
+	}
 
-	for _, tf := range tableFitlers {
-		tf.Conf = getPluginConfig(tf.PluginID, tf.PluginVersion, tf.Config)
-		tf.ScheduleConf = &conf.ScheduleConfig{}
-		if tf.ScheduleConfig != "" {
-			err := json.Api.Unmarshal([]byte(tf.ScheduleConfig), &tf.ScheduleConf)
-			if err != nil {
-				log.Errorf(sc.GCtx, errs.ErrPluginConfigDecode,
-					"unmarshal plugin schedule config error=[%v], plugin_id=[%d], plugin_version=[%d], schedule_config=[%s]",
-					err, tf.PluginID, tf.PluginVersion, tf.ScheduleConfig)
+	for _, appInfo := range s.appInfoMap {
+		for _, accessDB := range appInfo.AccessDB {
+			if expiring(accessDB.Status, accessDB.ExpireAt) {
+				accessDBs = append(accessDBs, accessDB)
 			}
 		}
 
-		tablePlugins[tf.TableId] = append(tablePlugins[tf.TableId], tf)
+		for _, accessTable := range appInfo.AccessTable {
+			if expiring(accessTable.Status, accessTable.ExpireAt) {
+				accessTables = append(accessTables, accessTable)
+			}
+		}
+	}
+
+	return
+}
+
+// GetColumnPolicy 获取应用对表的列权限，不限制列时返回 nil
+func (s *Snapshot) GetColumnPolicy(appid uint64, tableID int) *ColumnPolicy {
+	appInfo := s.appInfoMap[appid]
+	if appInfo == nil {
+		return nil
+	}
+
+	return appInfo.Columns[tableID]
+}
+
+func setColumnPolicy(appInfo *AppInfo, accessTable *TblAccessTable) {
+	if accessTable.ReadColumn == "" && accessTable.WriteColumn == "" {
+		delete(appInfo.Columns, accessTable.TableId)
+		return
+	}
+
+	appInfo.Columns[accessTable.TableId] = &ColumnPolicy{
+		Read:  splitColumns(accessTable.ReadColumn),
+		Write: splitColumns(accessTable.WriteColumn),
+		Strip: accessTable.ColumnPolicy == consts.ColumnPolicyStrip,
+	}
+}
+
+// GetRowFilter 获取应用对表的行级过滤条件，不限制行时返回 nil
+func (s *Snapshot) GetRowFilter(appid uint64, tableID int) map[string]interface{} {
+	appInfo := s.appInfoMap[appid]
+	if appInfo == nil {
+		return nil
+	}
+
+	return appInfo.RowFilters[tableID]
+}
+
+func setRowFilter(appInfo *AppInfo, accessTable *TblAccessTable) {
+	if accessTable.RowFilter == "" {
+		delete(appInfo.RowFilters, accessTable.TableId)
+		return
+	}
+
+	filter := map[string]interface{}{}
+
+	err := json.Api.Unmarshal([]byte(accessTable.RowFilter), &filter)
+	if err != nil || len(filter) == 0 {
+		// 行级过滤条件错误时，拒绝所有访问，避免数据越权
+		log.Errorf(sc.GCtx, consts.ErrRowFilterParse,
+			"unmarshal row filter error=[%v], appid=[%d], table_id=[%d], row_filter=[%s]",
+			err, accessTable.Appid, accessTable.TableId, accessTable.RowFilter)
+		filter = map[string]interface{}{RowFilterInvalid: true}
+	}
+
+	appInfo.RowFilters[accessTable.TableId] = filter
+}
+
+// GetAllowIP 获取应用 ip 白名单、应用对表的 ip 白名单，tableID 为 0 时只获取应用 ip 白名单，为 nil 时不限制
+func (s *Snapshot) GetAllowIP(appid uint64, tableID int) (appAllow, tableAllow IPAllowlist) {
+	appInfo := s.appInfoMap[appid]
+	if appInfo == nil {
+		return nil, nil
+	}
+
+	return appInfo.AllowIP, appInfo.TableIP[tableID]
+}
+
+// GetAppidByCert 根据双向 tls 客户端证书的 subject（RFC 2253 格式，比如 CN=partner,O=horm）或 CN
+// 匹配 tbl_app_info.cert_subject，返回对应的 appid。优先匹配完整 subject，匹配结果必须唯一，未匹配或匹配到多个应用时返回 0
+func (s *Snapshot) GetAppidByCert(subject, commonName string) uint64 {
+	var bySubject, byCN []uint64
+
+	for appid, appInfo := range s.appInfoMap {
+		certSubject := appInfo.Info.CertSubject
+		if certSubject == "" || appInfo.Info.Status == consts.AppStatusOffline {
+			continue
+		}
+
+		if certSubject == subject {
+			bySubject = append(bySubject, appid)
+		} else if commonName != "" && certSubject == commonName {
+			byCN = append(byCN, appid)
+		}
+	}
+
+	if len(bySubject) > 0 {
+		return uniqueAppid(bySubject)
 	}
 
-	for k := range tablePlugins {
-		sortedTablePlugins, err := SortTablePlugins(tablePlugins[k])
+	return uniqueAppid(byCN)
+}
+
+func uniqueAppid(appids []uint64) uint64 {
+	if len(appids) != 1 {
+		return 0
+	}
+
+	return appids[0]
+}
+
+func setTableIP(appInfo *AppInfo, accessTable *TblAccessTable) {
+	allow := parseIPAllowlist(accessTable.Appid, accessTable.AllowIP)
+	if allow == nil {
+		delete(appInfo.TableIP, accessTable.TableId)
+		return
+	}
+
+	appInfo.TableIP[accessTable.TableId] = allow
+}
+
+// parseIPAllowlist 解析逗号分隔的 ip、CIDR，空串返回 nil。无法解析的元素记录日志后忽略，不会放开访问
+func parseIPAllowlist(appid uint64, allowIP string) IPAllowlist {
+	if strings.TrimSpace(allowIP) == "" {
+		return nil
+	}
+
+	allow := IPAllowlist{}
+
+	for _, v := range strings.Split(allowIP, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				log.Errorf(sc.GCtx, consts.ErrAllowIPParse, "parse allow ip error, appid=[%d], ip=[%s]", appid, v)
+				continue
+			}
+
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+
+			allow = append(allow, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(v)
 		if err != nil {
-			return err
+			log.Errorf(sc.GCtx, consts.ErrAllowIPParse, "parse allow cidr error=[%v], appid=[%d], cidr=[%s]", err, appid, v)
+			continue
 		}
-		tablePlugins[k] = sortedTablePlugins
+
+		allow = append(allow, ipNet)
 	}
 
-	return nil
+	return allow
 }
 
-func UpdateDBInfo(dbs []*obj.TblDB, tables []*obj.TblTable,
-	appInfos []*TblAppInfo, accessDBs []*TblAccessDB, accessTables []*TblAccessTable) {
-	dbLock.Lock()
-	defer dbLock.Unlock()
+func splitColumns(columns string) map[string]bool {
+	if columns == "" {
+		return nil
+	}
 
-	//更新数据库信息
-	if len(dbs) > 0 {
-		for _, db := range dbs {
-			SetDB(db)
+	ret := map[string]bool{}
+	for _, column := range strings.Split(columns, ",") {
+		column = strings.TrimSpace(column)
+		if column != "" {
+			ret[column] = true
 		}
 	}
 
+	return ret
+}
+
+// orphanRow 应用不存在（尚未同步到或已删除）的秘钥、限流规则、授权记录不生效，记录日志。
+// 应用之后同步到时会全量拉取其秘钥、限流规则、授权
+func orphanRow(name string, id int, appid uint64) {
+	log.Errorf(sc.GCtx, consts.ErrConfigSync, "%s %d is ignored, appid %d is not found in config snapshot", name, id, appid)
+}
+
+// UpdateDBInfo 增量更新库、表、应用及其秘钥、限流规则、授权信息，keys 不为 nil 时删除配置库中已不存在的配置，
+// 有变更时发布新快照。返回当前快照版本及变更说明
+func UpdateDBInfo(rows *ConfigRows, keys *SyncKeys) (version uint64, changes []string) {
+	buildLock.Lock()
+	defer buildLock.Unlock()
+
+	if cur := Current(); rows.empty() && (keys == nil || !cur.hasDeleted(keys)) {
+		return cur.Version, nil
+	}
+
+	b := newBuilder()
+
+	//更新数据库信息
+	for _, db := range rows.DBs {
+		b.setDB(db)
+		changes = append(changes, fmt.Sprintf("tbl_db %d [%s] updated", db.Id, db.Name))
+	}
+
 	//更新表信息
-	if len(tables) > 0 {
-		for _, tbl := range tables {
-			SetTable(tbl)
-		}
+	for _, tbl := range rows.Tables {
+		b.setTable(tbl)
+		changes = append(changes, fmt.Sprintf("tbl_table %d [%s] updated", tbl.Id, tbl.Name))
 	}
 
 	//更新访问者信息
-	for _, info := range appInfos {
-		if _, ok := appInfoMap[info.Appid]; ok {
-			appInfoMap[info.Appid].Info = info
+	for _, info := range rows.AppInfos {
+		if appInfo := b.app(info.Appid); appInfo != nil {
+			appInfo.Info = info
+			appInfo.AllowIP = parseIPAllowlist(info.Appid, info.AllowIP)
 		} else {
-			appInfoMap[info.Appid] = &AppInfo{
-				Info:        info,
-				AccessDB:    map[int]*TblAccessDB{},
-				AccessTable: map[int]*TblAccessTable{},
-				TableOPs:    map[int]map[string]bool{},
-				DBOps:       map[int]map[string]bool{},
-			}
+			b.appInfoMap[info.Appid] = newAppInfo(info)
+			b.copied[info.Appid] = true
 		}
+		changes = append(changes, fmt.Sprintf("tbl_app_info %d [%s] updated, status %d", info.Appid, info.Name, info.Status))
 	}
 
-	for _, accessDB := range accessDBs {
-		appInfo, ok := appInfoMap[accessDB.Appid]
-		if ok {
-			appInfo.AccessDB[accessDB.DB] = accessDB
+	for _, secret := range rows.AppSecrets {
+		if appInfo := b.app(secret.Appid); appInfo != nil {
+			appInfo.Secrets[secret.Id] = secret
+			changes = append(changes, fmt.Sprintf("tbl_app_secret %d of appid %d updated", secret.Id, secret.Appid))
+		} else {
+			orphanRow("tbl_app_secret", secret.Id, secret.Appid)
+		}
+	}
 
-			appInfo.DBOps[accessDB.DB] = map[string]bool{}
-			ops := strings.Split(accessDB.Op, ",")
-			for _, op := range ops {
-				appInfo.DBOps[accessDB.DB][op] = true
-			}
+	for _, rateLimit := range rows.RateLimits {
+		if appInfo := b.app(rateLimit.Appid); appInfo != nil {
+			appInfo.RateLimits[rateLimit.Id] = rateLimit
+			changes = append(changes, fmt.Sprintf("tbl_rate_limit %d of appid %d updated", rateLimit.Id, rateLimit.Appid))
+		} else {
+			orphanRow("tbl_rate_limit", rateLimit.Id, rateLimit.Appid)
 		}
 	}
 
-	for _, accessTable := range accessTables {
-		appInfo, ok := appInfoMap[accessTable.Appid]
-		if ok {
-			appInfo.AccessTable[accessTable.TableId] = accessTable
+	for _, accessDB := range rows.AccessDBs {
+		if b.setAccessDB(accessDB) {
+			changes = append(changes, fmt.Sprintf("tbl_access_db %d (appid %d, db %d) updated",
+				accessDB.Id, accessDB.Appid, accessDB.DB))
+		} else {
+			orphanRow("tbl_access_db", accessDB.Id, accessDB.Appid)
+		}
+	}
 
-			appInfo.TableOPs[accessTable.TableId] = map[string]bool{}
-			ops := strings.Split(accessTable.Op, ",")
-			for _, op := range ops {
-				appInfo.TableOPs[accessTable.TableId][op] = true
-			}
+	for _, accessTable := range rows.AccessTables {
+		if b.setAccessTable(accessTable) {
+			changes = append(changes, fmt.Sprintf("tbl_access_table %d (appid %d, table %d) updated",
+				accessTable.Id, accessTable.Appid, accessTable.TableId))
+		} else {
+			orphanRow("tbl_access_table", accessTable.Id, accessTable.Appid)
 		}
 	}
+
+	for _, alias := range rows.TableAliases {
+		b.setAlias(alias)
+		changes = append(changes, fmt.Sprintf("tbl_table_alias %d [%s] (appid %d) -> table %d updated",
+			alias.Id, alias.Alias, alias.Appid, alias.TableId))
+	}
+
+	if keys != nil {
+		changes = append(changes, b.removeDeleted(keys)...)
+	}
+
+	if len(changes) == 0 {
+		return b.Version, nil
+	}
+
+	return b.publish(), changes
+}
+
+// HasAppInfo 快照中是否有应用信息（包含已下线的应用）
+func (s *Snapshot) HasAppInfo(appid uint64) bool {
+	_, ok := s.appInfoMap[appid]
+	return ok
 }
 
 func getPluginConfig(pluginID, pluginVersion int, config string) map[string]interface{} {
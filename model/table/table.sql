@@ -4,6 +4,8 @@ CREATE TABLE `tbl_access_db` (
                                  `db` int NOT NULL DEFAULT '0' COMMENT '数据库id',
                                  `privilege` varchar(32) NOT NULL DEFAULT '' COMMENT '库权限： 1-表权限（拥有之后可以对库下所有表都增删改查） 2-查，3-增/改 4-删  99-超级权限，在表权限之外，还可以 CREATE、DROP 表',
                                  `status` tinyint NOT NULL DEFAULT '3' COMMENT '状态：1-正常 2-下线 3-审核中 4-审核撤回 5-拒绝',
+                                 `start_at` datetime DEFAULT NULL COMMENT '授权生效时间，为空则立即生效',
+                                 `expire_at` datetime DEFAULT NULL COMMENT '授权过期时间，为空则永久有效',
                                  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
                                  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '记录最后修改时间',
                                  PRIMARY KEY (`id`),
@@ -15,7 +17,14 @@ CREATE TABLE `tbl_access_table` (
                                     `appid` bigint NOT NULL DEFAULT '0' COMMENT '应用appid',
                                     `table_id` int NOT NULL DEFAULT '0' COMMENT '表id',
                                     `privilege` varchar(256) NOT NULL DEFAULT '2' COMMENT '权限 1-表所有权限（增删改查），2-查，3-增/改 4-删',
+                                    `read_column` varchar(2048) NOT NULL DEFAULT '' COMMENT '允许查询、作为条件的列，逗号分隔，空串为不限制',
+                                    `write_column` varchar(2048) NOT NULL DEFAULT '' COMMENT '允许写入的列，逗号分隔，空串为不限制',
+                                    `column_policy` tinyint NOT NULL DEFAULT '1' COMMENT '越权列处理策略 1-拒绝请求 2-剔除越权的查询列、写入列',
+                                    `row_filter` varchar(2048) NOT NULL DEFAULT '' COMMENT '行级过滤条件，json 格式的 where 条件，比如 {"tenant_id":42}',
+                                    `allow_ip` varchar(1024) NOT NULL DEFAULT '' COMMENT '允许访问该表的 ip 或 CIDR，逗号分隔，空串为不限制',
                                     `status` tinyint NOT NULL DEFAULT '3' COMMENT '状态：1-正常 2-下线 3-审核中 4-审核撤回 5-拒绝',
+                                    `start_at` datetime DEFAULT NULL COMMENT '授权生效时间，为空则立即生效',
+                                    `expire_at` datetime DEFAULT NULL COMMENT '授权过期时间，为空则永久有效',
                                     `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
                                     `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '记录最后修改时间',
                                     PRIMARY KEY (`id`),
@@ -26,6 +35,9 @@ CREATE TABLE `tbl_app_info` (
                                 `appid` bigint NOT NULL DEFAULT '' COMMENT '应用appid',
                                 `name` varchar(64) NOT NULL DEFAULT '' COMMENT '应用名称',
                                 `secret` varchar(64) NOT NULL DEFAULT '' COMMENT '应用秘钥',
+                                `forbid_md5` tinyint NOT NULL DEFAULT '0' COMMENT '是否禁止 md5 签名 0-否 1-是',
+                                `allow_ip` varchar(1024) NOT NULL DEFAULT '' COMMENT '允许访问的 ip 或 CIDR，逗号分隔，空串为不限制',
+                                `cert_subject` varchar(512) NOT NULL DEFAULT '' COMMENT '双向 tls 客户端证书 subject 或 CN，匹配的连接以该应用认证',
                                 `intro` varchar(512) NOT NULL DEFAULT '' COMMENT '简介',
                                 `creator` bigint NOT NULL DEFAULT '0' COMMENT 'creator',
                                 `manager` varchar(1025) NOT NULL DEFAULT '' COMMENT '管理员，多个逗号分隔',
@@ -36,6 +48,59 @@ CREATE TABLE `tbl_app_info` (
                                 UNIQUE KEY `appid` (`appid`)
 ) ENGINE=InnoDB AUTO_INCREMENT=7 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='应用信息'
 
+CREATE TABLE `tbl_app_secret` (
+                                  `id` int NOT NULL AUTO_INCREMENT,
+                                  `appid` bigint NOT NULL DEFAULT '0' COMMENT '应用appid',
+                                  `secret` varchar(64) NOT NULL DEFAULT '' COMMENT '应用秘钥',
+                                  `status` tinyint NOT NULL DEFAULT '1' COMMENT '状态：1-正常 2-下线',
+                                  `valid_from` datetime DEFAULT NULL COMMENT '生效时间，为空则立即生效',
+                                  `valid_to` datetime DEFAULT NULL COMMENT '失效时间，为空则永久有效',
+                                  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
+                                  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '记录最后修改时间',
+                                  PRIMARY KEY (`id`),
+                                  KEY `appid` (`appid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='应用秘钥，同一应用可同时存在多个有效秘钥，用于秘钥轮换'
+
+CREATE TABLE `tbl_audit_log` (
+                                 `id` bigint NOT NULL AUTO_INCREMENT,
+                                 `appid` bigint NOT NULL DEFAULT '0' COMMENT '应用appid',
+                                 `caller` varchar(128) NOT NULL DEFAULT '' COMMENT '调用方',
+                                 `trace_id` varchar(64) NOT NULL DEFAULT '' COMMENT 'trace id',
+                                 `request_id` bigint unsigned NOT NULL DEFAULT '0' COMMENT '请求 id',
+                                 `ip` varchar(64) NOT NULL DEFAULT '' COMMENT '客户端 ip',
+                                 `path` varchar(256) NOT NULL DEFAULT '' COMMENT '执行单元路径',
+                                 `op` varchar(32) NOT NULL DEFAULT '' COMMENT '操作',
+                                 `db` varchar(64) NOT NULL DEFAULT '' COMMENT '库名',
+                                 `tables` varchar(512) NOT NULL DEFAULT '' COMMENT '表，多个逗号分隔',
+                                 `where_cond` mediumtext COMMENT '实际执行的条件（json）',
+                                 `data` mediumtext COMMENT '写入数据（json）',
+                                 `query` mediumtext COMMENT '原生语句',
+                                 `args` text COMMENT '原生语句参数（json）',
+                                 `affected` bigint NOT NULL DEFAULT '-1' COMMENT '影响行数，-1 为未知',
+                                 `before_image` mediumtext COMMENT 'update、delete 执行前匹配的数据（json）',
+                                 `error` varchar(1024) NOT NULL DEFAULT '' COMMENT '执行失败原因',
+                                 `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '执行时间',
+                                 PRIMARY KEY (`id`),
+                                 KEY `appid` (`appid`,`created_at`),
+                                 KEY `trace_id` (`trace_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='写操作审计记录，只追加不修改，建在 server.yaml audit.store 指定的库中'
+
+CREATE TABLE `tbl_rate_limit` (
+                                  `id` int NOT NULL AUTO_INCREMENT,
+                                  `appid` bigint NOT NULL DEFAULT '0' COMMENT '应用appid',
+                                  `table_id` int NOT NULL DEFAULT '0' COMMENT '表id，0 为应用维度限流',
+                                  `op` varchar(32) NOT NULL DEFAULT '' COMMENT '限流的表操作，空串为所有操作',
+                                  `qps` int NOT NULL DEFAULT '0' COMMENT '每秒请求数，0 为不限制',
+                                  `burst` int NOT NULL DEFAULT '0' COMMENT '突发请求数，0 时等于 qps',
+                                  `max_inflight` int NOT NULL DEFAULT '0' COMMENT '单实例最大并发请求数，0 为不限制',
+                                  `scope` tinyint NOT NULL DEFAULT '1' COMMENT '限流范围 1-单实例 2-集群',
+                                  `status` tinyint NOT NULL DEFAULT '1' COMMENT '状态：1-正常 2-下线',
+                                  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
+                                  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '记录最后修改时间',
+                                  PRIMARY KEY (`id`),
+                                  KEY `appid` (`appid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='应用限流规则'
+
 CREATE TABLE `tbl_collect_table` (
                                      `id` int NOT NULL AUTO_INCREMENT,
                                      `userid` bigint NOT NULL DEFAULT '0' COMMENT '用户id',
@@ -180,6 +245,19 @@ CREATE TABLE `tbl_table` (
                              UNIQUE KEY `name` (`name`,`db`)
 ) ENGINE=InnoDB AUTO_INCREMENT=10 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='表配置'
 
+CREATE TABLE `tbl_table_alias` (
+                                   `id` int NOT NULL AUTO_INCREMENT,
+                                   `alias` varchar(256) NOT NULL DEFAULT '' COMMENT '逻辑表名（执行单元名），可带库名 db::name',
+                                   `appid` bigint NOT NULL DEFAULT '0' COMMENT '应用appid，0 为 workspace 下所有应用',
+                                   `table_id` int NOT NULL DEFAULT '0' COMMENT '映射的物理表id',
+                                   `intro` varchar(64) NOT NULL DEFAULT '' COMMENT '简介',
+                                   `status` tinyint NOT NULL DEFAULT '1' COMMENT '状态：1-正常 2-下线',
+                                   `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
+                                   `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '记录最后修改时间',
+                                   PRIMARY KEY (`id`),
+                                   UNIQUE KEY `alias` (`alias`,`appid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci COMMENT='表别名，逻辑表名映射到物理表'
+
 CREATE TABLE `tbl_table_plugin` (
                                     `id` int NOT NULL AUTO_INCREMENT,
                                     `table_id` int NOT NULL COMMENT '表id',
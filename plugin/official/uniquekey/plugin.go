@@ -27,6 +27,11 @@ import (
 // Plugin 表主键生成插件
 type Plugin struct{}
 
+// ExplainSafe 只在请求中生成主键，没有副作用
+func (ft *Plugin) ExplainSafe() bool {
+	return true
+}
+
 func (ft *Plugin) Handle(ctx context.Context,
 	req *plugin.Request,
 	rsp *plugin.Response,
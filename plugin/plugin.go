@@ -41,6 +41,11 @@ type Plugin interface {
 		conf conf.PluginConfig, f conf.HandleFunc) error
 }
 
+// ExplainSafe 插件声明自己没有副作用（不写库、不写缓存、不调用外部服务），解释模式（Explain）只执行声明了无副作用的插件
+type ExplainSafe interface {
+	ExplainSafe() bool
+}
+
 // GetRequestHeader get request header from extend
 func GetRequestHeader(extend types.Map) *plugin.Header {
 	header, _ := extend["request_header"].(*plugin.Header)
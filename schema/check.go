@@ -0,0 +1,394 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/errs"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+	pf "github.com/horm-database/common/proto/plugin"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/common/util"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/consts"
+)
+
+var (
+	sqlColumnRegexp = regexp.MustCompile("^[`\"]?([A-Za-z_][A-Za-z0-9_$]*)[`\"]?$")
+	esColumnRegexp  = regexp.MustCompile(`^[^\s()*,'"]+$`)
+)
+
+// target 待校验的查询列、条件、分组、排序、写入数据
+type target struct {
+	op     string
+	query  string
+	column []string
+	where  map[string]interface{}
+	group  []string
+	order  []string
+	data   map[string]interface{}
+	datas  []map[string]interface{}
+	join   bool
+	refer  bool // 引用尚未解析，key 以 @ 开头的值为引用，不校验值类型
+}
+
+// CheckUnit 在 InitTree 中校验执行单元，所有执行单元执行之前发现不存在的列、类型不符的值，避免部分执行单元已执行。
+// 引用其他执行单元结果的值此时尚未解析，不校验类型
+func CheckUnit(ctx context.Context, node *obj.Tree) error {
+	unit := node.GetUnit()
+
+	return checkHandle(ctx, node, &target{
+		op:     node.GetOp(),
+		query:  unit.Query,
+		column: unit.Column,
+		where:  unit.Where,
+		group:  unit.Group,
+		order:  unit.Order,
+		data:   unit.Data,
+		datas:  unit.Datas,
+		join:   len(unit.Join) > 0,
+		refer:  true,
+	})
+}
+
+// Check 执行之前校验经引用替换、插件处理之后最终请求的查询列、条件列、分组、排序、写入列及值类型
+func Check(ctx context.Context, node *obj.Tree, req *pf.Request) error {
+	return checkHandle(ctx, node, &target{
+		op:     req.Op,
+		query:  req.Query,
+		column: req.Column,
+		where:  req.Where,
+		group:  req.Group,
+		order:  req.Order,
+		data:   req.Data,
+		datas:  req.Datas,
+		join:   len(req.Join) > 0,
+	})
+}
+
+// checkHandle 未拉取到表结构的表、原生 query 语句、非增删改查操作不校验。audit 模式仅记录日志、上报监控
+func checkHandle(ctx context.Context, node *obj.Tree, t *target) error {
+	if mode == auth.ModeOff || t.query != "" || node.GetTable() == nil || node.GetDB() == nil {
+		return nil
+	}
+
+	switch t.op {
+	case cc.OpFind, cc.OpFindAll, cc.OpInsert, cc.OpReplace, cc.OpUpdate, cc.OpDelete:
+	default:
+		return nil
+	}
+
+	s := GetTable(node.GetTable().Id)
+	if s == nil {
+		return nil
+	}
+
+	c := &checker{node: node, table: s, dbType: node.GetDB().Addr.Type, join: t.join, refer: t.refer}
+
+	err := c.check(t)
+	if err == nil {
+		return nil
+	}
+
+	if mode == auth.ModeAudit {
+		log.Warnf(ctx, "[schema audit] request would be denied in enforce mode: %v", errs.Msg(err))
+		metrics.IncrCounter("SchemaAuditDeny", 1)
+		return nil
+	}
+
+	return err
+}
+
+type checker struct {
+	node   *obj.Tree
+	table  *Table
+	dbType int
+	join   bool
+	refer  bool
+}
+
+func (c *checker) check(t *target) error {
+	for _, column := range t.column {
+		if _, err := c.column("column", column, false); err != nil {
+			return err
+		}
+	}
+
+	if err := c.where(t.where); err != nil {
+		return err
+	}
+
+	for _, group := range t.group {
+		if _, err := c.column("group", group, false); err != nil {
+			return err
+		}
+	}
+
+	for _, order := range util.FormatOrders(t.order) {
+		if _, err := c.column("order", order.Field, false); err != nil {
+			return err
+		}
+	}
+
+	if err := c.data(t.data); err != nil {
+		return err
+	}
+
+	for _, data := range t.datas {
+		if err := c.data(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// where 校验条件列，递归校验 AND、OR、NOT 及 es 的 must、should 等连接词下的条件，
+// 等于、不等于、比较、区间条件校验值类型，like、全文检索、函数条件只校验列
+func (c *checker) where(where map[string]interface{}) error {
+	isElastic := c.dbType == cc.DBTypeElastic
+
+	for k, v := range where {
+		rv := reflect.ValueOf(v)
+		isRelation, isSliceAndOR, _ := util.GetRelation(c.dbType, k, rv)
+		if isRelation {
+			if isSliceAndOR {
+				for i := 0; i < rv.Len(); i++ {
+					if sub, ok := rv.Index(i).Interface().(map[string]interface{}); ok {
+						if err := c.where(sub); err != nil {
+							return err
+						}
+					}
+				}
+			} else if sub, ok := v.(map[string]interface{}); ok {
+				if err := c.where(sub); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		key, refer := c.referKey(k)
+
+		name, operator, _, _, _, _, _ := util.OperatorMatch(key, isElastic)
+		if operator == "FUNC" {
+			continue
+		}
+
+		col, err := c.column("where", name, false)
+		if err != nil {
+			return err
+		}
+
+		if col == nil || refer {
+			continue
+		}
+
+		switch operator {
+		case "", cc.OPEqual, cc.OPNot, cc.OPGt, cc.OPGte, cc.OPLt, cc.OPLte, cc.OPBetween, cc.OPNotBetween:
+		default:
+			continue
+		}
+
+		if rv.Kind() == reflect.Map {
+			continue
+		}
+
+		if err = c.value("where", col, v, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// data 校验写入列及值类型，sql 表不允许写入不存在的列，es 索引仅 dynamic 为 strict 时不允许
+func (c *checker) data(data map[string]interface{}) error {
+	for k, v := range data {
+		key, refer := c.referKey(k)
+
+		col, err := c.column("data", key, !c.table.Strict)
+		if err != nil {
+			return err
+		}
+
+		if col == nil || refer {
+			continue
+		}
+
+		if err = c.value("data", col, v, c.dbType == cc.DBTypeElastic); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// column 校验列是否存在，返回列信息。无法识别列名的表达式（函数、别名等）、*、es 元字段不校验，返回 nil。
+// 有 join 时只校验以本表名、别名限定的列
+func (c *checker) column(part, column string, allowUnknown bool) (*Column, error) {
+	column = strings.TrimSpace(util.RemoveComments(column))
+	if column == "" || column == "*" {
+		return nil, nil
+	}
+
+	var name string
+
+	if c.dbType == cc.DBTypeElastic {
+		if column[0] == '_' || !esColumnRegexp.MatchString(column) {
+			return nil, nil
+		}
+		name = column
+	} else {
+		qualifier := ""
+		if index := strings.LastIndex(column, "."); index != -1 {
+			qualifier, column = strings.Trim(column[:index], "`\""), column[index+1:]
+		}
+
+		if c.join && !c.ownQualifier(qualifier) {
+			return nil, nil
+		}
+
+		matches := sqlColumnRegexp.FindStringSubmatch(column)
+		if len(matches) != 2 {
+			return nil, nil
+		}
+		name = matches[1]
+	}
+
+	col := c.table.Columns[columnKey(c.dbType, name)]
+	if col == nil && !allowUnknown {
+		return nil, c.fieldError(part, name, "unknown column")
+	}
+
+	return col, nil
+}
+
+// value 校验值类型，elements 为 true 时数组逐个元素校验（条件中的 in、区间，es 的数组字段）
+func (c *checker) value(part string, col *Column, v interface{}, elements bool) error {
+	if col.Kind == KindAny {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if elements && (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) {
+		for i := 0; i < rv.Len(); i++ {
+			if err := c.value(part, col, rv.Index(i).Interface(), false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !valueMatch(col.Kind, v) {
+		return c.fieldError(part, col.Name,
+			fmt.Sprintf("%s column expects %s value, got %s", col.Type, kindName(col.Kind), valueString(v)))
+	}
+
+	return nil
+}
+
+// referKey 去掉引用 key 的 @ 前缀，InitTree 阶段引用尚未解析，引用的值不校验类型
+func (c *checker) referKey(key string) (string, bool) {
+	if c.refer && types.FirstWord(util.RemoveComments(key), 1) == "@" {
+		return strings.TrimSpace(key)[1:], true
+	}
+
+	return key, false
+}
+
+func (c *checker) ownQualifier(qualifier string) bool {
+	if qualifier == "" {
+		return false
+	}
+
+	if qualifier == c.node.GetAlias() || qualifier == c.node.GetTable().Name {
+		return true
+	}
+
+	for _, name := range c.node.Tables() {
+		if qualifier == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *checker) fieldError(part, column, reason string) error {
+	return errs.Newf(consts.ErrSchemaCheck, "[%s] schema check failed, column [%s] in %s of table %s: %s",
+		c.node.GetPath(), column, part, c.node.GetTable().Name, reason)
+}
+
+// valueMatch 值是否符合列的值类型。数值列允许数值字符串、布尔（tinyint 存储布尔），布尔列允许数值及 true、false 字符串，
+// 时间列允许字符串、数值（时间戳）
+func valueMatch(kind int8, v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	rv := reflect.ValueOf(v)
+
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return false
+	case reflect.Bool:
+		return kind != KindTime
+	case reflect.String:
+		switch kind {
+		case KindNumber:
+			_, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+			return err == nil
+		case KindBool:
+			_, err := strconv.ParseBool(strings.TrimSpace(rv.String()))
+			return err == nil
+		default:
+			return true
+		}
+	default:
+		return true
+	}
+}
+
+func kindName(kind int8) string {
+	switch kind {
+	case KindNumber:
+		return "number"
+	case KindBool:
+		return "bool"
+	case KindTime:
+		return "time"
+	default:
+		return "any"
+	}
+}
+
+func valueString(v interface{}) string {
+	s := fmt.Sprintf("%T %v", v, v)
+	if len(s) > 64 {
+		s = s[:64] + "..."
+	}
+
+	return s
+}
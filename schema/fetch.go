@@ -0,0 +1,256 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"context"
+	"strings"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/orm/database/elastic"
+	"github.com/horm-database/orm/database/elastic/client"
+	"github.com/horm-database/orm/database/sql"
+	"github.com/horm-database/orm/obj"
+
+	esv6 "github.com/olivere/elastic/v6"
+	esv7 "github.com/olivere/elastic/v7"
+)
+
+// sqlColumns 从 information_schema（clickhouse 为 system.columns，sqlite 为 pragma_table_info）获取表的列，
+// 表名可以带 schema（库名）前缀，不带时为连接的当前库
+func sqlColumns(ctx context.Context, db *obj.TblDB, name string) (map[string]*Column, error) {
+	schemaName, tableName := "", name
+	if index := strings.LastIndex(name, "."); index != -1 {
+		schemaName, tableName = name[:index], name[index+1:]
+	}
+
+	statement, params := columnsSQL(db.Addr.Type, schemaName, tableName)
+
+	query := sql.Query{
+		OP:     cc.OpFindAll,
+		SQL:    statement,
+		Params: params,
+		DB:     db,
+		Addr:   db.Addr,
+	}
+
+	ret, _, isNil, err := query.Query(ctx)
+	if err != nil || isNil {
+		return nil, err
+	}
+
+	rows, _ := ret.([]map[string]interface{})
+	columns := make(map[string]*Column, len(rows))
+
+	for _, row := range rows {
+		c := &Column{
+			Name: types.InterfaceToString(row["name"]),
+			Type: strings.ToLower(types.InterfaceToString(row["type"])),
+		}
+
+		if db.Addr.Type != cc.DBTypeSQLite { // sqlite 为动态类型，任意列可以存储任意类型的值
+			c.Kind = sqlKind(c.Type)
+		}
+
+		columns[columnKey(db.Addr.Type, c.Name)] = c
+	}
+
+	return columns, nil
+}
+
+func columnsSQL(dbType int, schemaName, tableName string) (string, []interface{}) {
+	switch dbType {
+	case cc.DBTypePostgreSQL:
+		if schemaName == "" {
+			return "SELECT column_name AS name, data_type AS type FROM information_schema.columns " +
+				"WHERE table_schema = current_schema() AND table_name = $1", []interface{}{tableName}
+		}
+		return "SELECT column_name AS name, data_type AS type FROM information_schema.columns " +
+			"WHERE table_schema = $1 AND table_name = $2", []interface{}{schemaName, tableName}
+	case cc.DBTypeClickHouse:
+		if schemaName == "" {
+			return "SELECT name, type FROM system.columns " +
+				"WHERE database = currentDatabase() AND table = ?", []interface{}{tableName}
+		}
+		return "SELECT name, type FROM system.columns " +
+			"WHERE database = ? AND table = ?", []interface{}{schemaName, tableName}
+	case cc.DBTypeSQLite:
+		if schemaName == "" {
+			return "SELECT name, type FROM pragma_table_info(?)", []interface{}{tableName}
+		}
+		return "SELECT name, type FROM pragma_table_info(?, ?)", []interface{}{tableName, schemaName}
+	default:
+		if schemaName == "" {
+			return "SELECT COLUMN_NAME AS name, DATA_TYPE AS type FROM information_schema.COLUMNS " +
+				"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", []interface{}{tableName}
+		}
+		return "SELECT COLUMN_NAME AS name, DATA_TYPE AS type FROM information_schema.COLUMNS " +
+			"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", []interface{}{schemaName, tableName}
+	}
+}
+
+var sqlNumberTypes = map[string]bool{
+	"tinyint": true, "smallint": true, "mediumint": true, "int": true, "integer": true, "bigint": true,
+	"decimal": true, "numeric": true, "float": true, "double": true, "real": true, "double precision": true,
+	"smallserial": true, "serial": true, "bigserial": true, "bit": true, "year": true,
+}
+
+// sqlKind 根据列类型获取值类型，clickhouse 的 Nullable、LowCardinality 取内层类型
+func sqlKind(typ string) int8 {
+	for _, wrapper := range []string{"nullable(", "lowcardinality("} {
+		for strings.HasPrefix(typ, wrapper) && strings.HasSuffix(typ, ")") {
+			typ = typ[len(wrapper) : len(typ)-1]
+		}
+	}
+
+	if index := strings.Index(typ, "("); index != -1 {
+		typ = typ[:index]
+	}
+
+	typ = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(typ), "unsigned"))
+
+	switch {
+	case sqlNumberTypes[typ]:
+		return KindNumber
+	case strings.HasPrefix(typ, "int") && typ != "interval", strings.HasPrefix(typ, "uint"),
+		strings.HasPrefix(typ, "float"), strings.HasPrefix(typ, "decimal"): // clickhouse Int8、UInt64、Float32、Decimal64 等
+		return KindNumber
+	case typ == "bool" || typ == "boolean":
+		return KindBool
+	case strings.HasPrefix(typ, "date"), strings.HasPrefix(typ, "time"):
+		return KindTime
+	default:
+		return KindAny
+	}
+}
+
+// columnKey mysql、sqlite 列名不区分大小写，统一转为小写
+func columnKey(dbType int, name string) string {
+	if dbType == cc.DBTypeMySQL || dbType == cc.DBTypeSQLite {
+		return strings.ToLower(name)
+	}
+
+	return name
+}
+
+// esColumns 从 mapping 获取索引的字段，object、nested 字段展开为 a.b 形式，multi-fields 展开为 a.raw 形式。
+// 索引名为别名或通配时合并所有匹配索引的字段，所有索引的 dynamic 都为 strict 时拒绝写入未知字段
+func esColumns(ctx context.Context, db *obj.TblDB, index string) (map[string]*Column, bool, error) {
+	var result map[string]interface{}
+
+	if db.Addr.Version == elastic.ElasticV6 {
+		c, err := client.NewClientV6(true, db.Addr)
+		if err != nil {
+			return nil, false, err
+		}
+
+		result, err = c.GetMapping().Index(index).Do(ctx)
+		if esv6.IsNotFound(err) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+	} else {
+		c, err := client.NewClientV7(true, db.Addr)
+		if err != nil {
+			return nil, false, err
+		}
+
+		result, err = c.GetMapping().Index(index).Do(ctx)
+		if esv7.IsNotFound(err) {
+			return nil, false, nil
+		} else if err != nil {
+			return nil, false, err
+		}
+	}
+
+	columns := map[string]*Column{}
+	strict := len(result) > 0
+
+	for _, v := range result {
+		indexMapping, _ := v.(map[string]interface{})
+		mappings, _ := indexMapping["mappings"].(map[string]interface{})
+
+		if _, ok := mappings["properties"]; ok { // v7 无 type
+			strict = strict && types.InterfaceToString(mappings["dynamic"]) == "strict"
+			esProperties(mappings["properties"], "", columns)
+			continue
+		}
+
+		for _, typeMapping := range mappings { // v6 type -> mapping
+			m, ok := typeMapping.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			strict = strict && types.InterfaceToString(m["dynamic"]) == "strict"
+			esProperties(m["properties"], "", columns)
+		}
+	}
+
+	return columns, strict, nil
+}
+
+func esProperties(properties interface{}, prefix string, columns map[string]*Column) {
+	props, _ := properties.(map[string]interface{})
+
+	for name, v := range props {
+		field, _ := v.(map[string]interface{})
+		fullName := prefix + name
+
+		typ, _ := field["type"].(string)
+		if typ == "" && field["properties"] != nil {
+			typ = "object"
+		}
+
+		addESColumn(columns, fullName, typ)
+
+		if field["properties"] != nil {
+			esProperties(field["properties"], fullName+".", columns)
+		}
+
+		fields, _ := field["fields"].(map[string]interface{})
+		for subName, sub := range fields {
+			subField, _ := sub.(map[string]interface{})
+			subType, _ := subField["type"].(string)
+			addESColumn(columns, fullName+"."+subName, subType)
+		}
+	}
+}
+
+// addESColumn 多个索引中同名字段类型不一致时不校验值类型
+func addESColumn(columns map[string]*Column, name, typ string) {
+	c := &Column{Name: name, Type: typ, Kind: esKind(typ)}
+
+	if old := columns[name]; old != nil && old.Kind != c.Kind {
+		c.Kind = KindAny
+	}
+
+	columns[name] = c
+}
+
+func esKind(typ string) int8 {
+	switch typ {
+	case "long", "integer", "short", "byte", "double", "float", "half_float", "scaled_float", "unsigned_long":
+		return KindNumber
+	case "boolean":
+		return KindBool
+	case "date", "date_nanos":
+		return KindTime
+	default:
+		return KindAny
+	}
+}
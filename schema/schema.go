@@ -0,0 +1,262 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cc "github.com/horm-database/common/consts"
+	"github.com/horm-database/common/log"
+	"github.com/horm-database/common/metrics"
+	"github.com/horm-database/orm/obj"
+	"github.com/horm-database/server/auth"
+	"github.com/horm-database/server/consts"
+	"github.com/horm-database/server/model/table"
+)
+
+const (
+	defaultRefresh     = 300  // 表结构全量刷新间隔默认值（单位 秒）
+	defaultConcurrency = 4    // 每个库同时拉取表结构的并发数默认值
+	defaultTimeout     = 3000 // 单个表结构拉取超时默认值（单位 ms）
+)
+
+const ( // 列值类型
+	KindAny    int8 = 0 // 不校验值类型
+	KindNumber int8 = 1 // 数值
+	KindBool   int8 = 2 // 布尔
+	KindTime   int8 = 3 // 日期、时间
+)
+
+// Column 列信息
+type Column struct {
+	Name string // 列名，es 嵌套字段为 a.b 形式
+	Type string // 数据库中的类型，比如 bigint、varchar、keyword
+	Kind int8   // 值类型
+}
+
+// Table 表结构
+type Table struct {
+	Columns map[string]*Column // 列名 -> 列信息
+	Strict  bool               // 是否拒绝写入未知列，sql 表始终拒绝，es 仅 dynamic 为 strict 时拒绝
+
+	tbl *obj.TblTable // 拉取表结构时的表配置，配置快照中的记录不可变，记录变化即表、库配置有修改
+	db  *obj.TblDB
+}
+
+var (
+	mode        = auth.ModeOff                                     // 校验模式
+	refresh     = time.Duration(defaultRefresh) * time.Second      // 全量刷新间隔
+	concurrency = defaultConcurrency                               // 每个库同时拉取表结构的并发数
+	timeout     = time.Duration(defaultTimeout) * time.Millisecond // 单个表结构拉取超时
+
+	tables      atomic.Value             // 表 id -> 表结构，map[int]*Table，整体替换
+	published   atomic.Value             // 最新发布的配置快照，*table.Snapshot
+	notify      = make(chan struct{}, 1) // 配置快照发布通知
+	lastVersion uint64                   // 最近一次刷新时的配置快照版本
+)
+
+func init() {
+	tables.Store(map[int]*Table{})
+	table.OnPublish(onPublish)
+}
+
+// SetMode 设置执行单元结构校验模式 off/audit/enforce，为空时为 off，未知模式返回错误。
+// interval 为表结构全量刷新间隔（单位 秒），默认 300，用于发现库中直接执行的表结构变更
+func SetMode(m string, interval int) (err error) {
+	mode, err = auth.ParseMode(m)
+	if err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		interval = defaultRefresh
+	}
+
+	refresh = time.Duration(interval) * time.Second
+	return nil
+}
+
+// SetFetch 设置每个库同时拉取表结构的并发数，默认 4，以及单个表结构拉取超时（单位 ms），默认 3000
+func SetFetch(n, ms int) {
+	if n <= 0 {
+		n = defaultConcurrency
+	}
+
+	if ms <= 0 {
+		ms = defaultTimeout
+	}
+
+	concurrency = n
+	timeout = time.Duration(ms) * time.Millisecond
+}
+
+// GetTable 获取表结构，未拉取到表结构（库类型不支持、表不存在、拉取失败）时返回 nil
+func GetTable(tableID int) *Table {
+	return tables.Load().(map[int]*Table)[tableID]
+}
+
+// onPublish 配置快照发布回调，在持有快照生成锁时执行，只记录快照并通知刷新协程，不能阻塞
+func onPublish(s *table.Snapshot) {
+	published.Store(s)
+
+	select {
+	case notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run 刷新表结构，需在单独的协程中执行：配置快照发布后只拉取新增、配置有修改的表，每隔全量刷新间隔重新拉取所有表。
+// 拉取失败时沿用上次的表结构，没有则不做校验，在下一次全量刷新时重试
+func Run(ctx context.Context) {
+	if mode == auth.ModeOff {
+		return
+	}
+
+	ticker := time.NewTicker(refresh)
+	defer ticker.Stop()
+
+	for full := true; ; {
+		if snap, ok := published.Load().(*table.Snapshot); ok && (full || snap.Version != lastVersion) {
+			refreshTables(ctx, snap, full)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-notify:
+			full = false
+		case <-ticker.C:
+			full = true
+		}
+	}
+}
+
+// refreshTables 按快照刷新表结构，各库并行拉取，同一个库最多 concurrency 个表同时拉取
+func refreshTables(ctx context.Context, snap *table.Snapshot, full bool) {
+	old := tables.Load().(map[int]*Table)
+	next := make(map[int]*Table, len(old))
+
+	dbs := map[int]*obj.TblDB{}
+	todo := map[int][]*obj.TblTable{} // 库 id -> 需要拉取的表
+
+	for _, dbTables := range snap.GetTables() {
+		for _, tbl := range dbTables {
+			db := snap.GetTablesDB(tbl)
+			if db == nil || db.Addr == nil {
+				continue
+			}
+
+			if !full && unchanged(old[tbl.Id], tbl, db) {
+				next[tbl.Id] = old[tbl.Id]
+				continue
+			}
+
+			dbs[db.Id] = db
+			todo[db.Id] = append(todo[db.Id], tbl)
+		}
+	}
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+
+	for id, tbls := range todo {
+		wg.Add(1)
+		go func(db *obj.TblDB, tbls []*obj.TblTable) {
+			defer wg.Done()
+
+			fetchDB(ctx, db, tbls, func(tbl *obj.TblTable, t *Table, err error) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				if err != nil {
+					metrics.IncrCounter("SchemaFetchFail", 1)
+					log.Errorf(ctx, consts.ErrSchemaFetch, "fetch schema of table %s in db %s error: %v",
+						tbl.Name, db.Name, err)
+
+					if unchanged(old[tbl.Id], tbl, db) { // 配置未修改，沿用上次拉取的表结构
+						next[tbl.Id] = old[tbl.Id]
+					}
+					return
+				}
+
+				if t != nil {
+					next[tbl.Id] = t
+				}
+			})
+		}(dbs[id], tbls)
+	}
+
+	wg.Wait()
+
+	tables.Store(next)
+	lastVersion = snap.Version
+}
+
+// fetchDB 拉取同一个库中的表结构，最多 concurrency 个表同时拉取，每个表拉取超时为 timeout
+func fetchDB(ctx context.Context, db *obj.TblDB, tbls []*obj.TblTable,
+	done func(tbl *obj.TblTable, t *Table, err error)) {
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+
+	for _, tbl := range tbls {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(tbl *obj.TblTable) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			fctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			t, err := fetch(fctx, db, tbl)
+			done(tbl, t, err)
+		}(tbl)
+	}
+
+	wg.Wait()
+}
+
+// unchanged 表、库配置是否与拉取表结构时相同，配置快照中的记录不可变，记录未替换即配置未修改
+func unchanged(t *Table, tbl *obj.TblTable, db *obj.TblDB) bool {
+	return t != nil && t.tbl == tbl && t.db == db
+}
+
+// fetch 拉取表结构，不支持的库类型及库中不存在的表返回 nil
+func fetch(ctx context.Context, db *obj.TblDB, tbl *obj.TblTable) (*Table, error) {
+	var columns map[string]*Column
+	var strict = true
+	var err error
+
+	switch db.Addr.Type {
+	case cc.DBTypeMySQL, cc.DBTypePostgreSQL, cc.DBTypeClickHouse, cc.DBTypeSQLite:
+		columns, err = sqlColumns(ctx, db, tbl.Name)
+	case cc.DBTypeElastic:
+		columns, strict, err = esColumns(ctx, db, tbl.Name)
+	default:
+		return nil, nil
+	}
+
+	if err != nil || len(columns) == 0 {
+		return nil, err
+	}
+
+	return &Table{Columns: columns, Strict: strict, tbl: tbl, db: db}, nil
+}
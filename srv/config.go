@@ -47,9 +47,60 @@ type config struct {
 		Timeout          int    `yaml:"timeout"`             // 服务超时时间(单位 ms)
 		IdleTime         int    `yaml:"idle_time"`           // 连接最大空闲时间，默认为 1 分钟。(单位 ms)
 		EventLoopNum     int    `yaml:"event_loop_num"`      // gnet loop 大小，默认取 CPU 核数
-		TLSKey           string `yaml:"tls_key"`             // tls key
-		TLSCert          string `yaml:"tls_cert"`            // tls cert
-		CACert           string `yaml:"ca_cert"`             // ca cert
+		ParallelNum      int    `yaml:"parallel_num"`        // 单个请求（包括嵌套子查询）同时执行的最大查询数，默认 16
+		TLSKey           string `yaml:"tls_key"`             // tls 私钥文件，与 tls_cert 同时配置时 http、rpc 启用 tls
+		TLSCert          string `yaml:"tls_cert"`            // tls 证书文件
+		CACert           string `yaml:"ca_cert"`             // ca 证书文件，配置后客户端必须提供该 ca 签发的证书（双向 tls）
+	}
+
+	Source struct {
+		Type string `yaml:"type"` // 配置数据源 db/file，默认 db（配置库）
+		Dir  string `yaml:"dir"`  // file 数据源的配置目录，每个配置表一个 yaml/json 文件，每个同步周期 stat 轮询，修改后在同步周期内生效
+
+		SnapshotDir  string `yaml:"snapshot_dir"`  // 本地配置快照目录，数据源不可用时从最新快照启动，为空不保存快照
+		SnapshotKeep int    `yaml:"snapshot_keep"` // 最多保留的快照文件数，默认 5
+
+		Notify        string `yaml:"notify"`         // 配置变更通知通道，tbl_db 中的 redis 库名，memory 为进程内通道，为空不开启
+		NotifyChannel string `yaml:"notify_channel"` // 变更通知 redis 订阅频道，默认 horm_config_change
+		SyncInterval  int    `yaml:"sync_interval"`  // 定时同步间隔（单位 ms），未开启通知时默认 2000，开启通知后默认 60000
+		Reconcile     int    `yaml:"reconcile"`      // 全量对账间隔（单位 ms），默认 60000，对账删除数据源中已物理删除的配置
+	}
+
+	Auth struct {
+		SignMode       string   `yaml:"sign_mode"`       // 签名校验模式 off/audit/enforce，默认 off
+		PermissionMode string   `yaml:"permission_mode"` // 库表权限校验模式 off/audit/enforce，默认 off
+		ClockSkew      int      `yaml:"clock_skew"`      // 允许的客户端时钟偏差（单位 ms），默认 300000
+		NonceStore     string   `yaml:"nonce_store"`     // 防重放 nonce 存储，memory 为本地内存，否则为 tbl_db 中的 redis 库名
+		NonceCapacity  int      `yaml:"nonce_capacity"`  // 本地内存最多存储的未过期 nonce 数量，默认 1000000，应不小于 qps × 2 × clock_skew，存满时拒绝请求
+		GrantWarn      int      `yaml:"grant_warn"`      // 库表授权过期预警时间（单位 小时），默认 72
+		JWKSFile       string   `yaml:"jwks_file"`       // http bearer token（jwt）校验秘钥 JWKS 文件，支持 HS256、RS256，为空不支持 jwt
+		JWTAppidClaim  string   `yaml:"jwt_appid_claim"` // jwt 中 appid 对应的 claim，默认 appid
+		JWTIssuer      string   `yaml:"jwt_issuer"`      // 不为空时校验 jwt 的 iss
+		JWTAudience    string   `yaml:"jwt_audience"`    // 不为空时校验 jwt 的 aud
+		AdminAppids    []uint64 `yaml:"admin_appids"`    // 允许调用管理接口（ConfigNotify）的 appid，管理接口始终强制校验签名，为空时拒绝调用
+	}
+
+	Limit struct {
+		SharedCounter string `yaml:"shared_counter"` // 集群限流共享计数器，tbl_db 中的 redis 库名，为空时集群限流规则退化为单实例限流
+	}
+
+	Audit struct {
+		Store            string `yaml:"store"`              // 审计表所在库，tbl_db 中的 mysql、postgresql、clickhouse 库名，为空不写审计表
+		Table            string `yaml:"table"`              // 审计表名，默认 tbl_audit_log
+		File             string `yaml:"file"`               // 本地审计文件，为空不写本地文件
+		MaxSize          int    `yaml:"max_size"`           // 本地审计文件滚动大小（单位 MB），默认 100
+		MaxBackups       int    `yaml:"max_backups"`        // 本地审计文件最多保留的滚动文件数，默认全部保留
+		QueueSize        int    `yaml:"queue_size"`         // 异步写入队列大小，默认 10000
+		EnqueueTimeout   int    `yaml:"enqueue_timeout"`    // 队列满时写入队列的最长等待时间（单位 ms），默认 100
+		BeforeImage      bool   `yaml:"before_image"`       // 是否记录 update、delete 的前镜像
+		BeforeImageLimit int    `yaml:"before_image_limit"` // 前镜像最多记录的行数，默认 100
+	}
+
+	Schema struct {
+		Mode        string `yaml:"mode"`        // 执行单元结构校验模式 off/audit/enforce，默认 off
+		Refresh     int    `yaml:"refresh"`     // 表结构全量刷新间隔（单位 秒），默认 300
+		Concurrency int    `yaml:"concurrency"` // 每个库同时拉取表结构的并发数，默认 4，各库之间并行拉取
+		Timeout     int    `yaml:"timeout"`     // 单个表结构拉取超时（单位 ms），默认 3000
 	}
 
 	Log []*logger.Config `yaml:"log"`
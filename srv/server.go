@@ -156,11 +156,6 @@ func newService(name, protocol string, cfg *config) Service {
 		opts.Transport = http.DefaultHttpTransport
 		opts.Address = net.JoinHostPort(cfg.LocalIP, strconv.Itoa(int(cfg.Server.HttpPort)))
 		opts.TransportOptions.Address = opts.Address
-
-		// TLS 证书配置
-		opts.TransportOptions.TLSCertFile = cfg.Server.TLSCert
-		opts.TransportOptions.TLSKeyFile = cfg.Server.TLSKey
-		opts.TransportOptions.CACertFile = cfg.Server.CACert
 	} else {
 		opts.Codec = rpc.DefaultServerCodec
 		opts.Transport = rpc.DefaultRpcTransport
@@ -168,6 +163,11 @@ func newService(name, protocol string, cfg *config) Service {
 		opts.TransportOptions.Address = opts.Address
 	}
 
+	// TLS 证书配置，http、rpc 共用，配置 ca_cert 时为双向 tls
+	opts.TransportOptions.TLSCertFile = cfg.Server.TLSCert
+	opts.TransportOptions.TLSKeyFile = cfg.Server.TLSKey
+	opts.TransportOptions.CACertFile = cfg.Server.CACert
+
 	if cfg.Register != nil && cfg.Register.Enable != false {
 		// 名字服务注册器
 		reg, err := naming.Add(protocol, opts.ServiceName, opts.Address, cfg.Register)
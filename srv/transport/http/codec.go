@@ -15,6 +15,7 @@
 package http
 
 import (
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net/http"
@@ -28,11 +29,16 @@ import (
 	"github.com/horm-database/common/errs"
 	"github.com/horm-database/common/proto"
 	"github.com/horm-database/common/types"
-	"github.com/horm-database/common/util"
+	cs "github.com/horm-database/server/consts"
 	"github.com/horm-database/server/srv/codec"
 	"github.com/horm-database/server/srv/transport"
 )
 
+const (
+	headerAuthorization = "Authorization"
+	bearerScheme        = "Bearer "
+)
+
 var (
 	// DefaultServerCodec is the default http server codec.
 	DefaultServerCodec = &ServerCodec{}
@@ -141,7 +147,7 @@ func (sc *ServerCodec) setReqHeader(fc *frameCodec, msg *cc.Msg) error {
 		reqHeader.Appid, _ = strconv.ParseUint(v, 10, 64)
 	}
 
-	reqHeader.Ip = util.GetIpFromAddr(msg.RemoteAddr())
+	reqHeader.Ip = transport.RemoteIP(msg.RemoteAddr())
 
 	if v := fc.header[proto.HeaderAuthRand]; v != "" {
 		i, _ := strconv.Atoi(v)
@@ -151,6 +157,16 @@ func (sc *ServerCodec) setReqHeader(fc *frameCodec, msg *cc.Msg) error {
 		reqHeader.Sign = v
 	}
 
+	// Authorization: Bearer <jwt>，由 auth.SignCheck 校验
+	authorization := fc.header[headerAuthorization]
+	if authorization == "" {
+		authorization = fc.header[strings.ToLower(headerAuthorization)]
+	}
+
+	if len(authorization) > len(bearerScheme) && strings.EqualFold(authorization[:len(bearerScheme)], bearerScheme) {
+		reqHeader.Sign = cs.SignPrefixBearer + strings.TrimSpace(authorization[len(bearerScheme):])
+	}
+
 	msg.WithServerRespHead(codec.GetRespFromReqHeader(reqHeader))
 	return nil
 }
@@ -211,6 +227,15 @@ type frameCodec struct {
 	bufLen  int
 	headLen int
 	bodyLen int
+	tls     *transport.TLSConn // tls 连接，明文传输时为 nil
+}
+
+// PeerCertificate implements transport.PeerCertifier.
+func (fc *frameCodec) PeerCertificate() *x509.Certificate {
+	if fc.tls == nil {
+		return nil
+	}
+	return fc.tls.PeerCertificate()
 }
 
 func (fc *frameCodec) resetBuf() {
@@ -19,6 +19,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"strconv"
@@ -72,10 +73,16 @@ func (t *transportHttp) Serve(ctx context.Context, opts *transport.Options) (err
 		serverOpts = append(serverOpts, gnet.WithTCPKeepAlive(opts.KeepAlivePeriod))
 	}
 
+	tlsConfig, err := transport.NewTLSConfig(opts)
+	if err != nil {
+		return fmt.Errorf("http server tls config error: %v", err)
+	}
+
 	hs := &httpServer{
-		ctx:     ctx,
-		address: fmt.Sprintf("tcp://%s", opts.Address),
-		opts:    opts,
+		ctx:       ctx,
+		address:   fmt.Sprintf("tcp://%s", opts.Address),
+		opts:      opts,
+		tlsConfig: tlsConfig,
 	}
 
 	go func() {
@@ -91,6 +98,7 @@ type httpServer struct {
 	ctx       context.Context
 	address   string
 	opts      *transport.Options
+	tlsConfig *tls.Config // 为 nil 时明文传输
 	eng       gnet.Engine
 	closeOnce sync.Once
 }
@@ -109,7 +117,12 @@ func (h *httpServer) OnBoot(eng gnet.Engine) gnet.Action {
 		)
 	}()
 
-	log.Infof(h.ctx, "http server listening on %s", h.address)
+	if h.tlsConfig != nil {
+		log.Infof(h.ctx, "https server listening on %s, client cert required: %v",
+			h.address, h.tlsConfig.ClientCAs != nil)
+	} else {
+		log.Infof(h.ctx, "http server listening on %s", h.address)
+	}
 	return gnet.None
 }
 
@@ -117,28 +130,61 @@ func (h *httpServer) OnShutdown(_ gnet.Engine) {
 }
 
 func (h *httpServer) OnOpen(c gnet.Conn) ([]byte, gnet.Action) {
-	c.SetContext(&frameCodec{Parser: wildcat.NewHTTPParser(), opts: h.opts})
+	fc := &frameCodec{Parser: wildcat.NewHTTPParser(), opts: h.opts}
+	c.SetContext(fc)
+
+	if h.tlsConfig != nil {
+		fc.tls = transport.NewTLSConn(c, h.tlsConfig, h.opts.IdleTimeout)
+		go h.serveTLS(fc)
+	}
+
 	return nil, gnet.None
 }
 
-func (h *httpServer) OnClose(_ gnet.Conn, _ error) (action gnet.Action) {
+func (h *httpServer) OnClose(c gnet.Conn, _ error) (action gnet.Action) {
+	if fc, ok := c.Context().(*frameCodec); ok && fc.tls != nil {
+		fc.tls.Closed()
+	}
 	return
 }
 
 func (h *httpServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 	fc := c.Context().(*frameCodec)
 
+	buf, err := c.Next(-1)
+	if err != nil {
+		return writeError(c, fc, fmt.Errorf("next buf error: %v", err))
+	}
+
+	if fc.tls != nil { // 密文交给 tls 连接协程处理，未处理的密文过多时关闭连接
+		if !fc.tls.Feed(buf) {
+			return gnet.Close
+		}
+		return gnet.None
+	}
+
+	return h.traffic(c, fc, buf)
+}
+
+// serveTLS tls 连接协程，握手后处理解密后的 http 请求
+func (h *httpServer) serveTLS(fc *frameCodec) {
+	err := fc.tls.Serve(h.ctx, func(buf []byte) bool {
+		return h.traffic(fc.tls, fc, buf) != gnet.Close
+	})
+
+	if err != nil {
+		log.Debug(cc.GCtx, "http server tls conn serve fail ", err)
+	}
+}
+
+// traffic 处理收到的 http 请求，c 为明文 gnet 连接或 tls 连接
+func (h *httpServer) traffic(c transport.Conn, fc *frameCodec, buf []byte) (action gnet.Action) {
 	defer func() {
 		if e := recover(); e != nil {
 			action = writeError(c, fc, fmt.Errorf("receive buf panic: %v", e))
 		}
 	}()
 
-	buf, err := c.Next(-1)
-	if err != nil {
-		return writeError(c, fc, fmt.Errorf("next buf error: %v", err))
-	}
-
 	bufLen := len(buf)
 	if bufLen == 0 {
 		return writeError(c, fc, errors.New("receive empty buf"))
@@ -181,7 +227,7 @@ func (h *httpServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 		}
 
 		copy(fc.buf[fc.bufLen:], buf)
-		_, err = fc.Parser.Parse(fc.buf)
+		_, err := fc.Parser.Parse(fc.buf)
 		if err != nil {
 			return writeError(c, fc, fmt.Errorf("http parse error: %v", err))
 		}
@@ -189,16 +235,17 @@ func (h *httpServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 		body = fc.buf[fc.headLen:]
 	}
 
-	workspace := table.GetWorkspace()
-	if workspace.EnforceSign == consts.WorkspaceEnforceSignYes {
+	snap := table.Current()
+	if snap.Workspace().EnforceSign == consts.WorkspaceEnforceSignYes {
 		return writeError(c, fc, errors.New("workspace enforce signature, not support http"))
 	}
 
-	return h.handle(c, fc, body)
+	return h.handle(c, fc, snap, body)
 }
 
-func (h *httpServer) handle(c gnet.Conn, fc *frameCodec, body []byte) gnet.Action {
+func (h *httpServer) handle(c transport.Conn, fc *frameCodec, snap *table.Snapshot, body []byte) gnet.Action {
 	ctx, msg := codec.NewMessage(h.ctx)
+	ctx = table.PinSnapshot(ctx, snap)
 
 	defer func() {
 		codec.RecycleMessage(msg)
@@ -224,7 +271,7 @@ func (h *httpServer) handle(c gnet.Conn, fc *frameCodec, body []byte) gnet.Actio
 	return gnet.None
 }
 
-func writeError(c gnet.Conn, fc *frameCodec, err error) gnet.Action {
+func writeError(c transport.Conn, fc *frameCodec, err error) gnet.Action {
 	respBuilder := strings.Builder{}
 	respBuilder.WriteString("HTTP/1.1 500 Internal Server Error\r\nServer: http.")
 	respBuilder.WriteString(fc.opts.ServiceName)
@@ -15,6 +15,7 @@
 package rpc
 
 import (
+	"crypto/x509"
 	"errors"
 	"time"
 
@@ -22,7 +23,6 @@ import (
 	"github.com/horm-database/common/codec"
 	"github.com/horm-database/common/errs"
 	cp "github.com/horm-database/common/proto"
-	"github.com/horm-database/common/util"
 	cc "github.com/horm-database/server/srv/codec"
 	"github.com/horm-database/server/srv/transport"
 )
@@ -54,7 +54,7 @@ func (s *ServerCodec) Decode(msg *codec.Msg, reqBuf []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	reqHeader.Ip = util.GetIpFromAddr(msg.RemoteAddr())
+	reqHeader.Ip = transport.RemoteIP(msg.RemoteAddr())
 
 	// 根据解析后的 request_header 更新 msg
 	msg.WithServerReqHead(reqHeader)
@@ -150,6 +150,15 @@ type frameCodec struct {
 	buf              []byte
 	bufLen           int
 	totalLen         int
+	tls              *transport.TLSConn // tls 连接，明文传输时为 nil
+}
+
+// PeerCertificate implements transport.PeerCertifier.
+func (fc *frameCodec) PeerCertificate() *x509.Certificate {
+	if fc.tls == nil {
+		return nil
+	}
+	return fc.tls.PeerCertificate()
 }
 
 func (fc *frameCodec) resetBuf() {
@@ -0,0 +1,95 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/horm-database/common/codec"
+	"github.com/horm-database/common/types"
+	"github.com/horm-database/server/consts"
+)
+
+const (
+	gcmNonceLen = 12
+	gcmTagLen   = 16
+
+	// gcmKeyInfo AES-GCM 加密帧秘钥派生信息，秘钥为 HMAC-SHA256(workspace token, gcmKeyInfo)
+	gcmKeyInfo = "horm-rpc-frame-aes-gcm"
+)
+
+// gcmKey 由 workspace token 派生 AES-256 秘钥，token 长度不受 AES 秘钥长度限制
+func gcmKey(token string) []byte {
+	mac := hmac.New(sha256.New, types.StringToBytes(token))
+	mac.Write([]byte(gcmKeyInfo))
+	return mac.Sum(nil)
+}
+
+func newGCM(token string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(gcmKey(token))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// gcmOpen 解密 AES-GCM 加密帧，frame 为包含帧头的完整帧，返回解密后的普通帧
+func gcmOpen(frame []byte, token string) ([]byte, error) {
+	if len(frame) < codec.EncryptFrameHeadLen+gcmNonceLen+gcmTagLen {
+		return nil, errors.New("encrypt frame is too short")
+	}
+
+	aead, err := newGCM(token)
+	if err != nil {
+		return nil, err
+	}
+
+	head := frame[:codec.EncryptFrameHeadLen]
+	nonce := frame[codec.EncryptFrameHeadLen : codec.EncryptFrameHeadLen+gcmNonceLen]
+	sealed := frame[codec.EncryptFrameHeadLen+gcmNonceLen:]
+
+	return aead.Open(nil, nonce, sealed, head)
+}
+
+// gcmSeal 使用随机 nonce 将普通帧加密为 AES-GCM 加密帧
+func gcmSeal(workspaceID int, token string, frame []byte) ([]byte, error) {
+	aead, err := newGCM(token)
+	if err != nil {
+		return nil, err
+	}
+
+	totalLen := codec.EncryptFrameHeadLen + gcmNonceLen + len(frame) + aead.Overhead()
+
+	buf := make([]byte, codec.EncryptFrameHeadLen+gcmNonceLen, totalLen)
+	buf[0] = consts.FrameTypeEncryptGCM
+	buf[1] = codec.EncryptVersion
+	buf[2] = codec.ProtocolTypeRPC
+	binary.BigEndian.PutUint32(buf[3:7], uint32(totalLen))
+	binary.BigEndian.PutUint32(buf[7:11], uint32(workspaceID))
+
+	nonce := buf[codec.EncryptFrameHeadLen:]
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(buf, nonce, frame, buf[:codec.EncryptFrameHeadLen]), nil
+}
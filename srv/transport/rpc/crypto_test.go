@@ -0,0 +1,124 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpc
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+
+	"github.com/horm-database/common/codec"
+	"github.com/horm-database/server/consts"
+)
+
+func TestGCMFrame(t *testing.T) {
+	frame := []byte("plain rpc frame")
+
+	sealed, err := gcmSeal(7, "token", frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sealed[0] != consts.FrameTypeEncryptGCM || sealed[1] != codec.EncryptVersion || sealed[2] != codec.ProtocolTypeRPC ||
+		binary.BigEndian.Uint32(sealed[3:7]) != uint32(len(sealed)) || binary.BigEndian.Uint32(sealed[7:11]) != 7 {
+		t.Fatalf("invalid frame head %v, frame length %d", sealed[:codec.EncryptFrameHeadLen], len(sealed))
+	}
+
+	opened, err := gcmOpen(sealed, "token")
+	if err != nil || !bytes.Equal(opened, frame) {
+		t.Fatalf("open frame = %q, err=%v, want %q", opened, err, frame)
+	}
+
+	// 每次加密使用随机 nonce
+	if again, _ := gcmSeal(7, "token", frame); bytes.Equal(again, sealed) {
+		t.Error("sealed frames with the same nonce")
+	}
+
+	if _, err = gcmOpen(sealed, "other token"); err == nil {
+		t.Error("open frame with wrong token")
+	}
+
+	if _, err = gcmOpen(sealed[:codec.EncryptFrameHeadLen+gcmNonceLen+gcmTagLen-1], "token"); err == nil {
+		t.Error("open too short frame")
+	}
+
+	// 帧头（附加数据）、nonce、密文、tag 被篡改
+	for _, i := range []int{2, 8, codec.EncryptFrameHeadLen, codec.EncryptFrameHeadLen + gcmNonceLen, len(sealed) - 1} {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 1
+
+		if _, err = gcmOpen(tampered, "token"); err == nil {
+			t.Errorf("open frame tampered at byte %d", i)
+		}
+	}
+}
+
+// aesEncrypt 与客户端相同的 AES-CBC 加密，iv 为秘钥前 16 字节，结果 base64 编码
+func aesEncrypt(t *testing.T, plain, key []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(block, key[:aes.BlockSize]).CryptBlocks(buf, plain)
+
+	ret := make([]byte, base64.StdEncoding.EncodedLen(len(buf)))
+	base64.StdEncoding.Encode(ret, buf)
+	return ret
+}
+
+func pkcs7Padding(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	return append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+}
+
+func TestAESDecrypt(t *testing.T) {
+	key := []byte("0123456789abcdef")
+
+	for _, n := range []int{0, 5, 15, 16, 33} {
+		plain := bytes.Repeat([]byte{'a'}, n)
+
+		buf, err := aesDecrypt(aesEncrypt(t, pkcs7Padding(plain, aes.BlockSize), key), key)
+		if err != nil || !bytes.Equal(buf, plain) {
+			t.Errorf("decrypt %d bytes = %q, err=%v", n, buf, err)
+		}
+	}
+
+	block := bytes.Repeat([]byte{'a'}, aes.BlockSize)
+	invalid := map[string][]byte{
+		"zero padding":         append(block[:15:15], 0),
+		"padding over block":   append(block[:15:15], 17),
+		"inconsistent padding": append(block[:13:13], 1, 3, 3),
+	}
+
+	for name, plain := range invalid {
+		if _, err := aesDecrypt(aesEncrypt(t, plain, key), key); err == nil {
+			t.Errorf("%s: decrypt without error", name)
+		}
+	}
+
+	short := make([]byte, base64.StdEncoding.EncodedLen(10))
+	base64.StdEncoding.Encode(short, make([]byte, 10))
+
+	for _, cryted := range [][]byte{nil, short, []byte("not base64!")} {
+		if _, err := aesDecrypt(cryted, key); err == nil {
+			t.Errorf("decrypt %q without error", cryted)
+		}
+	}
+}
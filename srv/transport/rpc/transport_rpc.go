@@ -19,6 +19,7 @@ import (
 	"context"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -57,10 +58,18 @@ func NewRpcTransport() transport.Transport {
 // Serve starts listening and serve
 func (s *transportRPC) Serve(ctx context.Context, opts *transport.Options) (err error) {
 	if opts.Network == "unix" || opts.Network == "tcp" || opts.Network == "tcp4" || opts.Network == "tcp6" {
+		var tlsConfig *tls.Config
+
+		tlsConfig, err = transport.NewTLSConfig(opts)
+		if err != nil {
+			return fmt.Errorf("rpc server tls config error: %v", err)
+		}
+
 		rs := &rpcServer{
-			ctx:     ctx,
-			address: fmt.Sprintf("%s://%s", opts.Network, opts.Address),
-			opts:    opts,
+			ctx:       ctx,
+			address:   fmt.Sprintf("%s://%s", opts.Network, opts.Address),
+			opts:      opts,
+			tlsConfig: tlsConfig,
 		}
 
 		serverOpts := []gnet.Option{
@@ -94,6 +103,7 @@ type rpcServer struct {
 	ctx       context.Context
 	address   string
 	opts      *transport.Options
+	tlsConfig *tls.Config // 为 nil 时明文传输
 	eng       gnet.Engine
 	closeOnce sync.Once
 }
@@ -112,7 +122,12 @@ func (r *rpcServer) OnBoot(eng gnet.Engine) gnet.Action {
 		)
 	}()
 
-	log.Infof(r.ctx, "rpc server listening on %s", r.address)
+	if r.tlsConfig != nil {
+		log.Infof(r.ctx, "rpc server listening on %s with tls, client cert required: %v",
+			r.address, r.tlsConfig.ClientCAs != nil)
+	} else {
+		log.Infof(r.ctx, "rpc server listening on %s", r.address)
+	}
 	return gnet.None
 }
 
@@ -120,28 +135,61 @@ func (r *rpcServer) OnShutdown(_ gnet.Engine) {
 }
 
 func (r *rpcServer) OnOpen(c gnet.Conn) (out []byte, action gnet.Action) {
-	c.SetContext(&frameCodec{opts: r.opts})
+	fc := &frameCodec{opts: r.opts}
+	c.SetContext(fc)
+
+	if r.tlsConfig != nil {
+		fc.tls = transport.NewTLSConn(c, r.tlsConfig, r.opts.IdleTimeout)
+		go r.serveTLS(fc)
+	}
+
 	return
 }
 
-func (r *rpcServer) OnClose(_ gnet.Conn, _ error) (action gnet.Action) {
+func (r *rpcServer) OnClose(c gnet.Conn, _ error) (action gnet.Action) {
+	if fc, ok := c.Context().(*frameCodec); ok && fc.tls != nil {
+		fc.tls.Closed()
+	}
 	return
 }
 
 func (r *rpcServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 	fc := c.Context().(*frameCodec)
 
+	buf, err := c.Next(-1)
+	if err != nil {
+		return writeError(c, fc, fmt.Errorf("next buf error: %v", err))
+	}
+
+	if fc.tls != nil { // 密文交给 tls 连接协程处理，未处理的密文过多时关闭连接
+		if !fc.tls.Feed(buf) {
+			return gnet.Close
+		}
+		return gnet.None
+	}
+
+	return r.traffic(c, fc, buf)
+}
+
+// serveTLS tls 连接协程，握手后处理解密后的请求帧
+func (r *rpcServer) serveTLS(fc *frameCodec) {
+	err := fc.tls.Serve(r.ctx, func(buf []byte) bool {
+		return r.traffic(fc.tls, fc, buf) != gnet.Close
+	})
+
+	if err != nil {
+		log.Debug(cc.GCtx, "rpc server tls conn serve fail ", err)
+	}
+}
+
+// traffic 处理收到的请求帧，c 为明文 gnet 连接或 tls 连接
+func (r *rpcServer) traffic(c transport.Conn, fc *frameCodec, buf []byte) (action gnet.Action) {
 	defer func() {
 		if e := recover(); e != nil {
 			action = writeError(c, fc, fmt.Errorf("receive buf panic: %v", e))
 		}
 	}()
 
-	buf, err := c.Next(-1)
-	if err != nil {
-		return writeError(c, fc, fmt.Errorf("next buf error: %v", err))
-	}
-
 	bufLen := len(buf)
 	if bufLen == 0 {
 		return writeError(c, fc, errors.New("receive empty buf"))
@@ -156,7 +204,7 @@ func (r *rpcServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 			fc.signFrameHead = codec.NewSignFrameHead()
 			fc.signFrameHead.Extract(buf)
 			fc.totalLen = int(fc.signFrameHead.TotalLen)
-		} else if fc.frameType == codec.FrameTypeEncrypt {
+		} else if fc.frameType == codec.FrameTypeEncrypt || fc.frameType == consts.FrameTypeEncryptGCM {
 			fc.encryptFrameHead = codec.NewEncryptFrameHead()
 			fc.encryptFrameHead.Extract(buf)
 			fc.totalLen = int(fc.encryptFrameHead.TotalLen)
@@ -188,9 +236,10 @@ func (r *rpcServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 		}
 	}
 
-	workspace := table.GetWorkspace()
-	if workspace.EnforceSign == consts.WorkspaceEnforceSignYes &&
-		(fc.frameType != codec.FrameTypeSignature && fc.frameType != codec.FrameTypeEncrypt) {
+	snap := table.Current() // 解帧与响应加密使用同一个快照的 workspace，并固定到请求
+	workspace := snap.Workspace()
+	if workspace.EnforceSign == consts.WorkspaceEnforceSignYes && fc.frameType != codec.FrameTypeSignature &&
+		fc.frameType != codec.FrameTypeEncrypt && fc.frameType != consts.FrameTypeEncryptGCM {
 		return writeError(c, fc, errors.New("enforce signature, buf input frame is not signature and encrypt"))
 	}
 
@@ -216,17 +265,28 @@ func (r *rpcServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 		if fc.frameHead.TotalLen != uint32(len(reqBuf))+codec.FrameHeadLen {
 			return writeError(c, fc, errors.New("signature frame request buffer length is invalid"))
 		}
-	} else if fc.frameType == codec.FrameTypeEncrypt {
+	} else if fc.frameType == codec.FrameTypeEncrypt || fc.frameType == consts.FrameTypeEncryptGCM {
 		if fc.encryptFrameHead.WorkspaceID != uint32(workspace.Id) {
 			return writeError(c, fc, errors.New("workspace get from encrypt frame is illegal"))
 		}
 
-		encryptFrameBuf := buf[codec.EncryptFrameHeadLen:]
-		frameBuf, err := aesDecrypt(encryptFrameBuf, types.StringToBytes(workspace.Token))
+		var frameBuf []byte
+		var err error
+
+		if fc.frameType == consts.FrameTypeEncryptGCM {
+			frameBuf, err = gcmOpen(fc.buf[:fc.totalLen], workspace.Token)
+		} else { // 旧版 AES-CBC 加密帧，迁移期间兼容
+			frameBuf, err = aesDecrypt(fc.buf[codec.EncryptFrameHeadLen:fc.totalLen], types.StringToBytes(workspace.Token))
+		}
+
 		if err != nil {
 			return writeError(c, fc, fmt.Errorf("frame buffer AES decrypt failed: %v", err))
 		}
 
+		if len(frameBuf) < codec.FrameHeadLen {
+			return writeError(c, fc, errors.New("AES decrypt failed, frame is too short"))
+		}
+
 		fc.frameHead = codec.NewFrameHead()
 		fc.frameHead.Extract(frameBuf)
 		reqBuf = frameBuf[codec.FrameHeadLen:]
@@ -238,11 +298,12 @@ func (r *rpcServer) OnTraffic(c gnet.Conn) (action gnet.Action) {
 		reqBuf = fc.buf[codec.FrameHeadLen:]
 	}
 
-	return r.handle(c, fc, reqBuf)
+	return r.handle(c, fc, snap, reqBuf)
 }
 
-func (r *rpcServer) handle(c gnet.Conn, fc *frameCodec, reqBuf []byte) gnet.Action {
+func (r *rpcServer) handle(c transport.Conn, fc *frameCodec, snap *table.Snapshot, reqBuf []byte) gnet.Action {
 	ctx, msg := codec.NewMessage(r.ctx)
+	ctx = table.PinSnapshot(ctx, snap)
 
 	defer func() {
 		codec.RecycleMessage(msg)
@@ -261,6 +322,17 @@ func (r *rpcServer) handle(c gnet.Conn, fc *frameCodec, reqBuf []byte) gnet.Acti
 		return gnet.Close
 	}
 
+	if len(rsp) > 0 && fc.frameType == consts.FrameTypeEncryptGCM { // 加密请求的响应同样加密
+		workspace := snap.Workspace()
+
+		rsp, err = gcmSeal(workspace.Id, workspace.Token, rsp)
+		if err != nil {
+			metrics.TCPServerTransportHandleFail.Incr()
+			log.Debug(cc.GCtx, "client: tcpConn encrypt response fail ", err)
+			return gnet.Close
+		}
+	}
+
 	if len(rsp) > 0 {
 		if _, err = c.Write(rsp); err != nil {
 			metrics.TCPServerTransportWriteFail.Incr()
@@ -292,21 +364,34 @@ func aesDecrypt(cryted, key []byte) (buf []byte, err error) {
 	}
 
 	blockSize := block.BlockSize()
+	if len(crytedByte) == 0 || len(crytedByte)%blockSize != 0 {
+		return nil, errors.New("cipher text is not a multiple of the block size")
+	}
+
 	blockMode := cipher.NewCBCDecrypter(block, key[:blockSize])
 	buf = make([]byte, len(crytedByte))
 	blockMode.CryptBlocks(buf, crytedByte)
-	buf = pkcs7UnPadding(buf)
-	return buf, nil
+	return pkcs7UnPadding(buf, blockSize)
 }
 
-// 去码
-func pkcs7UnPadding(origData []byte) []byte {
+// 去码，校验 PKCS7 填充
+func pkcs7UnPadding(origData []byte, blockSize int) ([]byte, error) {
 	length := len(origData)
 	unpadding := int(origData[length-1])
-	return origData[:(length - unpadding)]
+	if unpadding == 0 || unpadding > blockSize || unpadding > length {
+		return nil, errors.New("invalid pkcs7 padding")
+	}
+
+	for _, b := range origData[length-unpadding:] {
+		if int(b) != unpadding {
+			return nil, errors.New("invalid pkcs7 padding")
+		}
+	}
+
+	return origData[:(length - unpadding)], nil
 }
 
-func writeError(c gnet.Conn, fc *frameCodec, err error) gnet.Action {
+func writeError(c transport.Conn, fc *frameCodec, err error) gnet.Action {
 	frameHead := codec.NewFrameHead()
 
 	respHeader := cp.ResponseHeader{
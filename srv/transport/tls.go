@@ -0,0 +1,288 @@
+// Copyright (c) 2024 The horm-database Authors. All rights reserved.
+// This file Author:  CaoHao <18500482693@163.com> .
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/horm-database/common/codec"
+	"github.com/panjf2000/gnet/v2"
+)
+
+const (
+	tlsHandshakeTimeout = 10 * time.Second
+	tlsReadBufSize      = 64 * 1024
+	tlsMaxBuffered      = 2 * codec.MaxFrameSize // 最多缓存的未解密密文，超出时关闭连接
+)
+
+// Conn 连接的写及地址，明文连接为 gnet.Conn，tls 连接为 TLSConn
+type Conn interface {
+	Write(buf []byte) (int, error)
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// PeerCertifier 能获取客户端证书的 frame codec，双向 tls 连接的 frame codec 实现该接口
+type PeerCertifier interface {
+	PeerCertificate() *x509.Certificate
+}
+
+// NewTLSConfig 根据 TLSCertFile、TLSKeyFile 生成服务端 tls 配置，未配置证书时返回 nil（明文）。
+// 配置了 CACertFile 时为双向 tls，客户端必须提供由该 ca 签发的证书。
+func NewTLSConfig(opts *Options) (*tls.Config, error) {
+	if opts.TLSCertFile == "" && opts.TLSKeyFile == "" {
+		if opts.CACertFile != "" {
+			return nil, errors.New("ca_cert is set but tls_cert and tls_key are empty")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls cert %s and key %s error: %v", opts.TLSCertFile, opts.TLSKeyFile, err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if opts.CACertFile != "" {
+		ca, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca cert %s error: %v", opts.CACertFile, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("ca cert %s has no valid certificate", opts.CACertFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// TLSConn gnet 连接上的 tls 连接。gnet 没有 tls 支持，OnTraffic 收到的密文通过 Feed 写入，
+// 由 Serve 在独立协程中完成握手、解密，明文交给 handle 处理，写入的明文加密后通过 AsyncWrite 发送。
+type TLSConn struct {
+	raw  *rawConn
+	conn *tls.Conn
+	cert *x509.Certificate
+	idle time.Duration // 连接最大空闲时间，超过时间未收到数据时关闭连接，0 为不限制
+}
+
+// NewTLSConn 创建 gnet 连接上的 tls 服务端连接，idle 为连接最大空闲时间
+func NewTLSConn(c gnet.Conn, config *tls.Config, idle time.Duration) *TLSConn {
+	raw := &rawConn{c: c}
+	raw.cond = sync.NewCond(&raw.mu)
+
+	return &TLSConn{raw: raw, conn: tls.Server(raw, config), idle: idle}
+}
+
+// Feed 写入从 gnet 连接收到的密文，buf 会被复制。缓存的密文超过上限（客户端发送快于处理）时返回 false，需关闭连接
+func (t *TLSConn) Feed(buf []byte) bool {
+	return t.raw.feed(buf)
+}
+
+// Serve 握手并循环读取明文，handle 返回 false 时关闭连接，连接关闭、握手超时、空闲超时时返回
+func (t *TLSConn) Serve(ctx context.Context, handle func(buf []byte) bool) error {
+	defer t.Close()
+
+	_ = t.raw.SetReadDeadline(time.Now().Add(tlsHandshakeTimeout))
+
+	hctx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	err := t.conn.HandshakeContext(hctx)
+	cancel()
+
+	if err != nil {
+		return fmt.Errorf("tls handshake error: %v", err)
+	}
+
+	if certs := t.conn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		t.cert = certs[0]
+	}
+
+	buf := make([]byte, tlsReadBufSize)
+	for {
+		var deadline time.Time
+		if t.idle > 0 {
+			deadline = time.Now().Add(t.idle)
+		}
+		_ = t.raw.SetReadDeadline(deadline)
+
+		n, err := t.conn.Read(buf)
+		if n > 0 && !handle(buf[:n]) {
+			return nil
+		}
+
+		if err != nil {
+			if err == io.EOF || errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Write 写入明文
+func (t *TLSConn) Write(buf []byte) (int, error) {
+	return t.conn.Write(buf)
+}
+
+// Close 关闭 tls 连接及 gnet 连接
+func (t *TLSConn) Close() {
+	_ = t.conn.Close()
+}
+
+// Closed gnet 连接已关闭，唤醒阻塞的读
+func (t *TLSConn) Closed() {
+	t.raw.closed()
+}
+
+// PeerCertificate 握手校验通过的客户端证书，非双向 tls 时为 nil
+func (t *TLSConn) PeerCertificate() *x509.Certificate {
+	return t.cert
+}
+
+func (t *TLSConn) LocalAddr() net.Addr {
+	return t.raw.c.LocalAddr()
+}
+
+func (t *TLSConn) RemoteAddr() net.Addr {
+	return t.raw.c.RemoteAddr()
+}
+
+// rawConn 将 gnet 连接适配为 tls.Conn 所需的阻塞 net.Conn，读为 Feed 写入的密文，写通过 AsyncWrite 交给 event loop。
+// 读支持 deadline，写为异步写入，不支持 deadline
+type rawConn struct {
+	c        gnet.Conn
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buf      []byte
+	isDone   bool
+	deadline time.Time   // 读超时时间，零值为不超时
+	timer    *time.Timer // 到达读超时时间时唤醒阻塞的读
+}
+
+func (r *rawConn) feed(buf []byte) bool {
+	r.mu.Lock()
+	if len(r.buf)+len(buf) > tlsMaxBuffered {
+		r.mu.Unlock()
+		return false
+	}
+
+	r.buf = append(r.buf, buf...)
+	r.mu.Unlock()
+	r.cond.Signal()
+
+	return true
+}
+
+func (r *rawConn) closed() {
+	r.mu.Lock()
+	r.isDone = true
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+func (r *rawConn) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for len(r.buf) == 0 && !r.isDone {
+		if !r.deadline.IsZero() && !time.Now().Before(r.deadline) {
+			return 0, os.ErrDeadlineExceeded
+		}
+		r.cond.Wait()
+	}
+
+	if len(r.buf) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	if len(r.buf) == 0 {
+		r.buf = nil
+	}
+
+	return n, nil
+}
+
+func (r *rawConn) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	copy(buf, p)
+
+	if err := r.c.AsyncWrite(buf, nil); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (r *rawConn) Close() error {
+	r.closed()
+	return r.c.Close()
+}
+
+func (r *rawConn) LocalAddr() net.Addr {
+	return r.c.LocalAddr()
+}
+
+func (r *rawConn) RemoteAddr() net.Addr {
+	return r.c.RemoteAddr()
+}
+
+func (r *rawConn) SetDeadline(t time.Time) error {
+	return r.SetReadDeadline(t)
+}
+
+func (r *rawConn) SetReadDeadline(t time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deadline = t
+
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+
+	if !t.IsZero() {
+		r.timer = time.AfterFunc(time.Until(t), func() {
+			r.mu.Lock() // 持有锁再唤醒，避免读在检查超时与进入等待之间错过唤醒
+			r.mu.Unlock()
+			r.cond.Broadcast()
+		})
+	}
+
+	return nil
+}
+
+func (r *rawConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
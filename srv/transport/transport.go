@@ -51,3 +51,24 @@ type Options struct {
 	TLSCertFile string // server certification file
 	TLSKeyFile  string // server key file
 }
+
+// RemoteIP returns the ip of the remote address, ipv6 address is supported.
+func RemoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}